@@ -0,0 +1,450 @@
+package analyzer
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxAccountFileSize is the size of the largest account database read.
+const maxAccountFileSize = 4 << 20
+
+// Kinds of account issues
+const (
+	AccountEmptyPassword = "empty-password"
+	AccountWeakHash      = "weak-hash"
+	AccountWeakPassword  = "weak-password"
+	AccountExtraRoot     = "extra-root"
+	AccountNoPasswdSudo  = "nopasswd-sudo"
+	AccountUnknownUser   = "unknown-user"
+)
+
+// Accounts describes the users of the final filesystem and the user the
+// image runs as.
+type Accounts struct {
+	User   ImageUser      `json:"user"`
+	Issues []AccountIssue `json:"issues,omitempty"`
+}
+
+// ImageUser is the User of the image configuration resolved against the
+// etc/passwd and etc/group files of the final filesystem.
+type ImageUser struct {
+	// Configured is the User of the image configuration, empty for root
+	Configured string `json:"configured,omitempty"`
+	// Resolved is false when the configuration names a user or group the
+	// image does not define, which docker refuses to start. Numeric IDs
+	// always resolve, as the kernel needs no entry for them.
+	Resolved bool   `json:"resolved"`
+	Name     string `json:"name,omitempty"`
+	UID      int    `json:"uid"`
+	GID      int    `json:"gid"`
+	// Groups are the supplementary groups etc/group grants the user
+	Groups []string `json:"groups,omitempty"`
+	Home   string   `json:"home,omitempty"`
+	Shell  string   `json:"shell,omitempty"`
+}
+
+// AccountIssue is an account of the final filesystem that is easy to log
+// in as or to escalate from.
+type AccountIssue struct {
+	Kind string `json:"kind"`
+	User string `json:"user"`
+	// Path, Layer and Instruction identify the file defining the account
+	// or rule
+	Path        string `json:"path"`
+	Layer       string `json:"layer"`
+	Instruction string `json:"instruction"`
+	Detail      string `json:"detail,omitempty"`
+	// Password is the password guessed for a weak-password issue
+	Password string `json:"password,omitempty"`
+}
+
+// passwdEntry is a user of an etc/passwd file.
+type passwdEntry struct {
+	Name string `json:"name"`
+	// Password is "x" when the hash is in etc/shadow
+	Password string `json:"password,omitempty"`
+	UID      int    `json:"uid"`
+	GID      int    `json:"gid"`
+	Home     string `json:"home,omitempty"`
+	Shell    string `json:"shell,omitempty"`
+}
+
+// groupEntry is a group of an etc/group file.
+type groupEntry struct {
+	Name    string   `json:"name"`
+	GID     int      `json:"gid"`
+	Members []string `json:"members,omitempty"`
+}
+
+// shadowEntry is the password hash of a user in an etc/shadow file.
+type shadowEntry struct {
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+}
+
+// sudoRule is a user specification of a sudoers file: who may run what.
+type sudoRule struct {
+	Principal string `json:"principal"`
+	Spec      string `json:"spec"`
+	NoPasswd  bool   `json:"nopasswd,omitempty"`
+}
+
+// accountFile holds what an account database of a layer defines. Only the
+// field matching the kind of the file is set.
+type accountFile struct {
+	Users  []passwdEntry `json:"users,omitempty"`
+	Groups []groupEntry  `json:"groups,omitempty"`
+	Shadow []shadowEntry `json:"shadow,omitempty"`
+	Sudo   []sudoRule    `json:"sudo,omitempty"`
+}
+
+// Kinds of account databases
+const (
+	accountPasswd  = "passwd"
+	accountGroup   = "group"
+	accountShadow  = "shadow"
+	accountSudoers = "sudoers"
+)
+
+// accountFileType returns the kind of account database at name, "" for
+// other files. Like sudo, it skips the files of etc/sudoers.d containing a
+// dot or ending with a tilde, such as package manager backups.
+func accountFileType(name string) string {
+	name = CleanPath(name)
+	switch name {
+	case "etc/passwd":
+		return accountPasswd
+	case "etc/group":
+		return accountGroup
+	case "etc/shadow":
+		return accountShadow
+	case "etc/sudoers":
+		return accountSudoers
+	}
+	dir, base := path.Split(name)
+	if dir == "etc/sudoers.d/" && !strings.Contains(base, ".") && !strings.HasSuffix(base, "~") {
+		return accountSudoers
+	}
+	return ""
+}
+
+// readAccountFile records the account database of kind at name in
+// layerName.
+func (s *scan) readAccountFile(layerName, name, kind string, size int64, r io.Reader) {
+	if size > maxAccountFileSize {
+		s.warn("%s: %s is too large to read", layerName, name)
+		return
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		s.warn("%s: failed to read %s: %v", layerName, name, err)
+		return
+	}
+	f := &accountFile{}
+	switch kind {
+	case accountPasswd:
+		f.Users = parsePasswd(data)
+	case accountGroup:
+		f.Groups = parseGroup(data)
+	case accountShadow:
+		f.Shadow = parseShadow(data)
+	case accountSudoers:
+		f.Sudo = parseSudoers(data)
+	}
+	if s.accounts[layerName] == nil {
+		s.accounts[layerName] = make(map[string]*accountFile)
+	}
+	s.accounts[layerName][CleanPath(name)] = f
+}
+
+// parsePasswd returns the users of an etc/passwd file, skipping malformed
+// lines.
+func parsePasswd(data []byte) []passwdEntry {
+	users := []passwdEntry{}
+	for _, fields := range accountLines(data, 7) {
+		uid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		gid, err := strconv.Atoi(fields[3])
+		if err != nil {
+			continue
+		}
+		users = append(users, passwdEntry{Name: fields[0], Password: fields[1], UID: uid, GID: gid, Home: fields[5], Shell: fields[6]})
+	}
+	return users
+}
+
+// parseGroup returns the groups of an etc/group file.
+func parseGroup(data []byte) []groupEntry {
+	groups := []groupEntry{}
+	for _, fields := range accountLines(data, 4) {
+		gid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		g := groupEntry{Name: fields[0], GID: gid}
+		for _, m := range strings.Split(fields[3], ",") {
+			if m = strings.TrimSpace(m); m != "" {
+				g.Members = append(g.Members, m)
+			}
+		}
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+// parseShadow returns the password hashes of an etc/shadow file.
+func parseShadow(data []byte) []shadowEntry {
+	entries := []shadowEntry{}
+	for _, fields := range accountLines(data, 2) {
+		entries = append(entries, shadowEntry{Name: fields[0], Hash: fields[1]})
+	}
+	return entries
+}
+
+// accountLines splits the lines of a colon separated account database,
+// skipping comments and lines with fewer than n fields.
+func accountLines(data []byte, n int) [][]string {
+	var lines [][]string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if fields := strings.Split(line, ":"); len(fields) >= n {
+			lines = append(lines, fields)
+		}
+	}
+	return lines
+}
+
+// sudoersDirectives start the lines of a sudoers file that are not user
+// specifications.
+var sudoersDirectives = []string{"Defaults", "User_Alias", "Runas_Alias", "Host_Alias", "Cmnd_Alias", "Cmd_Alias"}
+
+// parseSudoers returns the user specifications of a sudoers file. Aliases
+// are not expanded, so a rule granted to an alias names the alias.
+func parseSudoers(data []byte) []sudoRule {
+	rules := []sudoRule{}
+	text := strings.ReplaceAll(string(data), "\\\n", " ")
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		// Comments and #include lines start with #, @include lines with @
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "@") {
+			continue
+		}
+		if slices.ContainsFunc(sudoersDirectives, func(d string) bool { return strings.HasPrefix(fields[0], d) }) {
+			continue
+		}
+		spec := strings.Join(fields[1:], " ")
+		rules = append(rules, sudoRule{Principal: fields[0], Spec: spec, NoPasswd: strings.Contains(spec, "NOPASSWD:")})
+	}
+	return rules
+}
+
+// accountSource is an account database of the final filesystem and the
+// history entry whose layer provides it.
+type accountSource struct {
+	path    string
+	history int
+	file    *accountFile
+}
+
+// imageAccounts returns the account databases of the final filesystem fs,
+// sorted by path.
+func (s *scan) imageAccounts(fs map[string]MergedFile) []accountSource {
+	var sources []accountSource
+	for p, f := range fs {
+		if accountFileType(p) == "" {
+			continue
+		}
+		if file, ok := s.accounts[s.report.History[f.History].LayerID][p]; ok {
+			sources = append(sources, accountSource{path: p, history: f.History, file: file})
+		}
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].path < sources[j].path })
+	return sources
+}
+
+// imageUsers returns the users and groups of the final filesystem fs, nil
+// when it has no etc/passwd.
+func (s *scan) imageUsers(fs map[string]MergedFile) ([]passwdEntry, []groupEntry) {
+	var users []passwdEntry
+	var groups []groupEntry
+	for _, src := range s.imageAccounts(fs) {
+		switch src.path {
+		case "etc/passwd":
+			users = src.file.Users
+		case "etc/group":
+			groups = src.file.Groups
+		}
+	}
+	return users, groups
+}
+
+// resolveUser resolves the user of the image configuration, given as a name
+// or UID optionally followed by a group name or GID, against users and
+// groups.
+func resolveUser(user string, users []passwdEntry, groups []groupEntry) ImageUser {
+	u := ImageUser{Configured: user, Resolved: true}
+	name, group, hasGroup := strings.Cut(user, ":")
+	if name == "" {
+		name = "0"
+	}
+	uid, err := strconv.Atoi(name)
+	numeric := err == nil
+	u.UID = uid
+	found := false
+	for _, e := range users {
+		if (numeric && e.UID == uid) || (!numeric && e.Name == name) {
+			u.Name, u.UID, u.GID, u.Home, u.Shell = e.Name, e.UID, e.GID, e.Home, e.Shell
+			found = true
+			break
+		}
+	}
+	if !found && !numeric {
+		u.Resolved = false
+		return u
+	}
+	if hasGroup {
+		if gid, err := strconv.Atoi(group); err == nil {
+			u.GID = gid
+		} else if i := slices.IndexFunc(groups, func(g groupEntry) bool { return g.Name == group }); i >= 0 {
+			u.GID = groups[i].GID
+		} else {
+			u.Resolved = false
+			return u
+		}
+	}
+	if u.Name != "" {
+		for _, g := range groups {
+			if g.GID != u.GID && slices.Contains(g.Members, u.Name) {
+				u.Groups = append(u.Groups, g.Name)
+			}
+		}
+	}
+	return u
+}
+
+// checkAccounts resolves the user of the image and inspects the account
+// databases of the final filesystem fs for users without a password or with
+// a weak one, users other than root with UID 0 and passwordless sudo rules.
+func (s *scan) checkAccounts(fs map[string]MergedFile) *Accounts {
+	users, groups := s.imageUsers(fs)
+	accounts := &Accounts{User: resolveUser(s.report.Metadata.User, users, groups)}
+	add := func(src accountSource, kind, user, detail string) {
+		h := s.report.History[src.history]
+		accounts.Issues = append(accounts.Issues, AccountIssue{
+			Kind:        kind,
+			User:        user,
+			Path:        src.path,
+			Layer:       h.LayerID,
+			Instruction: h.Instruction(),
+			Detail:      detail,
+		})
+	}
+	checkHash := func(src accountSource, user, hash string) {
+		if kind, detail, password := checkPassword(user, hash); kind != "" {
+			add(src, kind, user, detail)
+			accounts.Issues[len(accounts.Issues)-1].Password = password
+		}
+	}
+	sources := s.imageAccounts(fs)
+	for _, src := range sources {
+		for _, u := range src.file.Users {
+			if u.UID == 0 && u.Name != "root" {
+				add(src, AccountExtraRoot, u.Name, "has UID 0")
+			}
+			// x points to etc/shadow, * and ! lock the account
+			if u.Password != "x" {
+				checkHash(src, u.Name, u.Password)
+			}
+		}
+		for _, e := range src.file.Shadow {
+			checkHash(src, e.Name, e.Hash)
+		}
+		for _, r := range src.file.Sudo {
+			if r.NoPasswd {
+				add(src, AccountNoPasswdSudo, r.Principal, r.Spec)
+			}
+		}
+	}
+	if !accounts.User.Resolved {
+		src := accountSource{path: "etc/passwd", history: len(s.report.History) - 1}
+		for _, e := range sources {
+			if e.path == src.path {
+				src = e
+			}
+		}
+		if len(s.report.History) > 0 {
+			add(src, AccountUnknownUser, s.report.Metadata.User, "the image does not define this user or group, docker refuses to start it")
+		}
+	}
+	return accounts
+}
+
+// commonPasswords are tried against the password hashes of the image, along
+// with the name of each user.
+var commonPasswords = []string{
+	"password", "123456", "12345678", "root", "toor", "admin", "changeme",
+	"letmein", "qwerty", "secret", "docker", "test",
+}
+
+// checkPassword returns the kind of issue with the password hash of user,
+// an explanation and the password when it guessed it, or "" when the hash
+// is locked or strong.
+func checkPassword(user, hash string) (kind, detail, password string) {
+	if hash == "" {
+		return AccountEmptyPassword, "logging in needs no password", ""
+	}
+	if strings.HasPrefix(hash, "!") || strings.HasPrefix(hash, "*") || hash == "x" {
+		return "", "", ""
+	}
+	for _, p := range append([]string{user}, commonPasswords...) {
+		if crypted, ok := crypt(p, hash); ok && crypted == hash {
+			if p == user {
+				return AccountWeakPassword, "the password is the user name", p
+			}
+			return AccountWeakPassword, fmt.Sprintf("the password is %q", p), p
+		}
+	}
+	switch algo := hashAlgorithm(hash); algo {
+	case "des", "md5":
+		return AccountWeakHash, fmt.Sprintf("the password is hashed with %s, which is fast to crack", algo), ""
+	}
+	return "", "", ""
+}
+
+// hashAlgorithm names the algorithm of a crypt(3) hash.
+func hashAlgorithm(hash string) string {
+	if !strings.HasPrefix(hash, "$") {
+		if len(hash) == 13 {
+			return "des"
+		}
+		return "unknown"
+	}
+	id, _, _ := strings.Cut(hash[1:], "$")
+	switch id {
+	case "1":
+		return "md5"
+	case "2a", "2b", "2y":
+		return "bcrypt"
+	case "5":
+		return "sha256"
+	case "6":
+		return "sha512"
+	case "y":
+		return "yescrypt"
+	case "gy":
+		return "gost-yescrypt"
+	case "7":
+		return "scrypt"
+	}
+	return "unknown"
+}
@@ -0,0 +1,150 @@
+package analyzer
+
+import (
+	"archive/tar"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccounts(t *testing.T) {
+	const md5Password = "$1$abcdefgh$95Ln1bIcdEd.Z5AMdM0dV."
+	config := `{
+		"config": {"User": "app:staff"},
+		"history": [
+			{"created_by": "/bin/sh -c #(nop) ADD file:abc in / "},
+			{"created_by": "/bin/sh -c useradd app && echo 'app ALL=(ALL) NOPASSWD: ALL' > /etc/sudoers.d/app"},
+			{"created_by": "/bin/sh -c rm /etc/sudoers.d/old"}
+		]
+	}`
+	data := dockerArchive(t, config,
+		[]testEntry{
+			{hdr: tar.Header{Name: "etc/passwd"}, body: "root:x:0:0:root:/root:/bin/sh\n"},
+			{hdr: tar.Header{Name: "etc/shadow"}, body: "root:*:19000:0:99999:7:::\n"},
+			{hdr: tar.Header{Name: "etc/sudoers"}, body: "Defaults env_reset\nroot ALL=(ALL:ALL) ALL\n#includedir /etc/sudoers.d\n"},
+			{hdr: tar.Header{Name: "etc/sudoers.d/old"}, body: "old ALL=NOPASSWD: ALL\n"},
+		},
+		[]testEntry{
+			{hdr: tar.Header{Name: "etc/passwd"}, body: "root:x:0:0:root:/root:/bin/sh\napp:x:1000:1000::/app:/bin/sh\ntoor:x:0:0::/root:/bin/sh\nguest::1001:1001::/:/bin/sh\n"},
+			{hdr: tar.Header{Name: "etc/group"}, body: "root:x:0:\nstaff:x:50:\nwheel:x:10:app,root\napp:x:1000:\n"},
+			{hdr: tar.Header{Name: "etc/shadow"}, body: "root:" + md5Password + ":19000::::::\napp:!:19000::::::\ntoor:$6$saltstring$hWds/4XPpAsysnYn0XfmQdS0RAhsm9XE1N89qYKToFP8eDoThGKMikxoKDxILTPPHvGbJ1z4tJHPEpAWjqEeU.:19000::::::\n"},
+			{hdr: tar.Header{Name: "etc/sudoers.d/app"}, body: "app ALL=(ALL) \\\n  NOPASSWD: ALL\n"},
+			{hdr: tar.Header{Name: "etc/sudoers.d/app.dpkg-old"}, body: "app ALL=NOPASSWD: ALL\n"},
+		},
+		[]testEntry{
+			{hdr: tar.Header{Name: "etc/sudoers.d/.wh.old"}},
+		},
+	)
+
+	a := newTestAnalyzer(t, Options{})
+	report, err := a.Analyze(context.Background(), &memorySource{name: "accounts", data: data})
+	if !assert.NoError(t, err) || !assert.NotNil(t, report.Accounts) {
+		return
+	}
+	assert.Equal(t, ImageUser{
+		Configured: "app:staff", Resolved: true, Name: "app", UID: 1000, GID: 50,
+		Groups: []string{"wheel"}, Home: "/app", Shell: "/bin/sh",
+	}, report.Accounts.User)
+
+	type issue struct{ kind, user, path, detail string }
+	var issues []issue
+	for _, i := range report.Accounts.Issues {
+		issues = append(issues, issue{i.Kind, i.User, i.Path, i.Detail})
+		assert.Equal(t, "layer1/layer.tar", i.Layer)
+	}
+	assert.Equal(t, []issue{
+		{AccountExtraRoot, "toor", "etc/passwd", "has UID 0"},
+		{AccountEmptyPassword, "guest", "etc/passwd", "logging in needs no password"},
+		{AccountWeakHash, "root", "etc/shadow", "the password is hashed with md5, which is fast to crack"},
+		{AccountWeakPassword, "toor", "etc/shadow", "the password is the user name"},
+		{AccountNoPasswdSudo, "app", "etc/sudoers.d/app", "ALL=(ALL) NOPASSWD: ALL"},
+	}, issues, "the deleted sudoers.d/old and the dpkg backup are skipped")
+}
+
+func TestAccountsUnknownUser(t *testing.T) {
+	data := dockerArchive(t, `{"config": {"User": "ghost"}, "history": [{"created_by": "COPY . /"}]}`, []testEntry{
+		{hdr: tar.Header{Name: "etc/passwd"}, body: "root:x:0:0:root:/root:/bin/sh\n"},
+	})
+	report, err := newTestAnalyzer(t, Options{}).Analyze(context.Background(), &memorySource{name: "ghost", data: data})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.False(t, report.Accounts.User.Resolved)
+	if assert.Len(t, report.Accounts.Issues, 1) {
+		assert.Equal(t, AccountUnknownUser, report.Accounts.Issues[0].Kind)
+		assert.Equal(t, "ghost", report.Accounts.Issues[0].User)
+		assert.Equal(t, "COPY . /", report.Accounts.Issues[0].Instruction)
+	}
+}
+
+func TestResolveUser(t *testing.T) {
+	users := parsePasswd([]byte("root:x:0:0:root:/root:/bin/sh\n# comment\nbroken\napp:x:1000:1001::/app:/sbin/nologin\n"))
+	assert.Equal(t, []passwdEntry{
+		{Name: "root", Password: "x", UID: 0, GID: 0, Home: "/root", Shell: "/bin/sh"},
+		{Name: "app", Password: "x", UID: 1000, GID: 1001, Home: "/app", Shell: "/sbin/nologin"},
+	}, users)
+	groups := parseGroup([]byte("root:x:0:\nadm:x:4:app\ndocker:x:999:app,root\n"))
+
+	for _, tc := range []struct {
+		user     string
+		uid, gid int
+		ok       bool
+		groups   []string
+	}{
+		{"", 0, 0, true, []string{"docker"}},
+		{"app", 1000, 1001, true, []string{"adm", "docker"}},
+		{"1000", 1000, 1001, true, []string{"adm", "docker"}},
+		{"app:50", 1000, 50, true, []string{"adm", "docker"}},
+		{"app:adm", 1000, 4, true, []string{"docker"}},
+		{"app:wheel", 1000, 1001, false, nil},
+		{"4242", 4242, 0, true, nil},
+		{"ghost", 0, 0, false, nil},
+	} {
+		u := resolveUser(tc.user, users, groups)
+		assert.Equal(t, []interface{}{tc.uid, tc.gid, tc.ok, tc.groups}, []interface{}{u.UID, u.GID, u.Resolved, u.Groups}, tc.user)
+	}
+}
+
+func TestParseSudoers(t *testing.T) {
+	rules := parseSudoers([]byte(`# User privilege specification
+Defaults	secure_path="/usr/sbin:/usr/bin"
+Defaults:deploy !requiretty
+Cmnd_Alias RESTART = /bin/systemctl restart app
+@includedir /etc/sudoers.d
+root	ALL=(ALL:ALL) ALL
+%sudo	ALL=(ALL:ALL) NOPASSWD: ALL
+deploy ALL = (root) RESTART, \
+	NOPASSWD: /usr/bin/apt-get update
+`))
+	assert.Equal(t, []sudoRule{
+		{Principal: "root", Spec: "ALL=(ALL:ALL) ALL"},
+		{Principal: "%sudo", Spec: "ALL=(ALL:ALL) NOPASSWD: ALL", NoPasswd: true},
+		{Principal: "deploy", Spec: "ALL = (root) RESTART, NOPASSWD: /usr/bin/apt-get update", NoPasswd: true},
+	}, rules)
+}
+
+func TestCrypt(t *testing.T) {
+	for _, hash := range []string{
+		// openssl passwd -1 -salt xxxxxxxx password
+		"$1$xxxxxxxx$UYCIxa628.9qXjpQCjM4a.",
+		// The test vectors of the SHA-crypt specification
+		"$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5",
+		"$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1",
+		"$5$rounds=10000$saltstringsaltst$3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA",
+		"$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.",
+	} {
+		password := "Hello world!"
+		if hash[1] == '1' {
+			password = "password"
+		}
+		got, ok := crypt(password, hash)
+		assert.True(t, ok, hash)
+		assert.Equal(t, hash, got)
+	}
+	_, ok := crypt("password", "$y$j9T$salt$hash")
+	assert.False(t, ok, "yescrypt is not implemented")
+	_, ok = crypt("password", "$6$rounds=999999999$salt$hash")
+	assert.False(t, ok, "too many rounds")
+	assert.Equal(t, "des", hashAlgorithm("abJnggxhB/yWI"))
+}
@@ -0,0 +1,177 @@
+// Package analyzer reverses docker images back into their Dockerfile and
+// looks for secrets left behind in their layers.
+package analyzer
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"whaler/vulndb"
+)
+
+// Options configures an Analyzer.
+type Options struct {
+	// Verbose also extracts the base image layer.
+	Verbose bool
+	// IgnorePatterns replaces the built-in noise filter when set.
+	IgnorePatterns []string
+	// Advisories, when set, are matched against the packages of the image.
+	Advisories *vulndb.DB
+	// Policy, when set, is evaluated against every report.
+	Policy *Policy
+	// Entropy, when set, enables the detector for high entropy strings in
+	// text files, environment variables, labels and history.
+	Entropy *EntropyOptions
+	// ArchiveDepth limits the recursion into archives found in layers, such
+	// as JARs nested in a WAR. Zero means DefaultArchiveDepth and a negative
+	// value opens no archives.
+	ArchiveDepth int
+	// MaxArchiveSize is the size of the largest archive opened, and of the
+	// largest entry read from one. Zero means DefaultMaxArchiveSize.
+	MaxArchiveSize int64
+	// Baseline, when set, hides the known findings it lists from reports.
+	Baseline *Baseline
+	// LayerCache, when set, stores what scanning each layer found and reuses
+	// it for the layers scanned before.
+	LayerCache *LayerCache
+	// Redact masks secret values in the returned reports, see Redact.
+	Redact bool
+}
+
+// Analyzer inspects images. It holds no per-image state and can be reused.
+type Analyzer struct {
+	opts     Options
+	ignore   *regexp.Regexp
+	patterns []Pattern
+	// namespace names the entries of the layer cache usable by the analyzer
+	namespace string
+}
+
+// New compiles the ignore list and secret patterns for opts.
+func New(opts Options) (*Analyzer, error) {
+	ignoreList := opts.IgnorePatterns
+	if len(ignoreList) == 0 {
+		ignoreList = internalWordlist
+	}
+	ignore, err := regexp.Compile(strings.Join(ignoreList, "|"))
+	if err != nil {
+		return nil, err
+	}
+	patterns, err := compileSecretPatterns()
+	if err != nil {
+		return nil, err
+	}
+	a := &Analyzer{opts: opts, ignore: ignore, patterns: patterns}
+	a.namespace = a.CacheNamespace()
+	return a, nil
+}
+
+// scan holds the state of a single Analyze call.
+type scan struct {
+	a      *Analyzer
+	report *Report
+	layers map[string][]File
+	// digests maps layer names to the sha256 of their uncompressed tar
+	digests map[string]string
+	// sizes maps layer names to the size of their tar
+	sizes map[string]layerSize
+	// packageDBs holds the package databases found in each layer
+	packageDBs map[string][]packageDB
+	// dependencies holds the language dependency manifests found in each layer
+	dependencies map[string][]packageDB
+	// osReleases holds the os-release file found in each layer
+	osReleases map[string]*OSRelease
+	// accounts holds the account databases found in each layer by path
+	accounts map[string]map[string]*accountFile
+	// gitDirs holds the files of the .git directories of the layer being
+	// read, by directory and path in the directory
+	gitDirs map[string]map[string]map[string][]byte
+	// checkedNames is set once a file name was checked for secrets
+	checkedNames bool
+}
+
+// Analyze reads the image behind source and reconstructs its history. It
+// prints nothing; use a renderer to present the returned Report.
+func (a *Analyzer) Analyze(ctx context.Context, source Source) (*Report, error) {
+	s, err := a.scanImage(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	return s.finish(), nil
+}
+
+// scanImage reads the layers and configuration of the image behind source.
+func (a *Analyzer) scanImage(ctx context.Context, source Source) (*scan, error) {
+	report := &Report{Image: source.Name(), Findings: []Finding{}}
+	s := &scan{
+		a:            a,
+		report:       report,
+		layers:       make(map[string][]File),
+		digests:      make(map[string]string),
+		sizes:        make(map[string]layerSize),
+		packageDBs:   make(map[string][]packageDB),
+		dependencies: make(map[string][]packageDB),
+		osReleases:   make(map[string]*OSRelease),
+		accounts:     make(map[string]map[string]*accountFile),
+		gitDirs:      make(map[string]map[string]map[string][]byte),
+	}
+
+	inspector, hasMetadata := source.(Inspector)
+	if hasMetadata {
+		md, err := inspector.Inspect(ctx)
+		if err != nil {
+			return nil, err
+		}
+		report.Metadata = md
+	}
+
+	imageStream, err := source.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	history, cfg, format, err := s.analyzeImage(imageStream)
+	if err != nil {
+		return nil, err
+	}
+	report.Format = format
+	report.History = history
+	if !hasMetadata && cfg != nil {
+		id := report.Metadata.ID
+		report.Metadata = cfg.metadata()
+		report.Metadata.ID = id
+	}
+	return s, nil
+}
+
+// finish runs the checks spanning the whole image once every layer is read
+// and returns the report.
+func (s *scan) finish() *Report {
+	a, report := s.a, s.report
+	report.Efficiency = report.measureEfficiency()
+	fs := report.Filesystem()
+	report.Hardening = s.checkHardening(fs)
+	report.Accounts = s.checkAccounts(fs)
+	s.pairKeys()
+	s.scanConfig()
+	if !s.checkedNames {
+		report.WarningsBeforeFindings = len(report.Warnings)
+	}
+	for i := range report.Findings {
+		report.Findings[i].Fingerprint = Fingerprint(report.Findings[i])
+	}
+	if a.opts.Baseline != nil {
+		a.opts.Baseline.Apply(report, time.Now())
+	}
+	if a.opts.Advisories != nil {
+		report.Vulnerabilities = matchVulnerabilities(a.opts.Advisories, report)
+	}
+	if a.opts.Policy != nil {
+		report.Policy = a.opts.Policy.Evaluate(report)
+	}
+	if a.opts.Redact {
+		report = Redact(report)
+	}
+	return report
+}
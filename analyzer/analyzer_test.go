@@ -0,0 +1,399 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"archive/tar"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/stretchr/testify/assert"
+)
+
+// MockDockerClient implements a basic mock of the Docker client
+type MockDockerClient struct {
+	*client.Client
+	imageInspectFunc func(ctx context.Context, imageID string) (image.InspectResponse, []byte, error)
+	imageSaveFunc    func(ctx context.Context, imageIDs []string) (io.ReadCloser, error)
+
+	containerInspectFunc func(ctx context.Context, containerID string) (container.InspectResponse, error)
+	containerDiffFunc    func(ctx context.Context, containerID string) ([]container.FilesystemChange, error)
+	containerExportFunc  func(ctx context.Context, containerID string) (io.ReadCloser, error)
+}
+
+func (m *MockDockerClient) ImageInspectWithRaw(ctx context.Context, imageID string) (image.InspectResponse, []byte, error) {
+	if m.imageInspectFunc != nil {
+		return m.imageInspectFunc(ctx, imageID)
+	}
+	return image.InspectResponse{}, nil, nil
+}
+
+func (m *MockDockerClient) ImageSave(ctx context.Context, imageIDs []string, options ...client.ImageSaveOption) (io.ReadCloser, error) {
+	if m.imageSaveFunc != nil {
+		return m.imageSaveFunc(ctx, imageIDs)
+	}
+	return nil, nil
+}
+
+func (m *MockDockerClient) ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error) {
+	if m.containerInspectFunc != nil {
+		return m.containerInspectFunc(ctx, containerID)
+	}
+	return container.InspectResponse{}, nil
+}
+
+func (m *MockDockerClient) ContainerDiff(ctx context.Context, containerID string) ([]container.FilesystemChange, error) {
+	if m.containerDiffFunc != nil {
+		return m.containerDiffFunc(ctx, containerID)
+	}
+	return nil, nil
+}
+
+func (m *MockDockerClient) ContainerExport(ctx context.Context, containerID string) (io.ReadCloser, error) {
+	if m.containerExportFunc != nil {
+		return m.containerExportFunc(ctx, containerID)
+	}
+	return nil, nil
+}
+
+func (m *MockDockerClient) Close() error {
+	return nil
+}
+
+func TestCleanString(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Basic RUN command",
+			input:    "/bin/sh -c echo 'hello'",
+			expected: "RUN echo 'hello'",
+		},
+		{
+			name:     "NOP command",
+			input:    "/bin/sh -c #(nop) ADD file:123 /app",
+			expected: "ADD file:123 /app",
+		},
+		{
+			name:     "Command with &&",
+			input:    "cd /app && npm install",
+			expected: "cd /app \\\n\t&& npm install",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := cleanString(tt.input)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func newTestAnalyzer(t *testing.T, opts Options) *Analyzer {
+	t.Helper()
+	a, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestExtractImageLayers(t *testing.T) {
+	// Create a temporary directory for test files
+	tmpDir := t.TempDir()
+
+	// Create a mock Docker client
+	mockClient := &MockDockerClient{
+		Client: &client.Client{},
+		imageSaveFunc: func(ctx context.Context, imageIDs []string) (io.ReadCloser, error) {
+			// Create a tar file in memory with our test data
+			pr, pw := io.Pipe()
+			go func() {
+				tw := tar.NewWriter(pw)
+
+				// Write a layer file
+				layerContent := "test layer content"
+				header := &tar.Header{
+					Name: "layer1/test.txt",
+					Size: int64(len(layerContent)),
+					Mode: 0600,
+				}
+				tw.WriteHeader(header)
+				tw.Write([]byte(layerContent))
+
+				tw.Close()
+				pw.Close()
+			}()
+			return pr, nil
+		},
+	}
+
+	// Test the ExtractLayers function
+	a := newTestAnalyzer(t, Options{})
+	err := a.ExtractLayers(context.Background(), &DockerImage{Client: mockClient, Ref: "test-image"}, &Report{
+		Image: "test-image",
+		History: []History{
+			{
+				CreatedBy:  "ADD file:123 /app",
+				LayerID:    "layer1",
+				EmptyLayer: false,
+			},
+		},
+	}, tmpDir)
+
+	if err != nil {
+		t.Errorf("ExtractLayers failed: %v", err)
+	}
+
+	// Verify that the output directory was created
+	outputDir := filepath.Join(tmpDir, "test-image")
+	if _, err := os.Stat(outputDir); os.IsNotExist(err) {
+		t.Error("Output directory was not created")
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	data := dockerArchive(t, `{"history": [{"created_by": "COPY . /app"}]}`, []testEntry{
+		{hdr: tar.Header{Name: "app/", Typeflag: tar.TypeDir}},
+		{hdr: tar.Header{Name: "./app/config.yml"}, body: "debug: true\n"},
+	})
+	source := &memorySource{name: "example.com/app:1", data: data}
+	a := newTestAnalyzer(t, Options{})
+
+	content, err := a.ReadFile(context.Background(), source, "layer0/layer.tar", "app/config.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, "debug: true\n", string(content))
+
+	_, err = a.ReadFile(context.Background(), source, "layer0/layer.tar", "app")
+	assert.ErrorContains(t, err, "not a regular file")
+	_, err = a.ReadFile(context.Background(), source, "layer0/layer.tar", "missing")
+	assert.ErrorContains(t, err, "missing not found")
+	_, err = a.ReadFile(context.Background(), source, "layer9/layer.tar", "app/config.yml")
+	assert.ErrorContains(t, err, "layer layer9/layer.tar not found")
+
+	dir := t.TempDir()
+	out, err := a.DumpFile(context.Background(), source, &Report{Image: source.name}, "layer0/layer.tar", "./app/config.yml", dir)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "example.com%2Fapp%3A1", "layer0", "app", "config.yml"), out)
+	written, _ := os.ReadFile(out)
+	assert.Equal(t, "debug: true\n", string(written))
+}
+
+func TestAnalyzeImageFilesystem(t *testing.T) {
+	// Create test data
+	testData := `{
+		"history": [
+			{
+				"created": "2024-03-13T00:00:00Z",
+				"created_by": "ADD file:123 /app",
+				"empty_layer": false
+			}
+		]
+	}`
+
+	mockClient := &MockDockerClient{
+		Client: &client.Client{},
+		imageSaveFunc: func(ctx context.Context, imageIDs []string) (io.ReadCloser, error) {
+			// Create a tar file in memory with our test data
+			pr, pw := io.Pipe()
+			go func() {
+				tw := tar.NewWriter(pw)
+
+				// Write the config file
+				header := &tar.Header{
+					Name: "test.json",
+					Size: int64(len(testData)),
+					Mode: 0600,
+				}
+				tw.WriteHeader(header)
+				tw.Write([]byte(testData))
+
+				// Write the manifest file with a layer
+				manifest := `[{"Config":"test.json","RepoTags":["test-image:latest"],"Layers":["layer1.tar"]}]`
+				header = &tar.Header{
+					Name: "manifest.json",
+					Size: int64(len(manifest)),
+					Mode: 0600,
+				}
+				tw.WriteHeader(header)
+				tw.Write([]byte(manifest))
+
+				// Write a layer file
+				layerContent := "test layer content"
+				header = &tar.Header{
+					Name: "layer1.tar",
+					Size: int64(len(layerContent)),
+					Mode: 0600,
+				}
+				tw.WriteHeader(header)
+				tw.Write([]byte(layerContent))
+
+				tw.Close()
+				pw.Close()
+			}()
+			return pr, nil
+		},
+	}
+
+	a := newTestAnalyzer(t, Options{})
+	report, err := a.Analyze(context.Background(), &DockerImage{Client: mockClient, Ref: "test-image"})
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	assert.Equal(t, FormatDocker, report.Format)
+	assert.Len(t, report.History, 1)
+	assert.Equal(t, "layer1.tar", report.History[0].LayerID)
+}
+
+func TestAnalyzeTarFile(t *testing.T) {
+	a := newTestAnalyzer(t, Options{})
+	report, err := a.Analyze(context.Background(), &TarFile{Path: filepath.Join("testdata", "test-image.tar")})
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	assert.Equal(t, "test-image", report.Image)
+	assert.Equal(t, FormatOCI, report.Format)
+	assert.Equal(t, []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"}, report.Metadata.Env)
+	assert.Equal(t, MetadataConfig, report.Metadata.Source)
+	// Blobs are listed before their files are checked, history is looked
+	// for after
+	assert.Equal(t, 1, report.WarningsBeforeFindings)
+	assert.Equal(t, "Looking for history in OCI config files...", report.Warnings[1])
+	if assert.Len(t, report.History, 2) {
+		assert.Equal(t, "c9c5fd25a1bdc181cb012bc4fbb1ab272a975728f54064b7ae3ee8e77fd28c46", report.History[0].LayerID)
+		// The diff ID recorded in the image config
+		assert.Equal(t, "sha256:98a92b28c9b8d3cd4353801cba6ad181e86aaa616221e14739210acbda35b7fd", report.History[0].Digest)
+		if assert.Len(t, report.History[0].Files, 1) {
+			assert.Equal(t, "hello", report.History[0].Files[0].Path)
+		}
+		assert.Equal(t, `CMD ["/hello"]`, report.History[1].Instruction())
+	}
+}
+
+// memorySource serves an image tarball built in memory
+type memorySource struct {
+	name string
+	data []byte
+}
+
+func (m *memorySource) Name() string { return m.name }
+
+func (m *memorySource) Open(ctx context.Context) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(m.data)), nil
+}
+
+type testEntry struct {
+	hdr  tar.Header
+	body string
+}
+
+func writeTar(t *testing.T, entries []testEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := e.hdr
+		if hdr.Typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(e.body))
+		}
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// dockerArchive builds a docker save tarball with one layer per entry of
+// layers, mapped in order onto the non-empty entries of config's history.
+func dockerArchive(t *testing.T, config string, layers ...[]testEntry) []byte {
+	t.Helper()
+	var names []string
+	entries := []testEntry{{hdr: tar.Header{Name: "config.json"}, body: config}}
+	for i, layer := range layers {
+		name := fmt.Sprintf("layer%d/layer.tar", i)
+		names = append(names, name)
+		entries = append(entries, testEntry{hdr: tar.Header{Name: name}, body: string(writeTar(t, layer))})
+	}
+	manifest, _ := json.Marshal([]map[string]interface{}{{"Config": "config.json", "Layers": names}})
+	entries = append(entries, testEntry{hdr: tar.Header{Name: "manifest.json"}, body: string(manifest)})
+	return writeTar(t, entries)
+}
+
+func TestAnalyzeFindings(t *testing.T) {
+	config := `{
+		"config": {"User": "app"},
+		"history": [
+			{"created_by": "/bin/sh -c #(nop) ADD file:abc in / "},
+			{"created_by": "COPY dir:123 in /app"}
+		]
+	}`
+	data := dockerArchive(t, config,
+		[]testEntry{{hdr: tar.Header{Name: "etc/passwd"}}},
+		[]testEntry{
+			{hdr: tar.Header{Name: "app/.ssh/id_rsa"}, body: "key"},
+			{hdr: tar.Header{Name: "app/node_modules/id_rsa"}},
+		},
+	)
+
+	a := newTestAnalyzer(t, Options{})
+	report, err := a.Analyze(context.Background(), &memorySource{name: "findings", data: data})
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	assert.Equal(t, "app", report.Metadata.User)
+	if assert.Len(t, report.Findings, 1) {
+		assert.Equal(t, "app/.ssh/id_rsa", report.Findings[0].Path)
+		assert.Equal(t, "layer1/layer.tar", report.Findings[0].Layer)
+	}
+	if assert.Len(t, report.History, 2) {
+		files := report.History[1].Files
+		if assert.Len(t, files, 2) {
+			assert.Equal(t, "app/.ssh/id_rsa", files[0].Path)
+			assert.Equal(t, int64(3), files[0].Size)
+			assert.False(t, files[0].Noise)
+			assert.True(t, files[1].Noise)
+		}
+		assert.Regexp(t, "^sha256:[0-9a-f]{64}$", report.History[1].Digest)
+		assert.NotEqual(t, report.History[0].Digest, report.History[1].Digest)
+	}
+}
+
+func TestImageDigest(t *testing.T) {
+	a := newTestAnalyzer(t, Options{})
+	for _, source := range []Source{
+		&TarFile{Path: filepath.Join("testdata", "test-image.tar")},
+		&memorySource{name: "docker", data: dockerArchive(t, `{"history": [{"created_by": "COPY . /app"}]}`, []testEntry{{hdr: tar.Header{Name: "app"}}})},
+	} {
+		digest, err := ImageDigest(context.Background(), source)
+		assert.NoError(t, err)
+		report, err := a.Analyze(context.Background(), source)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, digest)
+		assert.Equal(t, report.Metadata.ID, digest, source.Name())
+	}
+
+	_, err := ImageDigest(context.Background(), &memorySource{name: "empty", data: writeTar(t, nil)})
+	assert.Error(t, err)
+}
@@ -0,0 +1,196 @@
+package analyzer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Limits of the recursion into archives found in layers
+const (
+	DefaultArchiveDepth   = 3
+	DefaultMaxArchiveSize = 64 << 20
+)
+
+// archiveSeparator joins the path of an archive and the name of one of its
+// entries, as in app/lib/foo.jar!/config/application.properties.
+const archiveSeparator = "!/"
+
+var archiveName = regexp.MustCompile(`(?i)\.(zip|jar|war|ear|whl|egg|nupkg|tar|tgz|tar\.gz|gz)$`)
+
+// archiveDepth returns how many levels of nested archives are opened.
+func (a *Analyzer) archiveDepth() int {
+	if a.opts.ArchiveDepth == 0 {
+		return DefaultArchiveDepth
+	}
+	return max(a.opts.ArchiveDepth, 0)
+}
+
+func (a *Analyzer) maxArchiveSize() int64 {
+	if a.opts.MaxArchiveSize == 0 {
+		return DefaultMaxArchiveSize
+	}
+	return a.opts.MaxArchiveSize
+}
+
+// isArchive reports whether the file of hdr is an archive to open at the
+// given depth, 1 for archives in layers.
+func (a *Analyzer) isArchive(name string, hdr *tar.Header, depth int) bool {
+	return depth <= a.archiveDepth() && hdr.Typeflag == tar.TypeReg && hdr.Size <= a.maxArchiveSize() &&
+		archiveName.MatchString(name) && !a.ignored(name)
+}
+
+// archiveEntry is a regular file of an archive.
+type archiveEntry struct {
+	hdr     *tar.Header
+	content io.Reader
+}
+
+// scanArchive scans the entries of the archive at name like layer files:
+// their names, keys and certificates, contents against the validated
+// content patterns and the entropy detector when it is on, and the archives
+// they hold until the depth limit. Entries are not listed as files of the
+// layer.
+func (s *scan) scanArchive(layerName, name string, data []byte, depth int) {
+	err := s.a.archiveEntries(data, name, func(e archiveEntry) {
+		entry := name + archiveSeparator + strings.TrimLeft(path.Clean("/"+e.hdr.Name), "/")
+		if s.a.ignored(entry) {
+			return
+		}
+		content := e.content
+		if s.a.isArchive(entry, e.hdr, depth+1) {
+			nested, err := io.ReadAll(content)
+			if err != nil {
+				s.warn("%s: failed to read %s: %v", layerName, entry, err)
+				return
+			}
+			defer s.scanArchive(layerName, entry, nested, depth+1)
+			content = bytes.NewReader(nested)
+		}
+		if s.a.isKeyFile(entry) {
+			s.readKeyFile(layerName, entry, e.hdr.Size, content)
+		} else {
+			s.scanEntryContent(layerName, entry, e.hdr, content)
+		}
+		s.scanFilename(entry, layerName)
+	})
+	if err != nil {
+		s.warn("%s: failed to open %s: %v", layerName, name, err)
+	}
+}
+
+// scanEntryContent reports the secrets in the text of an archive entry
+// matching a content pattern with a validator, precise enough to run on
+// every entry, then the high entropy strings when the detector is on.
+func (s *scan) scanEntryContent(layerName, name string, hdr *tar.Header, content io.Reader) {
+	if hdr.Size > maxEntropyFileSize {
+		return
+	}
+	data, err := io.ReadAll(content)
+	if err != nil {
+		s.warn("%s: failed to read %s: %v", layerName, name, err)
+		return
+	}
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return
+	}
+	text := string(data)
+	seen := make(map[string]bool)
+	for _, p := range s.a.patterns {
+		if p.SecretType != "FileContent" || p.Validator == "" {
+			continue
+		}
+		for _, match := range p.Regex.FindAllString(text, -1) {
+			match = strings.TrimSpace(match)
+			if match == "" || seen[match] {
+				continue
+			}
+			seen[match] = true
+			s.report.Findings = append(s.report.Findings, Finding{
+				Type:        FindingFileContent,
+				Description: p.Description,
+				Pattern:     p.Value,
+				Path:        name,
+				Layer:       layerName,
+				Secret:      match,
+				Validation:  p.validate(match),
+			})
+		}
+	}
+	if s.a.opts.Entropy != nil {
+		s.scanContent(layerName, name, hdr, bytes.NewReader(data))
+	}
+}
+
+// archiveEntries calls fn for every regular file of a zip, tar or gzip
+// archive. A gzip file that holds no tar is a single entry named after it.
+func (a *Analyzer) archiveEntries(data []byte, name string, fn func(archiveEntry)) error {
+	limit := a.maxArchiveSize()
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) || bytes.HasPrefix(data, []byte("PK\x05\x06")) {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return err
+		}
+		for _, f := range zr.File {
+			if !f.Mode().IsRegular() || int64(f.UncompressedSize64) > limit {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			fn(archiveEntry{
+				hdr:     &tar.Header{Name: f.Name, Size: int64(f.UncompressedSize64), Mode: int64(f.Mode().Perm()), Typeflag: tar.TypeReg},
+				content: rc,
+			})
+			rc.Close()
+		}
+		return nil
+	}
+	if bytes.HasPrefix(data, []byte("\x1f\x8b")) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		// Bound what is inflated, a small gzip file can expand without limit
+		unzipped, err := io.ReadAll(io.LimitReader(zr, limit))
+		if err != nil {
+			return err
+		}
+		if !isTar(unzipped) {
+			base := strings.TrimSuffix(path.Base(name), path.Ext(name))
+			fn(archiveEntry{
+				hdr:     &tar.Header{Name: base, Size: int64(len(unzipped)), Typeflag: tar.TypeReg},
+				content: bytes.NewReader(unzipped),
+			})
+			return nil
+		}
+		data = unzipped
+	}
+	if !isTar(data) {
+		return nil
+	}
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			fn(archiveEntry{hdr: hdr, content: tr})
+		}
+	}
+}
+
+// isTar reports whether data starts with a ustar or GNU tar header.
+func isTar(data []byte) bool {
+	return len(data) > 262 && bytes.HasPrefix(data[257:], []byte("ustar"))
+}
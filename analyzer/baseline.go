@@ -0,0 +1,174 @@
+package analyzer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"time"
+)
+
+// DefaultBaselineFile is the name of the baseline file used by the command
+// line.
+const DefaultBaselineFile = "whaler-baseline.json"
+
+// baselineDateLayout is the layout of expiry dates in baseline files.
+const baselineDateLayout = "2006-01-02"
+
+// Fingerprint identifies a finding across runs and rebuilds. It hashes the
+// pattern, the path and the secret found, but not the layer, so the finding
+// keeps its fingerprint when the layers of an image change.
+func Fingerprint(f Finding) string {
+	secret := sha256.Sum256([]byte(f.Secret))
+	sum := sha256.Sum256([]byte(f.Pattern + "\x00" + f.Path + "\x00" + hex.EncodeToString(secret[:])))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Baseline lists known findings that are hidden from reports, usually
+// loaded from whaler-baseline.json:
+//
+//	{
+//	  "findings": [
+//	    {
+//	      "fingerprint": "9f2c...",
+//	      "path": "etc/ssl/private/test.key",
+//	      "description": "Private key",
+//	      "reason": "test fixture, not deployed",
+//	      "expires": "2026-12-31"
+//	    }
+//	  ]
+//	}
+type Baseline struct {
+	Findings []Suppression `json:"findings"`
+}
+
+// Suppression is a known finding of a baseline. Path and Description only
+// help readers of the file, findings are matched on Fingerprint.
+type Suppression struct {
+	Fingerprint string `json:"fingerprint"`
+	Path        string `json:"path,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Reason tells why the finding is accepted
+	Reason string `json:"reason,omitempty"`
+	// Expires is the last day the suppression applies, as YYYY-MM-DD. The
+	// finding is reported again afterwards.
+	Expires string `json:"expires,omitempty"`
+}
+
+// LoadBaseline reads and validates a baseline file.
+func LoadBaseline(name string) (*Baseline, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ParseBaseline(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return b, nil
+}
+
+// ParseBaseline parses and validates a JSON baseline.
+func ParseBaseline(data []byte) (*Baseline, error) {
+	var b Baseline
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for i, s := range b.Findings {
+		if s.Fingerprint == "" {
+			return nil, fmt.Errorf("finding %d has no fingerprint", i+1)
+		}
+		if seen[s.Fingerprint] {
+			return nil, fmt.Errorf("duplicate fingerprint %q", s.Fingerprint)
+		}
+		seen[s.Fingerprint] = true
+		if s.Expires != "" {
+			if _, err := time.Parse(baselineDateLayout, s.Expires); err != nil {
+				return nil, fmt.Errorf("finding %s: invalid expiry date %q, expected YYYY-MM-DD", s.Fingerprint, s.Expires)
+			}
+		}
+	}
+	return &b, nil
+}
+
+// Save writes the baseline to name, sorted by path so that updates make
+// small diffs.
+func (b *Baseline) Save(name string) error {
+	sort.SliceStable(b.Findings, func(i, j int) bool {
+		if b.Findings[i].Path != b.Findings[j].Path {
+			return b.Findings[i].Path < b.Findings[j].Path
+		}
+		return b.Findings[i].Fingerprint < b.Findings[j].Fingerprint
+	})
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, append(data, '\n'), 0644)
+}
+
+// expired reports whether the suppression no longer applies at now.
+func (s Suppression) expired(now time.Time) bool {
+	if s.Expires == "" {
+		return false
+	}
+	day, err := time.ParseInLocation(baselineDateLayout, s.Expires, now.Location())
+	return err == nil && !now.Before(day.AddDate(0, 0, 1))
+}
+
+// Apply moves the findings of report listed in the baseline to
+// report.Suppressed. Findings whose suppression has expired stay reported
+// with a warning.
+func (b *Baseline) Apply(report *Report, now time.Time) {
+	known := make(map[string]Suppression)
+	for _, s := range b.Findings {
+		known[s.Fingerprint] = s
+	}
+	findings := []Finding{}
+	warned := make(map[string]bool)
+	for _, f := range report.Findings {
+		s, ok := known[f.Fingerprint]
+		if !ok {
+			findings = append(findings, f)
+			continue
+		}
+		if s.expired(now) {
+			if !warned[s.Fingerprint] {
+				warned[s.Fingerprint] = true
+				report.Warnings = append(report.Warnings, fmt.Sprintf("baseline: suppression of %s in %s expired on %s", f.Description, f.Path, s.Expires))
+			}
+			findings = append(findings, f)
+			continue
+		}
+		report.Suppressed = append(report.Suppressed, f)
+	}
+	report.Findings = findings
+}
+
+// Update adds the findings of report, suppressed ones included, that the
+// baseline does not list yet. Existing entries keep their reason and expiry
+// date. It returns the number of findings added.
+func (b *Baseline) Update(report *Report) int {
+	known := make(map[string]bool)
+	for _, s := range b.Findings {
+		known[s.Fingerprint] = true
+	}
+	added := 0
+	for _, f := range slices.Concat(report.Findings, report.Suppressed) {
+		if known[f.Fingerprint] {
+			continue
+		}
+		known[f.Fingerprint] = true
+		b.Findings = append(b.Findings, Suppression{
+			Fingerprint: f.Fingerprint,
+			Path:        f.Path,
+			Description: f.Description,
+		})
+		added++
+	}
+	return added
+}
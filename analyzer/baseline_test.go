@@ -0,0 +1,99 @@
+package analyzer
+
+import (
+	"archive/tar"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fingerprinted sets the fingerprint of expected findings.
+func fingerprinted(findings []Finding) []Finding {
+	for i := range findings {
+		findings[i].Fingerprint = Fingerprint(findings[i])
+	}
+	return findings
+}
+
+func TestFingerprint(t *testing.T) {
+	f := Finding{Pattern: "id_rsa", Path: "root/.ssh/id_rsa", Layer: "layer0/layer.tar"}
+	moved := f
+	moved.Layer, moved.Instruction = "layer3/layer.tar", "COPY . /root"
+	assert.Equal(t, Fingerprint(f), Fingerprint(moved), "the layer is not part of the fingerprint")
+	assert.Len(t, Fingerprint(f), 32)
+
+	other := f
+	other.Path = "home/app/.ssh/id_rsa"
+	assert.NotEqual(t, Fingerprint(f), Fingerprint(other))
+	other = f
+	other.Secret = "changed"
+	assert.NotEqual(t, Fingerprint(f), Fingerprint(other))
+}
+
+func TestParseBaseline(t *testing.T) {
+	b, err := ParseBaseline([]byte(`{"findings": [{"fingerprint": "abc", "reason": "test key", "expires": "2026-12-31"}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []Suppression{{Fingerprint: "abc", Reason: "test key", Expires: "2026-12-31"}}, b.Findings)
+
+	for _, data := range []string{
+		`{"findings": [{"reason": "no fingerprint"}]}`,
+		`{"findings": [{"fingerprint": "abc"}, {"fingerprint": "abc"}]}`,
+		`{"findings": [{"fingerprint": "abc", "expires": "31/12/2026"}]}`,
+		`not json`,
+	} {
+		_, err := ParseBaseline([]byte(data))
+		assert.Error(t, err, data)
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	data := dockerArchive(t, `{"history": [{"created_by": "COPY . /app"}, {"created_by": "COPY keys /keys"}]}`,
+		[]testEntry{{hdr: tar.Header{Name: "app/terraform.tfvars"}, body: "x"}},
+		[]testEntry{{hdr: tar.Header{Name: "keys/deploy_rsa"}, body: "x"}},
+	)
+	analyze := func(b *Baseline) *Report {
+		report, err := newTestAnalyzer(t, Options{Baseline: b}).Analyze(context.Background(), &memorySource{name: "baseline", data: data})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+
+	report := analyze(nil)
+	if !assert.Len(t, report.Findings, 2) {
+		return
+	}
+	tfvars, key := report.Findings[0], report.Findings[1]
+
+	b := &Baseline{Findings: []Suppression{{Fingerprint: key.Fingerprint, Reason: "rotated"}}}
+	assert.Equal(t, 1, b.Update(report), "known findings are not added again")
+	assert.Equal(t, []Suppression{
+		{Fingerprint: key.Fingerprint, Reason: "rotated"},
+		{Fingerprint: tfvars.Fingerprint, Path: "app/terraform.tfvars", Description: tfvars.Description},
+	}, b.Findings)
+
+	name := filepath.Join(t.TempDir(), DefaultBaselineFile)
+	assert.NoError(t, b.Save(name))
+	loaded, err := LoadBaseline(name)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, b.Findings, loaded.Findings)
+
+	report = analyze(&Baseline{Findings: []Suppression{{Fingerprint: key.Fingerprint, Reason: "rotated"}}})
+	assert.Equal(t, []Finding{tfvars}, report.Findings)
+	assert.Equal(t, []Finding{key}, report.Suppressed)
+
+	// Expired suppressions stop hiding the finding
+	report = analyze(nil)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	(&Baseline{Findings: []Suppression{{Fingerprint: key.Fingerprint, Expires: "2026-02-28"}}}).Apply(report, now)
+	assert.Len(t, report.Findings, 2)
+	assert.Empty(t, report.Suppressed)
+	assert.Contains(t, report.Warnings, "baseline: suppression of "+key.Description+" in keys/deploy_rsa expired on 2026-02-28")
+
+	report = analyze(nil)
+	(&Baseline{Findings: []Suppression{{Fingerprint: key.Fingerprint, Expires: "2026-03-01"}}}).Apply(report, now)
+	assert.Equal(t, []Finding{key}, report.Suppressed, "suppressions apply until the end of their expiry day")
+}
@@ -0,0 +1,203 @@
+package analyzer
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Finding types for secrets outside of layer files
+const (
+	FindingEnv     = "Env"
+	FindingLabel   = "Label"
+	FindingHistory = "History"
+)
+
+// secretNameHeuristic is reported as the pattern of findings made on the
+// name of a variable rather than its value.
+const secretNameHeuristic = "name contains PASSWORD, TOKEN, SECRET or KEY"
+
+// secretNameParts are the name components that mark a variable as holding
+// a secret, and nonSecretNameParts those that mark it as pointing at one.
+var (
+	secretNameParts    = []string{"PASSWORD", "PASSWD", "PASSPHRASE", "TOKEN", "SECRET", "APIKEY", "CREDENTIALS"}
+	nonSecretNameParts = map[string]bool{
+		"GPG": true, "PUBLIC": true, "PUB": true, "FILE": true, "PATH": true,
+		"DIR": true, "ID": true, "URL": true, "NAME": true, "SIZE": true, "LENGTH": true,
+	}
+	nameSeparators = regexp.MustCompile(`[^A-Za-z0-9]+`)
+	// assignment matches NAME=value pairs in ENV, ARG and RUN instructions
+	assignment = regexp.MustCompile(`(?:^|\s)([A-Za-z_][A-Za-z0-9_.-]*)=("[^"]*"|'[^']*'|\S+)`)
+)
+
+// nameParts splits a variable name into upper case components.
+func nameParts(name string) []string {
+	return nameSeparators.Split(strings.ToUpper(name), -1)
+}
+
+// publicName reports whether the name of a variable says it holds no secret
+// itself, such as GPG_KEY fingerprints or TOKEN_FILE paths. Their values are
+// only checked for structured tokens.
+func publicName(name string) bool {
+	for _, part := range nameParts(name) {
+		if nonSecretNameParts[part] {
+			return true
+		}
+	}
+	return false
+}
+
+// secretName reports whether the name of a variable suggests it holds a
+// secret.
+func secretName(name string) bool {
+	if publicName(name) {
+		return false
+	}
+	found := false
+	for _, part := range nameParts(name) {
+		if part == "KEY" {
+			found = true
+		}
+		for _, s := range secretNameParts {
+			if strings.Contains(part, s) {
+				found = true
+			}
+		}
+	}
+	return found
+}
+
+// plausibleSecret filters out values that cannot be secrets themselves, such
+// as references to other variables or files.
+func plausibleSecret(value string) bool {
+	if len(value) < 4 || strings.HasPrefix(value, "/") || strings.HasPrefix(value, "$") {
+		return false
+	}
+	switch strings.ToLower(value) {
+	case "true", "false", "none", "null", "changeme":
+		return false
+	}
+	return true
+}
+
+// scanConfig looks for secrets in the environment, labels and history of
+// the image. Values are checked against the content patterns, and variables
+// whose name suggests a secret are reported whatever their value.
+func (s *scan) scanConfig() {
+	seen := make(map[string]bool)
+	add := func(f Finding) {
+		if seen[f.Secret] {
+			return
+		}
+		seen[f.Secret] = true
+		s.report.Findings = append(s.report.Findings, f)
+	}
+	// setBy names the history entry at i as the one setting the value of f
+	setBy := func(f *Finding, i int) {
+		if i >= 0 {
+			h := s.report.History[i]
+			f.Layer, f.Instruction, f.HistoryIndex = h.LayerID, h.Instruction(), &i
+		}
+	}
+
+	for _, env := range s.report.Metadata.Env {
+		name, value, _ := strings.Cut(env, "=")
+		i := s.setBy(name + "=")
+		for _, f := range s.scanValue(FindingEnv, "env:"+name, name, value) {
+			setBy(&f, i)
+			add(f)
+		}
+	}
+	labels := s.report.Metadata.Labels
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		i := s.setBy(name + "=")
+		for _, f := range s.scanValue(FindingLabel, "label:"+name, name, labels[name]) {
+			setBy(&f, i)
+			add(f)
+		}
+	}
+	for i, h := range s.report.History {
+		var findings []Finding
+		for _, m := range assignment.FindAllStringSubmatch(h.CreatedBy, -1) {
+			findings = append(findings, s.scanValue(FindingHistory, "history", m[1], strings.Trim(m[2], `"'`))...)
+		}
+		if len(findings) == 0 {
+			findings = s.scanValue(FindingHistory, "history", "", h.CreatedBy)
+		}
+		for _, f := range findings {
+			setBy(&f, i)
+			add(f)
+		}
+	}
+}
+
+// scanValue checks the value of a variable or a whole history entry. At
+// most one finding is reported per value. Patterns with a validator match
+// structured tokens and go first, even for public names such as
+// AWS_ACCESS_KEY_ID, then the name of the variable and the entropy
+// detector. The patterns without a validator are not applied: commands are
+// full of commit hashes and key fingerprints they would mistake for
+// secrets.
+func (s *scan) scanValue(kind, path, name, value string) []Finding {
+	if f, ok := s.matchPattern(kind, path, value); ok {
+		return []Finding{f}
+	}
+	if name != "" && publicName(name) {
+		return nil
+	}
+	if name != "" && secretName(name) && plausibleSecret(value) {
+		return []Finding{{
+			Type:        kind,
+			Description: "Secret-like variable " + name,
+			Pattern:     secretNameHeuristic,
+			Path:        path,
+			Secret:      value,
+			Validation:  ValidationUnverified,
+		}}
+	}
+	text := value
+	if name != "" {
+		text = name + "=" + value
+	}
+	if findings := s.scanEntropy(kind, path, text); len(findings) > 0 {
+		return findings[:1]
+	}
+	return nil
+}
+
+// matchPattern returns the first content pattern with a validator matching
+// value. The match is validated.
+func (s *scan) matchPattern(kind, path, value string) (Finding, bool) {
+	for _, p := range s.a.patterns {
+		if p.SecretType != "FileContent" || p.Validator == "" {
+			continue
+		}
+		if match := strings.TrimSpace(p.Regex.FindString(value)); match != "" {
+			return Finding{
+				Type:        kind,
+				Description: p.Description,
+				Pattern:     p.Value,
+				Path:        path,
+				Secret:      match,
+				Validation:  p.validate(match),
+			}, true
+		}
+	}
+	return Finding{}, false
+}
+
+// setBy returns the index of the last history entry mentioning
+// assignment, the instruction that most likely set the variable, or -1.
+func (s *scan) setBy(assignment string) int {
+	for i := len(s.report.History) - 1; i >= 0; i-- {
+		if strings.Contains(s.report.History[i].CreatedBy, assignment) {
+			return i
+		}
+	}
+	return -1
+}
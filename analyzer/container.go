@@ -0,0 +1,124 @@
+package analyzer
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// AnalyzeContainer reports what changed in a container of a docker daemon
+// since it started, on top of the history of its image. The changes form a
+// last step of the history, after the reconstructed Dockerfile, and the
+// files added or changed are scanned like the files of a layer.
+func (a *Analyzer) AnalyzeContainer(ctx context.Context, cli DockerClient, id string) (*Report, error) {
+	info, err := cli.ContainerInspect(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if info.ContainerJSONBase == nil {
+		return nil, fmt.Errorf("container %s: the daemon returned no details", id)
+	}
+	s, err := a.scanImage(ctx, &DockerImage{Client: cli, Ref: info.Image})
+	if err != nil {
+		return nil, fmt.Errorf("image of container %s: %v", id, err)
+	}
+	c := &Container{ID: info.ID, Name: strings.TrimPrefix(info.Name, "/"), Image: info.Image}
+	if info.Config != nil && info.Config.Image != "" {
+		c.Image = info.Config.Image
+	}
+	if info.State != nil {
+		c.State, c.Started = info.State.Status, info.State.StartedAt
+	}
+	s.report.Image = c.Image
+	s.report.Container = c
+
+	changes, err := cli.ContainerDiff(ctx, info.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.scanContainer(ctx, cli, c, changes); err != nil {
+		return nil, err
+	}
+	return s.finish(), nil
+}
+
+// changeKinds maps the kinds of changes of the daemon to those of diffs.
+var changeKinds = map[container.ChangeType]string{
+	container.ChangeAdd:    Added,
+	container.ChangeModify: Changed,
+	container.ChangeDelete: Removed,
+}
+
+// scanContainer reads the files added or changed in c from its export and
+// appends them to the history as a layer. Removed files are recorded as
+// whiteouts, so the merged filesystem matches the container.
+func (s *scan) scanContainer(ctx context.Context, cli DockerClient, c *Container, changes []container.FilesystemChange) error {
+	layerName := "container:" + shortID(c.ID)
+	s.layers[layerName] = make([]File, 0)
+	changed := make(map[string]bool)
+	var removed []string
+	c.Changes = []FileChange{}
+	for _, change := range changes {
+		name := CleanPath(change.Path)
+		kind, ok := changeKinds[change.Kind]
+		if !ok {
+			continue
+		}
+		c.Changes = append(c.Changes, FileChange{Path: name, Kind: kind})
+		if kind == Removed {
+			removed = append(removed, name)
+		} else {
+			changed[name] = true
+		}
+	}
+
+	if len(changed) > 0 {
+		export, err := cli.ContainerExport(ctx, c.ID)
+		if err != nil {
+			return err
+		}
+		defer export.Close()
+		tr := tar.NewReader(export)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read the export of container %s: %v", c.Name, err)
+			}
+			if changed[CleanPath(hdr.Name)] {
+				s.addFile(layerName, hdr, tr)
+			}
+		}
+	}
+	s.scanGitRepos(layerName)
+	for _, name := range removed {
+		s.layers[layerName] = append(s.layers[layerName], File{Path: path.Join(path.Dir(name), whiteoutPrefix+path.Base(name))})
+	}
+
+	s.report.History = append(s.report.History, History{
+		Created:   c.Started,
+		CreatedBy: fmt.Sprintf("# changes in container %s since it started", c.Name),
+		LayerID:   layerName,
+		Files:     s.layers[layerName],
+	})
+	s.report.Packages = s.attributePackages(s.report.History)
+	if release, ok := s.osReleases[layerName]; ok {
+		s.report.OS = release
+	}
+	return nil
+}
+
+// shortID abbreviates a container ID the way docker prints it.
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
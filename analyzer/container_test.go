@@ -0,0 +1,104 @@
+package analyzer
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzeContainer(t *testing.T) {
+	const id = "3f2a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a3b2c1d0e9f8a7b6c5d4e3f2a"
+	image := dockerArchive(t, `{"history": [{"created_by": "/bin/sh -c #(nop) ADD file:abc in / "}]}`, []testEntry{
+		{hdr: tar.Header{Name: "etc/", Typeflag: tar.TypeDir}},
+		{hdr: tar.Header{Name: "etc/passwd"}, body: "root:x:0:0::/root:/bin/sh\n"},
+		{hdr: tar.Header{Name: "app/config"}, body: "debug=false\n"},
+	})
+	export := writeTar(t, []testEntry{
+		{hdr: tar.Header{Name: "etc/", Typeflag: tar.TypeDir}},
+		{hdr: tar.Header{Name: "etc/passwd"}, body: "root:x:0:0::/root:/bin/sh\nbackdoor:x:0:0::/:/bin/sh\n"},
+		{hdr: tar.Header{Name: "root/", Typeflag: tar.TypeDir}},
+		{hdr: tar.Header{Name: "root/.ssh/id_rsa"}, body: "key"},
+		{hdr: tar.Header{Name: "usr/bin/sh"}, body: "unchanged"},
+	})
+	var saved, exported []string
+	cli := &MockDockerClient{
+		imageSaveFunc: func(ctx context.Context, imageIDs []string) (io.ReadCloser, error) {
+			saved = append(saved, imageIDs...)
+			return io.NopCloser(bytes.NewReader(image)), nil
+		},
+		containerInspectFunc: func(ctx context.Context, containerID string) (container.InspectResponse, error) {
+			if containerID != "web" {
+				return container.InspectResponse{}, errors.New("no such container: " + containerID)
+			}
+			return container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{
+					ID:    id,
+					Name:  "/web",
+					Image: "sha256:abc",
+					State: &container.State{Status: "running", StartedAt: "2026-10-01T10:00:00Z"},
+				},
+				Config: &container.Config{Image: "nginx:latest"},
+			}, nil
+		},
+		containerDiffFunc: func(ctx context.Context, containerID string) ([]container.FilesystemChange, error) {
+			return []container.FilesystemChange{
+				{Kind: container.ChangeModify, Path: "/etc"},
+				{Kind: container.ChangeModify, Path: "/etc/passwd"},
+				{Kind: container.ChangeAdd, Path: "/root"},
+				{Kind: container.ChangeAdd, Path: "/root/.ssh/id_rsa"},
+				{Kind: container.ChangeDelete, Path: "/app/config"},
+			}, nil
+		},
+		containerExportFunc: func(ctx context.Context, containerID string) (io.ReadCloser, error) {
+			exported = append(exported, containerID)
+			return io.NopCloser(bytes.NewReader(export)), nil
+		},
+	}
+
+	a := newTestAnalyzer(t, Options{})
+	_, err := a.AnalyzeContainer(context.Background(), cli, "missing")
+	assert.EqualError(t, err, "no such container: missing")
+
+	report, err := a.AnalyzeContainer(context.Background(), cli, "web")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"sha256:abc"}, saved, "the image is read by ID")
+	assert.Equal(t, []string{id}, exported)
+	assert.Equal(t, "nginx:latest", report.Image)
+	assert.Equal(t, &Container{
+		ID: id, Name: "web", Image: "nginx:latest", State: "running", Started: "2026-10-01T10:00:00Z",
+		Changes: []FileChange{
+			{Path: "etc", Kind: Changed},
+			{Path: "etc/passwd", Kind: Changed},
+			{Path: "root", Kind: Added},
+			{Path: "root/.ssh/id_rsa", Kind: Added},
+			{Path: "app/config", Kind: Removed},
+		},
+	}, report.Container)
+
+	if assert.Len(t, report.History, 2) {
+		h := report.History[1]
+		assert.Equal(t, "# changes in container web since it started", h.Instruction())
+		assert.Equal(t, "container:3f2a1b0c9d8e", h.LayerID)
+		var paths []string
+		for _, f := range h.Files {
+			paths = append(paths, f.Path)
+		}
+		assert.Equal(t, []string{"etc/", "etc/passwd", "root/", "root/.ssh/id_rsa", "app/.wh.config"}, paths, "unchanged files are skipped")
+	}
+	if assert.Len(t, report.Findings, 1) {
+		assert.Equal(t, "root/.ssh/id_rsa", report.Findings[0].Path)
+		assert.Equal(t, "container:3f2a1b0c9d8e", report.Findings[0].Layer)
+		assert.NotEmpty(t, report.Findings[0].Fingerprint)
+	}
+	fs := report.Filesystem()
+	assert.NotContains(t, fs, "app/config")
+	assert.Equal(t, int64(52), fs["etc/passwd"].Size)
+}
@@ -0,0 +1,197 @@
+package analyzer
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// cryptAlphabet is the base64 alphabet of crypt(3) hashes.
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// maxCryptRounds caps the rounds of the SHA-crypt hashes crypt computes, so
+// an image cannot make guessing passwords arbitrarily slow.
+const maxCryptRounds = 100000
+
+// crypt hashes password with the algorithm and salt of setting, a crypt(3)
+// hash. ok is false for the algorithms it does not implement: only the MD5
+// and SHA-crypt schemes of glibc are, enough to guess the passwords of
+// images built with chpasswd or openssl passwd.
+func crypt(password, setting string) (string, bool) {
+	switch {
+	case strings.HasPrefix(setting, "$1$"):
+		return md5Crypt(password, setting[3:]), true
+	case strings.HasPrefix(setting, "$5$"):
+		return shaCrypt(sha256.New, "$5$", password, setting[3:])
+	case strings.HasPrefix(setting, "$6$"):
+		return shaCrypt(sha512.New, "$6$", password, setting[3:])
+	}
+	return "", false
+}
+
+// md5Crypt implements the MD5 based scheme of FreeBSD.
+func md5Crypt(password, salt string) string {
+	salt, _, _ = strings.Cut(salt, "$")
+	salt = salt[:min(len(salt), 8)]
+	pw := []byte(password)
+
+	alt := md5.Sum([]byte(password + salt + password))
+	h := md5.New()
+	h.Write([]byte(password + "$1$" + salt))
+	for i := len(pw); i > 0; i -= 16 {
+		h.Write(alt[:min(i, 16)])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			h.Write([]byte{0})
+		} else {
+			h.Write(pw[:1])
+		}
+	}
+	final := h.Sum(nil)
+	for i := 0; i < 1000; i++ {
+		h := md5.New()
+		if i&1 != 0 {
+			h.Write(pw)
+		} else {
+			h.Write(final)
+		}
+		if i%3 != 0 {
+			h.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			h.Write(pw)
+		}
+		if i&1 != 0 {
+			h.Write(final)
+		} else {
+			h.Write(pw)
+		}
+		final = h.Sum(nil)
+	}
+	order := [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}}
+	return "$1$" + salt + "$" + cryptEncode(final, order, 11)
+}
+
+// shaCrypt implements the SHA-crypt scheme of glibc, with SHA-256 or
+// SHA-512 depending on newHash.
+func shaCrypt(newHash func() hash.Hash, prefix, password, setting string) (string, bool) {
+	rounds, custom := 5000, false
+	if r, ok := strings.CutPrefix(setting, "rounds="); ok {
+		n, rest, _ := strings.Cut(r, "$")
+		v, err := strconv.Atoi(n)
+		if err != nil {
+			return "", false
+		}
+		rounds, custom, setting = min(max(v, 1000), 999999999), true, rest
+	}
+	if rounds > maxCryptRounds {
+		return "", false
+	}
+	salt, _, _ := strings.Cut(setting, "$")
+	salt = salt[:min(len(salt), 16)]
+	pw, s := []byte(password), []byte(salt)
+
+	sum := func(parts ...[]byte) []byte {
+		h := newHash()
+		for _, p := range parts {
+			h.Write(p)
+		}
+		return h.Sum(nil)
+	}
+	// repeat fills n bytes with b
+	repeat := func(b []byte, n int) []byte {
+		out := make([]byte, 0, n)
+		for len(out) < n {
+			out = append(out, b[:min(len(b), n-len(out))]...)
+		}
+		return out
+	}
+
+	alt := sum(pw, s, pw)
+	h := newHash()
+	h.Write(pw)
+	h.Write(s)
+	h.Write(repeat(alt, len(pw)))
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			h.Write(alt)
+		} else {
+			h.Write(pw)
+		}
+	}
+	a := h.Sum(nil)
+	p := repeat(sum(repeat(pw, len(pw)*len(pw))), len(pw))
+	sp := repeat(sum(repeat(s, len(s)*(16+int(a[0])))), len(s))
+	for i := 0; i < rounds; i++ {
+		h := newHash()
+		if i&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(a)
+		}
+		if i%3 != 0 {
+			h.Write(sp)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 != 0 {
+			h.Write(a)
+		} else {
+			h.Write(p)
+		}
+		a = h.Sum(nil)
+	}
+
+	out := prefix
+	if custom {
+		out += "rounds=" + strconv.Itoa(rounds) + "$"
+	}
+	out += salt + "$"
+	if len(a) == sha256.Size {
+		order := [][3]int{{0, 10, 20}, {21, 1, 11}, {12, 22, 2}, {3, 13, 23}, {24, 4, 14},
+			{15, 25, 5}, {6, 16, 26}, {27, 7, 17}, {18, 28, 8}, {9, 19, 29}}
+		// The last two bytes are encoded as 3 characters
+		tail := uint(a[31])<<8 | uint(a[30])
+		return out + cryptEncode(a, order, -1) + cryptChars(tail, 3), true
+	}
+	order := make([][3]int, 21)
+	for i := range order {
+		order[i] = [3]int{i, (i + 21) % 63, (i + 42) % 63}
+		// Each triple rotates the one before it
+		switch i % 3 {
+		case 1:
+			order[i] = [3]int{(i + 21) % 63, (i + 42) % 63, i}
+		case 2:
+			order[i] = [3]int{(i + 42) % 63, i, (i + 21) % 63}
+		}
+	}
+	return out + cryptEncode(a, order, 63), true
+}
+
+// cryptEncode encodes the bytes of sum grouped in triples as in order, then
+// the byte at last, if any, as 2 characters.
+func cryptEncode(sum []byte, order [][3]int, last int) string {
+	var b strings.Builder
+	for _, o := range order {
+		b.WriteString(cryptChars(uint(sum[o[0]])<<16|uint(sum[o[1]])<<8|uint(sum[o[2]]), 4))
+	}
+	if last >= 0 {
+		b.WriteString(cryptChars(uint(sum[last]), 2))
+	}
+	return b.String()
+}
+
+// cryptChars encodes the n lowest sextets of w, least significant first.
+func cryptChars(w uint, n int) string {
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = cryptAlphabet[w&0x3f]
+		w >>= 6
+	}
+	return string(out)
+}
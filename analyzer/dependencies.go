@@ -0,0 +1,348 @@
+package analyzer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"debug/buildinfo"
+	"encoding/json"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Language ecosystem package types, named after their package URL types
+const (
+	PackageNpm    = "npm"
+	PackagePypi   = "pypi"
+	PackageGem    = "gem"
+	PackageMaven  = "maven"
+	PackageGolang = "golang"
+)
+
+// maxDependencyFileSize bounds the size of archives and binaries read into
+// memory to look for dependencies.
+const maxDependencyFileSize = 256 << 20
+
+var (
+	nodeModuleManifest = regexp.MustCompile(`(^|/)node_modules/(@[^/]+/)?[^/@.][^/]*/package\.json$`)
+	pythonMetadata     = regexp.MustCompile(`\.dist-info/METADATA$|\.egg-info/PKG-INFO$`)
+	pomProperties      = regexp.MustCompile(`^META-INF/maven/[^/]+/[^/]+/pom\.properties$`)
+	gemSpec            = regexp.MustCompile(`^    (\S+) \(([^)]+)\)$`)
+)
+
+// executableMagic are the headers of the binary formats Go build info can be
+// read from: ELF, PE and Mach-O.
+var executableMagic = [][]byte{
+	[]byte("\x7fELF"),
+	[]byte("MZ"),
+	{0xfe, 0xed, 0xfa, 0xce}, {0xfe, 0xed, 0xfa, 0xcf},
+	{0xce, 0xfa, 0xed, 0xfe}, {0xcf, 0xfa, 0xed, 0xfe},
+}
+
+// dependencyType returns the ecosystem of the dependency manifest stored at
+// name, or "" when it is not one. Executables are reported as PackageGolang
+// and only turn out to be Go binaries once read.
+func dependencyType(name string, hdr *tar.Header) string {
+	if hdr.Typeflag != tar.TypeReg {
+		return ""
+	}
+	name = CleanPath(name)
+	base := path.Base(name)
+	switch {
+	case base == "package-lock.json" || nodeModuleManifest.MatchString(name):
+		return PackageNpm
+	case pythonMetadata.MatchString(name):
+		return PackagePypi
+	case base == "Gemfile.lock":
+		return PackageGem
+	case strings.HasSuffix(base, ".jar") || strings.HasSuffix(base, ".war") || strings.HasSuffix(base, ".ear"):
+		return PackageMaven
+	case hdr.FileInfo().Mode()&0111 != 0:
+		return PackageGolang
+	}
+	return ""
+}
+
+// readDependencies parses a dependency manifest found in layerName. When
+// an executable turns out not to be a Go binary it returns its content,
+// unread, so that other scans can look at it.
+func (s *scan) readDependencies(layerName, name, kind string, hdr *tar.Header, r io.Reader) io.Reader {
+	if hdr.Size > maxDependencyFileSize {
+		if kind == PackageGolang {
+			return r
+		}
+		return nil
+	}
+	br := bufio.NewReader(r)
+	if kind == PackageGolang && !isExecutable(br) {
+		return br
+	}
+	data, err := io.ReadAll(br)
+	if err != nil {
+		s.warn("%s: failed to read %s: %v", layerName, name, err)
+		return nil
+	}
+
+	location := CleanPath(name)
+	var pkgs []Package
+	switch {
+	case kind == PackageNpm && path.Base(location) == "package-lock.json":
+		pkgs, err = parsePackageLock(data)
+	case kind == PackageNpm:
+		pkgs, err = parsePackageJSON(data)
+	case kind == PackagePypi:
+		pkgs = parsePythonMetadata(data)
+	case kind == PackageGem:
+		pkgs = parseGemfileLock(data)
+	case kind == PackageMaven:
+		pkgs, err = parseJar(data, path.Base(location))
+	case kind == PackageGolang:
+		// Most executables are not Go binaries, so errors are expected
+		if pkgs, _ = parseGoBinary(data); len(pkgs) == 0 {
+			return bytes.NewReader(data)
+		}
+	}
+	if err != nil {
+		s.warn("%s: failed to parse %s: %v", layerName, name, err)
+		return nil
+	}
+	if len(pkgs) == 0 {
+		return nil
+	}
+	for i := range pkgs {
+		pkgs[i].Location = location
+	}
+	s.dependencies[layerName] = append(s.dependencies[layerName], packageDB{Path: location, Packages: pkgs})
+	return nil
+}
+
+func isExecutable(r *bufio.Reader) bool {
+	head, _ := r.Peek(4)
+	for _, magic := range executableMagic {
+		if bytes.HasPrefix(head, magic) {
+			return true
+		}
+	}
+	return false
+}
+
+type npmLockEntry struct {
+	Name         string                  `json:"name"`
+	Version      string                  `json:"version"`
+	Link         bool                    `json:"link"`
+	Dependencies map[string]npmLockEntry `json:"dependencies"`
+}
+
+// parsePackageLock reads the packages of a package-lock.json. Version 2 and
+// 3 lockfiles list them under "packages", version 1 nests them under
+// "dependencies".
+func parsePackageLock(data []byte) ([]Package, error) {
+	var lock struct {
+		Packages     map[string]npmLockEntry `json:"packages"`
+		Dependencies map[string]npmLockEntry `json:"dependencies"`
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+	var pkgs []Package
+	if len(lock.Packages) > 0 {
+		for _, key := range sortedKeys(lock.Packages) {
+			entry := lock.Packages[key]
+			i := strings.LastIndex(key, "node_modules/")
+			if i < 0 || entry.Link || entry.Version == "" {
+				continue
+			}
+			name := key[i+len("node_modules/"):]
+			if entry.Name != "" {
+				name = entry.Name
+			}
+			pkgs = append(pkgs, Package{Type: PackageNpm, Name: name, Version: entry.Version})
+		}
+		return pkgs, nil
+	}
+	var walk func(deps map[string]npmLockEntry)
+	walk = func(deps map[string]npmLockEntry) {
+		for _, name := range sortedKeys(deps) {
+			entry := deps[name]
+			if entry.Version != "" {
+				pkgs = append(pkgs, Package{Type: PackageNpm, Name: name, Version: entry.Version})
+			}
+			walk(entry.Dependencies)
+		}
+	}
+	walk(lock.Dependencies)
+	return pkgs, nil
+}
+
+func parsePackageJSON(data []byte) ([]Package, error) {
+	var manifest struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Name == "" || manifest.Version == "" {
+		return nil, nil
+	}
+	return []Package{{Type: PackageNpm, Name: manifest.Name, Version: manifest.Version}}, nil
+}
+
+// parsePythonMetadata reads the name and version from the headers of a
+// METADATA or PKG-INFO file. The description body after them is ignored.
+func parsePythonMetadata(data []byte) []Package {
+	stanzas := parseControl(data, ":")
+	if len(stanzas) == 0 || stanzas[0]["Name"] == "" {
+		return nil
+	}
+	return []Package{{Type: PackagePypi, Name: stanzas[0]["Name"], Version: stanzas[0]["Version"]}}
+}
+
+// parseGemfileLock reads the gems listed under the specs of the GEM, GIT and
+// PATH sections. Their own dependencies are indented further and skipped.
+func parseGemfileLock(data []byte) []Package {
+	var pkgs []Package
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line != "" && line[0] != ' ' {
+			section = line
+			continue
+		}
+		if section != "GEM" && section != "GIT" && section != "PATH" {
+			continue
+		}
+		if m := gemSpec.FindStringSubmatch(line); m != nil {
+			pkgs = append(pkgs, Package{Type: PackageGem, Name: m[1], Version: m[2]})
+		}
+	}
+	return pkgs
+}
+
+// parseJar reads the Maven coordinates of a Java archive from its
+// pom.properties files, falling back to the manifest for jars that were not
+// built by Maven.
+func parseJar(data []byte, filename string) ([]Package, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []Package
+	var manifest *zip.File
+	for _, f := range zr.File {
+		switch {
+		case pomProperties.MatchString(f.Name):
+			props, err := readZipFile(f)
+			if err != nil {
+				return nil, err
+			}
+			p := parseProperties(props)
+			if p["artifactId"] != "" && p["version"] != "" {
+				pkgs = append(pkgs, Package{Type: PackageMaven, Name: p["groupId"] + ":" + p["artifactId"], Version: p["version"]})
+			}
+		case strings.EqualFold(f.Name, "META-INF/MANIFEST.MF"):
+			manifest = f
+		}
+	}
+	if len(pkgs) > 0 || manifest == nil {
+		return pkgs, nil
+	}
+
+	data, err = readZipFile(manifest)
+	if err != nil {
+		return nil, err
+	}
+	// Manifest lines longer than 72 bytes continue on lines starting with a space
+	stanzas := parseControl(bytes.ReplaceAll(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")), []byte("\n "), nil), ":")
+	if len(stanzas) == 0 {
+		return nil, nil
+	}
+	main := stanzas[0]
+	name, _, _ := strings.Cut(main["Bundle-SymbolicName"], ";")
+	if name == "" {
+		name = main["Implementation-Title"]
+	}
+	if name == "" {
+		name = strings.TrimSuffix(filename, path.Ext(filename))
+	}
+	version := main["Bundle-Version"]
+	if version == "" {
+		version = main["Implementation-Version"]
+	}
+	if version == "" {
+		return nil, nil
+	}
+	return []Package{{Type: PackageMaven, Name: strings.TrimSpace(name), Version: version}}, nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, maxDependencyFileSize))
+}
+
+// parseProperties reads a Java properties file of simple key=value lines.
+func parseProperties(data []byte) map[string]string {
+	props := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			props[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return props
+}
+
+// parseGoBinary reads the modules compiled into a Go binary, including the
+// standard library at the version of the toolchain that built it.
+func parseGoBinary(data []byte) ([]Package, error) {
+	info, err := buildinfo.Read(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	pkgs := []Package{{Type: PackageGolang, Name: "stdlib", Version: strings.TrimPrefix(info.GoVersion, "go")}}
+	if info.Main.Path != "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		pkgs = append(pkgs, Package{Type: PackageGolang, Name: info.Main.Path, Version: info.Main.Version})
+	}
+	for _, dep := range info.Deps {
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		pkgs = append(pkgs, Package{Type: PackageGolang, Name: dep.Path, Version: dep.Version})
+	}
+	return pkgs, nil
+}
+
+// attributeDependencies lists the dependencies declared by the files present
+// in the final image, attributed to the layer that last wrote each file.
+func (s *scan) attributeDependencies(history []History) []Package {
+	files := make(map[string]map[string][]Package)
+	for layer, manifests := range s.dependencies {
+		files[layer] = make(map[string][]Package)
+		for _, m := range manifests {
+			files[layer][m.Path] = m.Packages
+		}
+	}
+	var pkgs []Package
+	fs := (&Report{History: history}).Filesystem()
+	for _, name := range sortedKeys(fs) {
+		h := history[fs[name].History]
+		for _, pkg := range files[h.LayerID][name] {
+			pkg.Layer = h.LayerID
+			pkg.Instruction = h.Instruction()
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	return pkgs
+}
@@ -0,0 +1,143 @@
+package analyzer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const packageLock = `{
+  "name": "app",
+  "lockfileVersion": 3,
+  "packages": {
+    "": {"name": "app", "version": "1.0.0"},
+    "node_modules/express": {"version": "4.18.2"},
+    "node_modules/express/node_modules/debug": {"version": "2.6.9"},
+    "node_modules/local": {"resolved": "../local", "link": true}
+  }
+}`
+
+const gemfileLock = `GEM
+  remote: https://rubygems.org/
+  specs:
+    nokogiri (1.15.4-x86_64-linux)
+      racc (~> 1.4)
+    racc (1.7.1)
+
+PLATFORMS
+  x86_64-linux
+
+BUNDLED WITH
+   2.4.19
+`
+
+func TestParsePackageLockV1(t *testing.T) {
+	pkgs, err := parsePackageLock([]byte(`{"lockfileVersion": 1, "dependencies": {
+		"lodash": {"version": "4.17.21"},
+		"mkdirp": {"version": "0.5.1", "dependencies": {"minimist": {"version": "0.0.8"}}}
+	}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []Package{
+		{Type: PackageNpm, Name: "lodash", Version: "4.17.21"},
+		{Type: PackageNpm, Name: "mkdirp", Version: "0.5.1"},
+		{Type: PackageNpm, Name: "minimist", Version: "0.0.8"},
+	}, pkgs)
+}
+
+func TestParseJarManifest(t *testing.T) {
+	jar := zipFile(t, map[string]string{
+		"META-INF/MANIFEST.MF": "Manifest-Version: 1.0\r\nBundle-SymbolicName: org.example.very.long.bundle.name.that.wraps.across.lines.in.the.mani\r\n fest;singleton:=true\r\nBundle-Version: 2.1.0\r\n",
+	})
+	pkgs, err := parseJar(jar, "bundle.jar")
+	assert.NoError(t, err)
+	assert.Equal(t, []Package{{Type: PackageMaven, Name: "org.example.very.long.bundle.name.that.wraps.across.lines.in.the.manifest", Version: "2.1.0"}}, pkgs)
+}
+
+func TestDependencyInventory(t *testing.T) {
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary, err := os.ReadFile(self)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jar := zipFile(t, map[string]string{
+		"META-INF/MANIFEST.MF":                              "Manifest-Version: 1.0\n",
+		"META-INF/maven/org.slf4j/slf4j-api/pom.properties": "#Generated by Maven\ngroupId=org.slf4j\nartifactId=slf4j-api\nversion=2.0.9\n",
+	})
+
+	config := `{"history": [
+		{"created_by": "COPY app /app"},
+		{"created_by": "RUN pip install requests"},
+		{"created_by": "RUN rm -rf /app/Gemfile.lock"}
+	]}`
+	data := dockerArchive(t, config,
+		[]testEntry{
+			{hdr: tar.Header{Name: "app/package-lock.json"}, body: packageLock},
+			{hdr: tar.Header{Name: "app/node_modules/@types/node/package.json"}, body: `{"name": "@types/node", "version": "20.8.0"}`},
+			{hdr: tar.Header{Name: "app/node_modules/@types/node/test/package.json"}, body: `{"name": "fixture", "version": "0.0.0"}`},
+			{hdr: tar.Header{Name: "app/Gemfile.lock"}, body: gemfileLock},
+			{hdr: tar.Header{Name: "app/lib/slf4j-api.jar"}, body: string(jar)},
+			{hdr: tar.Header{Name: "app/server", Mode: 0755}, body: string(binary)},
+			{hdr: tar.Header{Name: "app/run.sh", Mode: 0755}, body: "#!/bin/sh\n"},
+		},
+		[]testEntry{
+			{hdr: tar.Header{Name: "usr/lib/python3/site-packages/requests-2.31.0.dist-info/METADATA"}, body: "Metadata-Version: 2.1\nName: requests\nVersion: 2.31.0\n\nRequests is an HTTP library.\nName: not-a-header\n"},
+		},
+		[]testEntry{
+			{hdr: tar.Header{Name: "app/.wh.Gemfile.lock"}},
+		},
+	)
+
+	a := newTestAnalyzer(t, Options{})
+	report, err := a.Analyze(context.Background(), &memorySource{name: "deps", data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]Package)
+	for _, p := range report.Packages {
+		found[p.Type+"/"+p.Name] = p
+	}
+	assert.Equal(t, Package{Type: PackageNpm, Name: "express", Version: "4.18.2", Location: "app/package-lock.json",
+		Layer: "layer0/layer.tar", Instruction: "COPY app /app"}, found["npm/express"])
+	assert.Equal(t, "2.6.9", found["npm/debug"].Version)
+	assert.Equal(t, "20.8.0", found["npm/@types/node"].Version)
+	assert.NotContains(t, found, "npm/fixture")
+	assert.NotContains(t, found, "npm/app")
+	assert.NotContains(t, found, "npm/local")
+	assert.Equal(t, Package{Type: PackagePypi, Name: "requests", Version: "2.31.0", Location: "usr/lib/python3/site-packages/requests-2.31.0.dist-info/METADATA",
+		Layer: "layer1/layer.tar", Instruction: "RUN pip install requests"}, found["pypi/requests"])
+	assert.NotContains(t, found, "gem/nokogiri", "deleted Gemfile.lock is not part of the image")
+	assert.Equal(t, "2.0.9", found["maven/org.slf4j:slf4j-api"].Version)
+	assert.Equal(t, "app/server", found["golang/stdlib"].Location)
+	assert.Contains(t, found, "golang/github.com/stretchr/testify")
+}
+
+func TestParseGemfileLock(t *testing.T) {
+	assert.Equal(t, []Package{
+		{Type: PackageGem, Name: "nokogiri", Version: "1.15.4-x86_64-linux"},
+		{Type: PackageGem, Name: "racc", Version: "1.7.1"},
+	}, parseGemfileLock([]byte(gemfileLock)))
+}
+
+func zipFile(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range sortedKeys(files) {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(files[name]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
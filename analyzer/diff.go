@@ -0,0 +1,274 @@
+package analyzer
+
+import (
+	"sort"
+	"strings"
+)
+
+// Kinds of change in a Diff
+const (
+	Added     = "added"
+	Removed   = "removed"
+	Changed   = "changed"
+	Unchanged = "unchanged"
+)
+
+// Diff describes what changed between two analyzed images.
+type Diff struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Instructions is the edit script turning the Dockerfile of From into
+	// the Dockerfile of To. Unchanged instructions are kept for context.
+	Instructions []InstructionChange `json:"instructions"`
+	// Layers are compared by digest
+	SharedLayers  []string   `json:"shared_layers"`
+	AddedLayers   []string   `json:"added_layers"`
+	RemovedLayers []string   `json:"removed_layers"`
+	Files         FilesDiff  `json:"files"`
+	Env           []EnvDiff  `json:"env,omitempty"`
+	AddedPorts    []string   `json:"added_ports,omitempty"`
+	RemovedPorts  []string   `json:"removed_ports,omitempty"`
+	User          *ValueDiff `json:"user,omitempty"`
+	// Findings are compared by path and description, regardless of layer
+	NewFindings      []Finding `json:"new_findings"`
+	ResolvedFindings []Finding `json:"resolved_findings"`
+}
+
+// InstructionChange is one step of the instruction edit script.
+type InstructionChange struct {
+	Kind string `json:"kind"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// FilesDiff compares the merged filesystems of two images.
+type FilesDiff struct {
+	Added    []string `json:"added"`
+	Removed  []string `json:"removed"`
+	Modified []string `json:"modified"`
+}
+
+// EnvDiff is a changed environment variable.
+type EnvDiff struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// ValueDiff is a changed scalar setting.
+type ValueDiff struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Compare reports what changed from image a to image b.
+func Compare(a, b *Report) *Diff {
+	d := &Diff{From: a.Image, To: b.Image}
+	d.Instructions = diffInstructions(instructions(a), instructions(b))
+	d.SharedLayers, d.RemovedLayers, d.AddedLayers = diffSets(layerDigests(a), layerDigests(b))
+	d.Files = diffFiles(a, b)
+	d.Env = diffEnv(a.Metadata.Env, b.Metadata.Env)
+	_, d.RemovedPorts, d.AddedPorts = diffSets(a.Metadata.ExposedPorts, b.Metadata.ExposedPorts)
+	if a.Metadata.User != b.Metadata.User {
+		d.User = &ValueDiff{From: a.Metadata.User, To: b.Metadata.User}
+	}
+	d.ResolvedFindings = subtractFindings(a.Findings, b.Findings)
+	d.NewFindings = subtractFindings(b.Findings, a.Findings)
+	return d
+}
+
+func instructions(r *Report) []string {
+	var result []string
+	for _, h := range r.History {
+		result = append(result, h.Instruction())
+	}
+	return result
+}
+
+func layerDigests(r *Report) []string {
+	var result []string
+	for _, h := range r.History {
+		if h.Digest != "" {
+			result = append(result, h.Digest)
+		}
+	}
+	return result
+}
+
+// diffInstructions computes a longest common subsequence edit script. A
+// removal directly followed by an addition is reported as a change.
+func diffInstructions(a, b []string) []InstructionChange {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var script []InstructionChange
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			script = append(script, InstructionChange{Kind: Unchanged, From: a[i], To: b[j]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			script = append(script, InstructionChange{Kind: Removed, From: a[i]})
+			i++
+		default:
+			script = append(script, InstructionChange{Kind: Added, To: b[j]})
+			j++
+		}
+	}
+
+	// Pair up runs of removals and additions into changes
+	var result []InstructionChange
+	for k := 0; k < len(script); {
+		var removed, added []InstructionChange
+		for k < len(script) && script[k].Kind == Removed {
+			removed = append(removed, script[k])
+			k++
+		}
+		for k < len(script) && script[k].Kind == Added {
+			added = append(added, script[k])
+			k++
+		}
+		n := min(len(removed), len(added))
+		for x := 0; x < n; x++ {
+			result = append(result, InstructionChange{Kind: Changed, From: removed[x].From, To: added[x].To})
+		}
+		result = append(result, removed[n:]...)
+		result = append(result, added[n:]...)
+		if len(removed) == 0 && len(added) == 0 {
+			result = append(result, script[k])
+			k++
+		}
+	}
+	return result
+}
+
+// diffSets returns the sorted elements found in both a and b, only in a and
+// only in b.
+func diffSets(a, b []string) (shared, onlyA, onlyB []string) {
+	inA := make(map[string]bool)
+	for _, s := range a {
+		inA[s] = true
+	}
+	inB := make(map[string]bool)
+	for _, s := range b {
+		inB[s] = true
+	}
+	for s := range inA {
+		if inB[s] {
+			shared = append(shared, s)
+		} else {
+			onlyA = append(onlyA, s)
+		}
+	}
+	for s := range inB {
+		if !inA[s] {
+			onlyB = append(onlyB, s)
+		}
+	}
+	sort.Strings(shared)
+	sort.Strings(onlyA)
+	sort.Strings(onlyB)
+	return shared, onlyA, onlyB
+}
+
+// diffFiles compares merged filesystems. A file provided by layers with the
+// same digest is unchanged; otherwise its type, size, mode, link target and
+// modification time are compared.
+func diffFiles(a, b *Report) FilesDiff {
+	var result FilesDiff
+	fsA, fsB := a.Filesystem(), b.Filesystem()
+	for name, fa := range fsA {
+		fb, ok := fsB[name]
+		if !ok {
+			result.Removed = append(result.Removed, name)
+			continue
+		}
+		digest := a.History[fa.History].Digest
+		if digest != "" && digest == b.History[fb.History].Digest {
+			continue
+		}
+		if fa.Mode != fb.Mode || fa.Size != fb.Size || fa.Linkname != fb.Linkname ||
+			(!fa.Mode.IsDir() && !fa.ModTime.Equal(fb.ModTime)) {
+			result.Modified = append(result.Modified, name)
+		}
+	}
+	for name := range fsB {
+		if _, ok := fsA[name]; !ok {
+			result.Added = append(result.Added, name)
+		}
+	}
+	sort.Strings(result.Added)
+	sort.Strings(result.Removed)
+	sort.Strings(result.Modified)
+	return result
+}
+
+func diffEnv(a, b []string) []EnvDiff {
+	envA, envB := envMap(a), envMap(b)
+	var result []EnvDiff
+	for name, from := range envA {
+		to, ok := envB[name]
+		switch {
+		case !ok:
+			result = append(result, EnvDiff{Name: name, Kind: Removed, From: from})
+		case from != to:
+			result = append(result, EnvDiff{Name: name, Kind: Changed, From: from, To: to})
+		}
+	}
+	for name, to := range envB {
+		if _, ok := envA[name]; !ok {
+			result = append(result, EnvDiff{Name: name, Kind: Added, To: to})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+func envMap(env []string) map[string]string {
+	m := make(map[string]string)
+	for _, e := range env {
+		name, value, _ := strings.Cut(e, "=")
+		m[name] = value
+	}
+	return m
+}
+
+// subtractFindings returns the findings of a that b does not have. A
+// secret replaced by another in the same file is a new finding.
+func subtractFindings(a, b []Finding) []Finding {
+	seen := make(map[[3]string]bool)
+	for _, f := range b {
+		seen[findingKey(f)] = true
+	}
+	result := []Finding{}
+	for _, f := range a {
+		if !seen[findingKey(f)] {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// findingKey identifies f in both images of a diff, by its fingerprint or,
+// for reports without one, its secret.
+func findingKey(f Finding) [3]string {
+	secret := f.Fingerprint
+	if secret == "" {
+		secret = f.Secret
+	}
+	return [3]string{CleanPath(f.Path), f.Description, secret}
+}
@@ -0,0 +1,155 @@
+package analyzer
+
+import (
+	"compress/gzip"
+	"sort"
+)
+
+// maxWastedFiles is the number of wasted files listed by Efficiency.
+const maxWastedFiles = 20
+
+// Efficiency measures the bytes an image spends on files that later layers
+// overwrite or delete, in the spirit of dive. Such files still take space
+// in the layers that wrote them.
+type Efficiency struct {
+	// Score is the fraction of the bytes of layer files still visible in the
+	// final filesystem, 1 for an image that wastes nothing
+	Score float64 `json:"score"`
+	// TotalBytes is the size of the files of every layer
+	TotalBytes  int64 `json:"total_bytes"`
+	WastedBytes int64 `json:"wasted_bytes"`
+	// Wasted are the files wasting the most bytes, largest first
+	Wasted []WastedFile `json:"wasted,omitempty"`
+}
+
+// WastedFile is a path written by layers whose copies are hidden later.
+type WastedFile struct {
+	Path string `json:"path"`
+	// Bytes is the size of the hidden copies
+	Bytes int64 `json:"bytes"`
+	// Copies is the number of layers that wrote a hidden copy
+	Copies int `json:"copies"`
+}
+
+// FilesSize returns the size of the files of the layer of h.
+func (h History) FilesSize() int64 {
+	var size int64
+	for _, f := range h.Files {
+		size += f.Size
+	}
+	return size
+}
+
+// Efficiency returns the fraction of the bytes of the files of h still
+// visible in the final filesystem.
+func (h History) Efficiency() float64 {
+	total := h.FilesSize()
+	if total == 0 {
+		return 1
+	}
+	return float64(total-h.WastedBytes) / float64(total)
+}
+
+// LargestFiles returns the n largest files of the layer of h, largest first.
+func (h History) LargestFiles(n int) []File {
+	files := make([]File, 0, len(h.Files))
+	for _, f := range h.Files {
+		if f.Size > 0 {
+			files = append(files, f)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Size > files[j].Size })
+	return files[:min(n, len(files))]
+}
+
+// measureEfficiency sets the wasted bytes of every layer of the report and
+// returns the efficiency of the image. A copy of a file is wasted when a
+// later layer overwrites or deletes it.
+func (r *Report) measureEfficiency() *Efficiency {
+	fs := r.Filesystem()
+	e := &Efficiency{Score: 1}
+	wasted := make(map[string]*WastedFile)
+	for i := range r.History {
+		h := &r.History[i]
+		for _, f := range h.Files {
+			name := CleanPath(f.Path)
+			if f.Size == 0 || IsWhiteout(name) {
+				continue
+			}
+			e.TotalBytes += f.Size
+			if merged, ok := fs[name]; ok && merged.History == i {
+				continue
+			}
+			h.WastedBytes += f.Size
+			e.WastedBytes += f.Size
+			w, ok := wasted[name]
+			if !ok {
+				w = &WastedFile{Path: name}
+				wasted[name] = w
+			}
+			w.Bytes += f.Size
+			w.Copies++
+		}
+	}
+	if e.TotalBytes > 0 {
+		e.Score = float64(e.TotalBytes-e.WastedBytes) / float64(e.TotalBytes)
+	}
+	for _, w := range wasted {
+		e.Wasted = append(e.Wasted, *w)
+	}
+	sort.Slice(e.Wasted, func(i, j int) bool {
+		if e.Wasted[i].Bytes != e.Wasted[j].Bytes {
+			return e.Wasted[i].Bytes > e.Wasted[j].Bytes
+		}
+		return e.Wasted[i].Path < e.Wasted[j].Path
+	})
+	e.Wasted = e.Wasted[:min(maxWastedFiles, len(e.Wasted))]
+	return e
+}
+
+// layerSize is the size of a layer tar, uncompressed and compressed.
+type layerSize struct {
+	size, compressed int64
+}
+
+// layerMeter measures a layer tar as it is read: its size, and the size it
+// would have gzip compressed at the default level, the way registries store
+// layers. Compressing is skipped when the compressed size is already known.
+type layerMeter struct {
+	size       int64
+	compressed byteCounter
+	zw         *gzip.Writer
+}
+
+func newLayerMeter(compressed bool) *layerMeter {
+	m := &layerMeter{}
+	if !compressed {
+		m.zw = gzip.NewWriter(&m.compressed)
+	}
+	return m
+}
+
+func (m *layerMeter) Write(p []byte) (int, error) {
+	m.size += int64(len(p))
+	if m.zw != nil {
+		m.zw.Write(p)
+	}
+	return len(p), nil
+}
+
+// compressedSize flushes the compressor and returns the compressed size.
+func (m *layerMeter) compressedSize() int64 {
+	if m.zw == nil {
+		return 0
+	}
+	m.zw.Close()
+	return int64(m.compressed)
+}
+
+// byteCounter is a writer that counts and drops what is written.
+type byteCounter int64
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
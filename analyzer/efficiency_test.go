@@ -0,0 +1,65 @@
+package analyzer
+
+import (
+	"archive/tar"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEfficiency(t *testing.T) {
+	config := `{"history": [
+		{"created_by": "/bin/sh -c #(nop) ADD file:abc in / "},
+		{"created_by": "/bin/sh -c apt-get update"},
+		{"created_by": "/bin/sh -c rm -rf /var/lib/apt/lists/* && echo v2 > /app/config"}
+	]}`
+	data := dockerArchive(t, config,
+		[]testEntry{
+			{hdr: tar.Header{Name: "app/config"}, body: "v1"},
+			{hdr: tar.Header{Name: "bin/sh"}, body: strings.Repeat("x", 600)},
+		},
+		[]testEntry{
+			{hdr: tar.Header{Name: "var/lib/apt/lists/", Typeflag: tar.TypeDir}},
+			{hdr: tar.Header{Name: "var/lib/apt/lists/main"}, body: strings.Repeat("p", 300)},
+			{hdr: tar.Header{Name: "var/lib/apt/lists/security"}, body: strings.Repeat("s", 100)},
+		},
+		[]testEntry{
+			{hdr: tar.Header{Name: "var/lib/apt/.wh.lists"}},
+			{hdr: tar.Header{Name: "app/config"}, body: "v2"},
+		},
+	)
+	report, err := newTestAnalyzer(t, Options{}).Analyze(context.Background(), &memorySource{name: "efficiency", data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base, apt, cleanup := report.History[0], report.History[1], report.History[2]
+	assert.Equal(t, int64(2), base.WastedBytes)
+	assert.Equal(t, int64(400), apt.WastedBytes)
+	assert.Equal(t, 0.0, apt.Efficiency())
+	assert.Equal(t, int64(0), cleanup.WastedBytes)
+	assert.Equal(t, 1.0, cleanup.Efficiency())
+
+	assert.Equal(t, &Efficiency{
+		Score:       float64(1004-402) / 1004,
+		TotalBytes:  1004,
+		WastedBytes: 402,
+		Wasted: []WastedFile{
+			{Path: "var/lib/apt/lists/main", Bytes: 300, Copies: 1},
+			{Path: "var/lib/apt/lists/security", Bytes: 100, Copies: 1},
+			{Path: "app/config", Bytes: 2, Copies: 1},
+		},
+	}, report.Efficiency)
+
+	// Layer sizes cover the tar padding, and docker save stores layers
+	// uncompressed so the compressed size is estimated
+	assert.Greater(t, apt.Size, int64(400))
+	assert.Zero(t, apt.Size%512)
+	assert.Greater(t, apt.CompressedSize, int64(0))
+	assert.Less(t, apt.CompressedSize, apt.Size)
+
+	assert.Equal(t, []File{base.Files[1], base.Files[0]}, base.LargestFiles(5))
+	assert.Len(t, base.LargestFiles(1), 1)
+}
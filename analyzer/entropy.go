@@ -0,0 +1,190 @@
+package analyzer
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// FindingFileContent is the type of findings in the content of layer files.
+const FindingFileContent = "FileContent"
+
+// Entropy detector defaults, the values truffleHog made common
+const (
+	DefaultBase64Threshold = 4.5
+	DefaultHexThreshold    = 3.0
+	DefaultEntropyLength   = 20
+)
+
+// maxEntropyFileSize is the largest file whose content is scanned.
+const maxEntropyFileSize = 1 << 20
+
+// EntropyOptions configures the detector for high entropy strings, random
+// looking tokens that are likely keys or passwords. Zero values take the
+// defaults.
+type EntropyOptions struct {
+	// Base64Threshold is the minimum Shannon entropy, in bits per
+	// character, of a base64 token.
+	Base64Threshold float64
+	// HexThreshold is the minimum entropy of a hexadecimal token.
+	HexThreshold float64
+	// MinLength is the length of the shortest token considered.
+	MinLength int
+	// RequireKeyword only reports tokens assigned to a key, token, secret or
+	// password, as in "api_key=..." or "token: ...".
+	RequireKeyword bool
+}
+
+func (o EntropyOptions) withDefaults() EntropyOptions {
+	if o.Base64Threshold == 0 {
+		o.Base64Threshold = DefaultBase64Threshold
+	}
+	if o.HexThreshold == 0 {
+		o.HexThreshold = DefaultHexThreshold
+	}
+	if o.MinLength == 0 {
+		o.MinLength = DefaultEntropyLength
+	}
+	return o
+}
+
+var (
+	base64Token = regexp.MustCompile(`[A-Za-z0-9+/_-]+={0,2}`)
+	hexToken    = regexp.MustCompile(`^[0-9A-Fa-f]+$`)
+	// keywordContext matches the end of the text before a token assigned to
+	// a secret-like key
+	keywordContext = regexp.MustCompile(`(?i)((key|token|secret|passw(or)?d|pwd|auth|credentials?)[A-Za-z0-9_.-]*["']?\s*[:=]\s*["']?|bearer\s+)$`)
+)
+
+// shannonEntropy returns the entropy of s in bits per byte.
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	entropy := 0.0
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / float64(len(s))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// entropyMatch is a high entropy token found in a line of text.
+type entropyMatch struct {
+	token   string
+	hex     bool
+	keyword bool
+	entropy float64
+}
+
+// findHighEntropy returns the tokens of line above the thresholds of o.
+func (o EntropyOptions) findHighEntropy(line string) []entropyMatch {
+	var matches []entropyMatch
+	for _, loc := range base64Token.FindAllStringIndex(line, -1) {
+		token := line[loc[0]:loc[1]]
+		if len(token) < o.MinLength {
+			continue
+		}
+		m := entropyMatch{
+			token:   token,
+			hex:     hexToken.MatchString(token),
+			keyword: keywordContext.MatchString(line[:loc[0]]),
+			entropy: shannonEntropy(token),
+		}
+		threshold := o.Base64Threshold
+		if m.hex {
+			threshold = o.HexThreshold
+		}
+		if m.entropy < threshold || (o.RequireKeyword && !m.keyword) {
+			continue
+		}
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// finding describes m as a finding of the given type.
+func (o EntropyOptions) finding(kind, path string, m entropyMatch) Finding {
+	charset, threshold := "base64", o.Base64Threshold
+	if m.hex {
+		charset, threshold = "hex", o.HexThreshold
+	}
+	pattern := fmt.Sprintf("%s entropy >= %.2f, length >= %d", charset, threshold, o.MinLength)
+	if m.keyword {
+		pattern += ", keyword context"
+	}
+	return Finding{
+		Type:        kind,
+		Description: "High entropy " + charset + " string",
+		Pattern:     pattern,
+		Path:        path,
+		Secret:      m.token,
+		Entropy:     math.Round(m.entropy*100) / 100,
+		Validation:  ValidationUnverified,
+	}
+}
+
+// scanEntropy checks a value or command line for high entropy tokens.
+func (s *scan) scanEntropy(kind, path, text string) []Finding {
+	if s.a.opts.Entropy == nil {
+		return nil
+	}
+	o := s.a.opts.Entropy.withDefaults()
+	var findings []Finding
+	for _, m := range o.findHighEntropy(text) {
+		findings = append(findings, o.finding(kind, path, m))
+	}
+	return findings
+}
+
+// scanContent checks the lines of a text file for high entropy tokens.
+// Binary and large files and armored blocks are skipped.
+func (s *scan) scanContent(layerName, name string, hdr *tar.Header, content io.Reader) {
+	if hdr.Size > maxEntropyFileSize {
+		return
+	}
+	data, err := io.ReadAll(content)
+	if err != nil {
+		s.warn("%s: failed to read %s: %v", layerName, name, err)
+		return
+	}
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return
+	}
+	o := s.a.opts.Entropy.withDefaults()
+	seen := make(map[string]bool)
+	armored := false
+	for _, line := range strings.Split(string(data), "\n") {
+		// Skip the base64 bodies of PEM and PGP armored blocks, certificates
+		// and public keys are high entropy by design
+		if strings.HasPrefix(line, "-----BEGIN ") {
+			armored = true
+		} else if strings.HasPrefix(line, "-----END ") {
+			armored = false
+			continue
+		}
+		if armored {
+			continue
+		}
+		for _, m := range o.findHighEntropy(line) {
+			if seen[m.token] {
+				continue
+			}
+			seen[m.token] = true
+			f := o.finding(FindingFileContent, name, m)
+			f.Layer = layerName
+			s.report.Findings = append(s.report.Findings, f)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package analyzer
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const FilePerms = 0700
+
+// ExtractLayers saves the ADD and COPY layers of an analyzed image under
+// dir/<image>, together with a mapping.txt of layer IDs to instructions.
+func (a *Analyzer) ExtractLayers(ctx context.Context, source Source, report *Report, dir string) error {
+	imageStream, err := source.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer imageStream.Close()
+	return a.extractImageLayers(imageStream, filepath.Join(dir, url.QueryEscape(report.Image)), report.History)
+}
+
+func (a *Analyzer) extractImageLayers(imageStream io.Reader, outputDir string, history []History) error {
+	var startAt = 1
+	if a.opts.Verbose {
+		startAt = 0
+	}
+	os.MkdirAll(outputDir, FilePerms)
+	f, err := os.Create(filepath.Join(outputDir, "mapping.txt"))
+	if err != nil {
+		return err
+	}
+	var layersToExtract = make(map[string]int)
+
+	for i := startAt; i < len(history); i++ {
+		if history[i].IsCopy() {
+			layersToExtract[history[i].LayerID] = 1
+			layerID := strings.Split(history[i].LayerID, "/")[0]
+			f.WriteString(fmt.Sprintf("%s:%s\n", layerID, history[i].CreatedBy))
+		}
+	}
+	f.Close()
+
+	tr := tar.NewReader(imageStream)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok := layersToExtract[hdr.Name]; ok {
+			layerID := strings.Split(hdr.Name, "/")[0]
+			os.MkdirAll(filepath.Join(outputDir, layerID), FilePerms)
+			ttr := tar.NewReader(tr)
+			for {
+				hdrr, err := ttr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return fmt.Errorf("failed to read layer %s: %v", layerID, err)
+				}
+				name := hdrr.Name
+				switch hdrr.Typeflag {
+				case tar.TypeDir:
+					os.MkdirAll(filepath.Join(outputDir, layerID, name), FilePerms)
+				case tar.TypeReg:
+					data := make([]byte, hdrr.Size)
+					io.ReadFull(ttr, data)
+					os.WriteFile(filepath.Join(outputDir, layerID, name), data, FilePerms)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ReadFile returns the content of the regular file name in the layer
+// layerID of the image behind source, as found in History.LayerID.
+func (a *Analyzer) ReadFile(ctx context.Context, source Source, layerID, name string) ([]byte, error) {
+	imageStream, err := source.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer imageStream.Close()
+	name = CleanPath(name)
+	tr := tar.NewReader(imageStream)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("layer %s not found", layerID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// OCI layouts name layers after their blob
+		if hdr.Name != layerID && !(strings.HasPrefix(hdr.Name, "blobs/") && filepath.Base(hdr.Name) == layerID) {
+			continue
+		}
+		layer := bufio.NewReader(tr)
+		if magic, _ := layer.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+			zr, err := gzip.NewReader(layer)
+			if err != nil {
+				return nil, err
+			}
+			defer zr.Close()
+			return readLayerFile(zr, layerID, name)
+		}
+		return readLayerFile(layer, layerID, name)
+	}
+}
+
+func readLayerFile(layer io.Reader, layerID, name string) ([]byte, error) {
+	tr := tar.NewReader(layer)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in layer %s", name, layerID)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read layer %s: %v", layerID, err)
+		}
+		if CleanPath(hdr.Name) != name {
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("%s is not a regular file in layer %s", name, layerID)
+		}
+		return io.ReadAll(tr)
+	}
+}
+
+// DumpFile saves a single file of a layer the way ExtractLayers does, under
+// dir/<image>/<layer>, and returns the path written.
+func (a *Analyzer) DumpFile(ctx context.Context, source Source, report *Report, layerID, name, dir string) (string, error) {
+	data, err := a.ReadFile(ctx, source, layerID, name)
+	if err != nil {
+		return "", err
+	}
+	layerDir := strings.Split(layerID, "/")[0]
+	out := filepath.Join(dir, url.QueryEscape(report.Image), layerDir, filepath.FromSlash(CleanPath(name)))
+	if err := os.MkdirAll(filepath.Dir(out), FilePerms); err != nil {
+		return "", err
+	}
+	return out, os.WriteFile(out, data, FilePerms)
+}
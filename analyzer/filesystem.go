@@ -0,0 +1,82 @@
+package analyzer
+
+import (
+	"path"
+	"strings"
+)
+
+// Whiteout markers used by layer tarballs to delete files of lower layers
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// MergedFile is a file of the final image filesystem.
+type MergedFile struct {
+	File
+	// History is the index in Report.History of the entry whose layer
+	// provides the file.
+	History int
+}
+
+// Filesystem applies the layers of the report in order, honoring whiteouts,
+// and returns the resulting filesystem keyed by cleaned path.
+func (r *Report) Filesystem() map[string]MergedFile {
+	return r.FilesystemAt(len(r.History) - 1)
+}
+
+// FilesystemAt returns the filesystem as it is after the history entry at
+// index n, empty for a negative n.
+func (r *Report) FilesystemAt(n int) map[string]MergedFile {
+	fs := make(map[string]MergedFile)
+	for i, h := range r.History[:max(0, min(n+1, len(r.History)))] {
+		// Whiteouts only hide lower layers, so apply them before the layer's
+		// own files whatever their order in the tar.
+		for _, f := range h.Files {
+			name := CleanPath(f.Path)
+			dir, base := path.Split(name)
+			switch {
+			case base == whiteoutOpaque:
+				removeTree(fs, strings.TrimSuffix(dir, "/"), false)
+			case strings.HasPrefix(base, whiteoutPrefix):
+				removeTree(fs, dir+strings.TrimPrefix(base, whiteoutPrefix), true)
+			}
+		}
+		for _, f := range h.Files {
+			name := CleanPath(f.Path)
+			if name == "" || IsWhiteout(name) {
+				continue
+			}
+			f.Path = name
+			fs[name] = MergedFile{File: f, History: i}
+		}
+	}
+	return fs
+}
+
+// CleanPath normalizes a tar entry name such as "./etc/passwd" or "etc/" to
+// the form used by Filesystem, here "etc/passwd" and "etc".
+func CleanPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// IsWhiteout reports whether name is a whiteout marker rather than a file.
+func IsWhiteout(name string) bool {
+	return strings.HasPrefix(path.Base(name), whiteoutPrefix)
+}
+
+// removeTree deletes everything below dir, and dir itself when self is set.
+func removeTree(fs map[string]MergedFile, dir string, self bool) {
+	if self {
+		delete(fs, dir)
+	}
+	prefix := dir + "/"
+	if dir == "" {
+		prefix = ""
+	}
+	for name := range fs {
+		if strings.HasPrefix(name, prefix) && name != dir {
+			delete(fs, name)
+		}
+	}
+}
@@ -0,0 +1,668 @@
+package analyzer
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FindingGitHistory is the type of findings in the objects of a .git
+// directory, such as files deleted from the working tree in a later commit.
+const FindingGitHistory = "GitHistory"
+
+// maxGitFileSize is the size of the largest file of a .git directory read,
+// which bounds the size of the pack files parsed.
+const maxGitFileSize = 64 << 20
+
+// maxGitObjectSize is the size of the largest object of a pack kept.
+const maxGitObjectSize = 16 << 20
+
+// maxGitInflated bounds the bytes inflated from the objects of a repository,
+// as deltas let a small pack expand to many large objects.
+const maxGitInflated = 4 * maxGitFileSize
+
+// errGitBudget stops reading the objects of a repository once they inflate
+// to more than its budget.
+var errGitBudget = errors.New("objects inflate to more than the limit")
+
+// gitBudget counts down the bytes the objects of a repository may still
+// inflate to.
+type gitBudget int64
+
+// spend takes n bytes from b, reporting false when b has fewer left.
+func (b *gitBudget) spend(n int) bool {
+	if int64(n) > int64(*b) {
+		*b = 0
+		return false
+	}
+	*b -= gitBudget(n)
+	return true
+}
+
+// GitRepo is a .git directory found in a layer.
+type GitRepo struct {
+	// Path is the .git directory, such as app/.git
+	Path  string `json:"path"`
+	Layer string `json:"layer"`
+	// Head is the branch HEAD points to, or the commit when it is detached
+	Head string `json:"head,omitempty"`
+	// Remotes lists the remotes of .git/config. Passwords in their URLs
+	// are masked and reported as findings.
+	Remotes []GitRemote `json:"remotes,omitempty"`
+	// Commits lists the commits of the objects of the repository, newest
+	// first
+	Commits []GitCommit `json:"commits,omitempty"`
+	// Objects is the number of objects read from loose objects and packs
+	Objects int `json:"objects"`
+}
+
+// GitRemote is a remote of a .git/config file.
+type GitRemote struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// GitCommit is a commit found in the objects of a repository.
+type GitCommit struct {
+	Hash    string `json:"hash"`
+	Author  string `json:"author"`
+	Date    string `json:"date"`
+	Subject string `json:"subject"`
+}
+
+// gitPath splits name into the .git directory holding it and its path in
+// that directory. ok is false for files outside of .git directories.
+func gitPath(name string) (dir, rel string, ok bool) {
+	name = CleanPath(name)
+	if name == ".git" || strings.HasSuffix(name, "/.git") {
+		return name, "", true
+	}
+	if strings.HasPrefix(name, ".git/") {
+		return ".git", name[len(".git/"):], true
+	}
+	if i := strings.Index(name, "/.git/"); i >= 0 {
+		return name[:i+len("/.git")], name[i+len("/.git/"):], true
+	}
+	return "", "", false
+}
+
+// gitFileWanted reports whether the file at rel in a .git directory is
+// read: the configuration, references and objects.
+func gitFileWanted(rel string) bool {
+	switch {
+	case rel == "config", rel == "HEAD", rel == "packed-refs":
+		return true
+	case strings.HasPrefix(rel, "refs/"):
+		return true
+	case strings.HasPrefix(rel, "objects/pack/"):
+		return strings.HasSuffix(rel, ".pack")
+	case strings.HasPrefix(rel, "objects/"):
+		return len(rel) == len("objects/")+2+1+38
+	}
+	return false
+}
+
+// readGitFile keeps the file at rel of the .git directory dir of layerName
+// until the whole layer is read.
+func (s *scan) readGitFile(layerName, dir, rel string, size int64, r io.Reader) {
+	repos := s.gitDirs[layerName]
+	if repos == nil {
+		repos = make(map[string]map[string][]byte)
+		s.gitDirs[layerName] = repos
+	}
+	if repos[dir] == nil {
+		repos[dir] = make(map[string][]byte)
+	}
+	if rel == "" || !gitFileWanted(rel) {
+		return
+	}
+	if size > maxGitFileSize {
+		s.warn("%s: %s/%s is too large to read", layerName, dir, rel)
+		return
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		s.warn("%s: failed to read %s/%s: %v", layerName, dir, rel, err)
+		return
+	}
+	repos[dir][rel] = data
+}
+
+// scanGitRepos reads the .git directories of layerName once the layer is
+// read: it reports the remotes and credentials of their configuration,
+// lists the commits of their objects and scans the blobs of their history
+// with the content patterns.
+func (s *scan) scanGitRepos(layerName string) {
+	repos := s.gitDirs[layerName]
+	delete(s.gitDirs, layerName)
+	for _, dir := range sortedKeys(repos) {
+		files := repos[dir]
+		repo := GitRepo{Path: dir, Layer: layerName}
+		if head, ok := files["HEAD"]; ok {
+			ref := strings.TrimSpace(string(head))
+			repo.Head = strings.TrimPrefix(strings.TrimPrefix(ref, "ref: "), "refs/heads/")
+		}
+		if config, ok := files["config"]; ok {
+			repo.Remotes = s.scanGitConfig(layerName, dir+"/config", config)
+		}
+		objects := make(map[string]gitObject)
+		budget := gitBudget(maxGitInflated)
+		for _, rel := range sortedKeys(files) {
+			var err error
+			switch {
+			case strings.HasPrefix(rel, "objects/pack/"):
+				err = readPack(files[rel], objects, &budget)
+			case strings.HasPrefix(rel, "objects/"):
+				err = readLooseObject(strings.ReplaceAll(rel[len("objects/"):], "/", ""), files[rel], objects, &budget)
+			}
+			if errors.Is(err, errGitBudget) {
+				s.warn("%s: %s: stopped reading objects at %s, they inflate to more than %d MiB", layerName, dir, rel, maxGitInflated>>20)
+				break
+			}
+			if err != nil {
+				s.warn("%s: %s/%s: %v", layerName, dir, rel, err)
+			}
+		}
+		repo.Objects = len(objects)
+		commits := gitCommits(objects)
+		for _, c := range commits {
+			repo.Commits = append(repo.Commits, c.GitCommit)
+		}
+		s.scanGitHistory(layerName, dir, objects, commits)
+		s.report.GitRepos = append(s.report.GitRepos, repo)
+	}
+}
+
+// scanGitConfig returns the remotes of a .git/config file and reports the
+// passwords in URLs and the authorization headers it holds, such as the
+// token actions/checkout persists.
+func (s *scan) scanGitConfig(layerName, name string, data []byte) []GitRemote {
+	var remotes []GitRemote
+	add := func(f Finding) {
+		f.Layer = layerName
+		s.report.Findings = append(s.report.Findings, f)
+	}
+	// report records secret, described by the first validated pattern it
+	// matches if any
+	report := func(secret, description, pattern string) {
+		f, ok := s.matchPattern(FindingFileContent, name, secret)
+		if !ok {
+			f = Finding{Type: FindingFileContent, Description: description, Pattern: pattern, Path: name, Secret: secret, Validation: ValidationUnverified}
+		}
+		add(f)
+	}
+	// maskURL reports the credentials of a URL and returns the URL with
+	// them masked
+	maskURL := func(raw string) string {
+		u, err := url.Parse(raw)
+		if err != nil || u.User == nil {
+			return raw
+		}
+		if password, ok := u.User.Password(); ok && password != "" {
+			report(password, "Credentials in git remote URL", "git config url")
+			return u.Redacted()
+		}
+		// Tokens are also given as the user name alone, as in
+		// https://ghp_...@github.com/, but most user names are no secret
+		if f, ok := s.matchPattern(FindingFileContent, name, u.User.Username()); ok {
+			add(f)
+			u.User = url.User("xxxxx")
+			return u.String()
+		}
+		return raw
+	}
+	var section, subsection string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section, subsection, _ = strings.Cut(strings.TrimSpace(line[1:len(line)-1]), " ")
+			section = strings.ToLower(section)
+			subsection = strings.Trim(strings.TrimSpace(subsection), `"`)
+			// insteadOf rewrites put the URL in the section name
+			if section == "url" {
+				maskURL(subsection)
+			}
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		switch {
+		case section == "remote" && key == "url":
+			remotes = append(remotes, GitRemote{Name: subsection, URL: maskURL(value)})
+		case section == "http" && key == "extraheader":
+			// AUTHORIZATION: basic <token>
+			if _, credentials, ok := strings.Cut(value, ":"); ok {
+				if fields := strings.Fields(credentials); len(fields) > 0 {
+					report(fields[len(fields)-1], "Git HTTP authorization header", "git config http.extraheader")
+				}
+			}
+		}
+	}
+	return remotes
+}
+
+// gitObject is an object of a repository.
+type gitObject struct {
+	typ  string
+	data []byte
+}
+
+// gitObjectTypes names the object types of pack entries.
+var gitObjectTypes = map[byte]string{1: "commit", 2: "tree", 3: "blob", 4: "tag"}
+
+// Delta entry types of packs
+const (
+	packOfsDelta = 6
+	packRefDelta = 7
+)
+
+// gitHash returns the ID of an object.
+func gitHash(typ string, data []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s %d\x00", typ, len(data))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// readLooseObject adds the loose object hash, zlib compressed in data, to
+// objects, taking its size from budget.
+func readLooseObject(hash string, data []byte, objects map[string]gitObject, budget *gitBudget) error {
+	raw, _, err := inflate(data, maxGitObjectSize)
+	if err != nil {
+		return err
+	}
+	if !budget.spend(len(raw)) {
+		return errGitBudget
+	}
+	header, body, ok := bytes.Cut(raw, []byte{0})
+	if !ok {
+		return errors.New("invalid object header")
+	}
+	typ, _, _ := strings.Cut(string(header), " ")
+	objects[hash] = gitObject{typ: typ, data: body}
+	return nil
+}
+
+// packEntry is an entry of a pack file before its deltas are resolved.
+type packEntry struct {
+	typ    byte
+	data   []byte
+	base   int    // offset of the base of an offset delta
+	ref    string // hash of the base of a reference delta
+	object *gitObject
+}
+
+// readPack adds the objects of a pack file to objects, applying deltas.
+// Objects larger than maxGitObjectSize are skipped, and reading stops with
+// errGitBudget once the entries and the objects rebuilt from deltas inflate
+// to more than budget.
+func readPack(data []byte, objects map[string]gitObject, budget *gitBudget) error {
+	if len(data) < 12 || string(data[:4]) != "PACK" {
+		return errors.New("not a pack file")
+	}
+	if v := binary.BigEndian.Uint32(data[4:]); v != 2 && v != 3 {
+		return fmt.Errorf("unsupported pack version %d", v)
+	}
+	count := int(binary.BigEndian.Uint32(data[8:]))
+	entries := make(map[int]*packEntry)
+	var order []int
+	pos := 12
+	for i := 0; i < count; i++ {
+		start := pos
+		if pos >= len(data) {
+			return errors.New("truncated pack")
+		}
+		c := data[pos]
+		pos++
+		e := &packEntry{typ: (c >> 4) & 7}
+		for c&0x80 != 0 && pos < len(data) {
+			c = data[pos]
+			pos++
+		}
+		switch e.typ {
+		case packOfsDelta:
+			if pos >= len(data) {
+				return errors.New("truncated pack")
+			}
+			c = data[pos]
+			pos++
+			off := int(c & 0x7f)
+			for c&0x80 != 0 && pos < len(data) && off <= start {
+				c = data[pos]
+				pos++
+				off = (off+1)<<7 | int(c&0x7f)
+			}
+			e.base = start - off
+		case packRefDelta:
+			if pos+20 > len(data) {
+				return errors.New("truncated pack")
+			}
+			e.ref = hex.EncodeToString(data[pos : pos+20])
+			pos += 20
+		}
+		body, n, err := inflate(data[pos:], maxGitObjectSize)
+		if err != nil && !errors.Is(err, errObjectTooLarge) {
+			return err
+		}
+		pos += n
+		if err == nil {
+			if !budget.spend(len(body)) {
+				return errGitBudget
+			}
+			e.data = body
+			entries[start] = e
+			order = append(order, start)
+		}
+	}
+
+	// Offset deltas follow their base, reference deltas may not
+	for resolved := true; resolved; {
+		resolved = false
+		for _, off := range order {
+			e := entries[off]
+			if e.object != nil {
+				continue
+			}
+			var base *gitObject
+			switch e.typ {
+			case packOfsDelta:
+				if b, ok := entries[e.base]; ok {
+					base = b.object
+				}
+				if base == nil {
+					continue
+				}
+			case packRefDelta:
+				b, ok := objects[e.ref]
+				if !ok {
+					continue
+				}
+				base = &b
+			default:
+				typ, ok := gitObjectTypes[e.typ]
+				if !ok {
+					e.object = &gitObject{}
+					continue
+				}
+				e.object = &gitObject{typ: typ, data: e.data}
+				objects[gitHash(typ, e.data)] = *e.object
+				resolved = true
+				continue
+			}
+			body, err := applyDelta(base.data, e.data)
+			if err != nil {
+				e.object = &gitObject{}
+				continue
+			}
+			if !budget.spend(len(body)) {
+				return errGitBudget
+			}
+			e.object = &gitObject{typ: base.typ, data: body}
+			if base.typ != "" {
+				objects[gitHash(base.typ, body)] = *e.object
+			}
+			resolved = true
+		}
+	}
+	return nil
+}
+
+var errObjectTooLarge = errors.New("object too large")
+
+// inflate decompresses the zlib stream at the start of data, returning it
+// and the number of bytes of data it spans. Streams inflating to more than
+// limit bytes are read through and errObjectTooLarge returned.
+func inflate(data []byte, limit int64) ([]byte, int, error) {
+	r := bytes.NewReader(data)
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	body, err := io.ReadAll(io.LimitReader(zr, limit+1))
+	if err != nil {
+		return nil, 0, err
+	}
+	if int64(len(body)) > limit {
+		if _, err := io.Copy(io.Discard, zr); err != nil {
+			return nil, 0, err
+		}
+		return nil, len(data) - r.Len(), errObjectTooLarge
+	}
+	// Read the checksum so the stream is consumed whole
+	if _, err := io.Copy(io.Discard, zr); err != nil {
+		return nil, 0, err
+	}
+	return body, len(data) - r.Len(), nil
+}
+
+// applyDelta rebuilds an object from its base and a delta of copy and
+// insert instructions.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	errInvalid := errors.New("invalid delta")
+	pos := 0
+	varint := func() int {
+		n, shift := 0, 0
+		for pos < len(delta) {
+			c := delta[pos]
+			pos++
+			n |= int(c&0x7f) << shift
+			shift += 7
+			if c&0x80 == 0 || shift > 56 {
+				break
+			}
+		}
+		return n
+	}
+	if varint() != len(base) {
+		return nil, errInvalid
+	}
+	size := varint()
+	if size > maxGitObjectSize {
+		return nil, errObjectTooLarge
+	}
+	out := make([]byte, 0, size)
+	for pos < len(delta) {
+		op := delta[pos]
+		pos++
+		switch {
+		case op&0x80 != 0:
+			var off, n int
+			for i := 0; i < 7; i++ {
+				if op&(1<<uint(i)) == 0 {
+					continue
+				}
+				if pos >= len(delta) {
+					return nil, errInvalid
+				}
+				if i < 4 {
+					off |= int(delta[pos]) << (8 * i)
+				} else {
+					n |= int(delta[pos]) << (8 * (i - 4))
+				}
+				pos++
+			}
+			if n == 0 {
+				n = 0x10000
+			}
+			if off+n > len(base) || len(out)+n > size {
+				return nil, errInvalid
+			}
+			out = append(out, base[off:off+n]...)
+		case op != 0:
+			n := int(op)
+			if pos+n > len(delta) || len(out)+n > size {
+				return nil, errInvalid
+			}
+			out = append(out, delta[pos:pos+n]...)
+			pos += n
+		default:
+			return nil, errInvalid
+		}
+	}
+	if len(out) != size {
+		return nil, errInvalid
+	}
+	return out, nil
+}
+
+// gitCommitObject is a parsed commit and the tree it points to.
+type gitCommitObject struct {
+	GitCommit
+	tree string
+	time int64
+}
+
+// gitCommits parses the commits of objects, newest first.
+func gitCommits(objects map[string]gitObject) []gitCommitObject {
+	var commits []gitCommitObject
+	for hash, o := range objects {
+		if o.typ != "commit" {
+			continue
+		}
+		c := gitCommitObject{GitCommit: GitCommit{Hash: hash}}
+		header, message, _ := strings.Cut(string(o.data), "\n\n")
+		for _, line := range strings.Split(header, "\n") {
+			key, value, _ := strings.Cut(line, " ")
+			switch key {
+			case "tree":
+				c.tree = value
+			case "author":
+				c.Author, c.Date, _ = parseGitSignature(value)
+			case "committer":
+				_, _, c.time = parseGitSignature(value)
+			}
+		}
+		c.Subject, _, _ = strings.Cut(strings.TrimSpace(message), "\n")
+		commits = append(commits, c)
+	}
+	sort.Slice(commits, func(i, j int) bool {
+		if commits[i].time != commits[j].time {
+			return commits[i].time > commits[j].time
+		}
+		return commits[i].Hash < commits[j].Hash
+	})
+	return commits
+}
+
+// parseGitSignature splits "Name <email> 1700000000 +0100" into the name
+// and email, the time formatted as RFC 3339 and the Unix time.
+func parseGitSignature(sig string) (who, date string, unix int64) {
+	i := strings.LastIndex(sig, ">")
+	if i < 0 {
+		return sig, "", 0
+	}
+	who = sig[:i+1]
+	fields := strings.Fields(sig[i+1:])
+	if len(fields) == 0 {
+		return who, "", 0
+	}
+	unix, _ = strconv.ParseInt(fields[0], 10, 64)
+	t := time.Unix(unix, 0).UTC()
+	if len(fields) > 1 {
+		if offset, err := time.Parse("-0700", fields[1]); err == nil {
+			_, secs := offset.Zone()
+			t = t.In(time.FixedZone(fields[1], secs))
+		}
+	}
+	return who, t.Format(time.RFC3339), unix
+}
+
+// scanGitHistory scans the blobs of objects with the content patterns. A
+// blob is named after the newest commit whose tree holds it, as in
+// app/.git!/3f2a1b0c9d8e:config/secrets.yml, or after its own hash when no
+// commit does. Each secret is reported once per repository.
+func (s *scan) scanGitHistory(layerName, dir string, objects map[string]gitObject, commits []gitCommitObject) {
+	names := make(map[string]string)
+	visited := make(map[string]bool)
+	var walk func(tree, prefix, commit string)
+	walk = func(tree, prefix, commit string) {
+		if visited[tree] {
+			return
+		}
+		visited[tree] = true
+		for _, e := range parseTree(objects[tree].data) {
+			switch {
+			case e.mode == "40000":
+				walk(e.hash, prefix+e.name+"/", commit)
+			case e.mode == "160000":
+				// Submodule commits are in another repository
+			default:
+				if _, ok := names[e.hash]; !ok {
+					names[e.hash] = commit + ":" + prefix + e.name
+				}
+			}
+		}
+	}
+	for _, c := range commits {
+		walk(c.tree, "", shortID(c.Hash))
+	}
+
+	seen := make(map[string]bool)
+	for _, hash := range sortedKeys(objects) {
+		o := objects[hash]
+		if o.typ != "blob" || len(o.data) > maxEntropyFileSize || bytes.IndexByte(o.data[:min(len(o.data), 8000)], 0) >= 0 {
+			continue
+		}
+		name, ok := names[hash]
+		if !ok {
+			name = shortID(hash)
+		}
+		text := string(o.data)
+		for _, p := range s.a.patterns {
+			if p.SecretType != "FileContent" {
+				continue
+			}
+			for _, match := range p.Regex.FindAllString(text, -1) {
+				match = strings.TrimSpace(match)
+				if match == "" || seen[p.Description+"\x00"+match] {
+					continue
+				}
+				seen[p.Description+"\x00"+match] = true
+				s.report.Findings = append(s.report.Findings, Finding{
+					Type:        FindingGitHistory,
+					Description: p.Description,
+					Pattern:     p.Value,
+					Path:        dir + "!/" + name,
+					Layer:       layerName,
+					Secret:      match,
+					Validation:  p.validate(match),
+				})
+			}
+		}
+	}
+}
+
+// treeEntry is an entry of a tree object.
+type treeEntry struct {
+	mode, name, hash string
+}
+
+// parseTree returns the entries of a tree object, stopping at the first
+// malformed one.
+func parseTree(data []byte) []treeEntry {
+	var entries []treeEntry
+	for len(data) > 0 {
+		header, rest, ok := bytes.Cut(data, []byte{0})
+		if !ok || len(rest) < 20 {
+			break
+		}
+		mode, name, _ := strings.Cut(string(header), " ")
+		entries = append(entries, treeEntry{mode: mode, name: name, hash: hex.EncodeToString(rest[:20])})
+		data = rest[20:]
+	}
+	return entries
+}
@@ -0,0 +1,233 @@
+package analyzer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Kinds of hardening issues
+const (
+	HardeningSetuid             = "setuid"
+	HardeningSetgid             = "setgid"
+	HardeningWorldWritable      = "world-writable"
+	HardeningUnknownOwner       = "unknown-owner"
+	HardeningWritableExecutable = "writable-executable"
+	HardeningCapabilities       = "capabilities"
+)
+
+// capabilityXattr is the PAX record holding the file capabilities of an
+// entry, a vfs_cap_data structure.
+const capabilityXattr = "SCHILY.xattr.security.capability"
+
+// HardeningIssue is a file of the final filesystem whose permissions or
+// ownership let a compromised process escalate or persist.
+type HardeningIssue struct {
+	Kind string `json:"kind"`
+	Path string `json:"path"`
+	// Layer and Instruction identify where the file was last written
+	Layer       string `json:"layer"`
+	Instruction string `json:"instruction"`
+	// Mode is the mode of the file as printed by ls -l
+	Mode string `json:"mode"`
+	UID  int    `json:"uid"`
+	GID  int    `json:"gid"`
+	// Detail explains the issue, such as the capabilities granted or the
+	// writable directory an executable is in
+	Detail string `json:"detail,omitempty"`
+}
+
+// checkHardening inspects the final filesystem for setuid and setgid files,
+// world-writable files and directories without the sticky bit, files owned
+// by UIDs absent from etc/passwd, executables the user of the image can
+// replace and files granted capabilities.
+func (s *scan) checkHardening(fs map[string]MergedFile) []HardeningIssue {
+	users, groups := s.imageUsers(fs)
+	known := make(map[int]bool)
+	for _, u := range users {
+		known[u.UID] = true
+	}
+	resolved := resolveUser(s.report.Metadata.User, users, groups)
+	uid, gid := resolved.UID, resolved.GID
+	user := s.report.Metadata.User
+	if user == "" {
+		user = "root"
+	}
+
+	paths := make([]string, 0, len(fs))
+	for p := range fs {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	var issues []HardeningIssue
+	for _, p := range paths {
+		f := fs[p]
+		h := s.report.History[f.History]
+		add := func(kind, detail string) {
+			issues = append(issues, HardeningIssue{
+				Kind:        kind,
+				Path:        p,
+				Layer:       h.LayerID,
+				Instruction: h.Instruction(),
+				Mode:        lsMode(f.Mode),
+				UID:         f.UID,
+				GID:         f.GID,
+				Detail:      detail,
+			})
+		}
+		regular, dir := f.Mode.IsRegular(), f.Mode.IsDir()
+		if !regular && !dir {
+			// Symbolic links are always 0777 and devices are rare
+			continue
+		}
+		if regular && f.Mode&os.ModeSetuid != 0 {
+			add(HardeningSetuid, fmt.Sprintf("runs as UID %d", f.UID))
+		}
+		if regular && f.Mode&os.ModeSetgid != 0 {
+			add(HardeningSetgid, fmt.Sprintf("runs as GID %d", f.GID))
+		}
+		if f.Mode.Perm()&0002 != 0 && !(dir && f.Mode&os.ModeSticky != 0) {
+			add(HardeningWorldWritable, "")
+		}
+		if len(users) > 0 && !known[f.UID] {
+			add(HardeningUnknownOwner, fmt.Sprintf("no user of etc/passwd has UID %d", f.UID))
+		}
+		if f.Capabilities != "" {
+			add(HardeningCapabilities, f.Capabilities)
+		}
+		if regular && f.Mode.Perm()&0111 != 0 {
+			if where := replaceableBy(fs, p, f.File, uid, gid); where != "" {
+				add(HardeningWritableExecutable, fmt.Sprintf("%s can be replaced by user %s", where, user))
+			}
+		}
+	}
+	return issues
+}
+
+// replaceableBy returns the path through which the user uid:gid can
+// replace the executable at name: the file itself, or a directory above it
+// that the user can write. World-writable files are reported as such.
+func replaceableBy(fs map[string]MergedFile, name string, f File, uid, gid int) string {
+	if f.Mode.Perm()&0002 == 0 && writableBy(f, uid, gid) {
+		return name
+	}
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		d, ok := fs[dir]
+		if !ok || !d.Mode.IsDir() || !writableBy(d.File, uid, gid) {
+			continue
+		}
+		// Only owners can replace the files of a sticky directory
+		if d.Mode&os.ModeSticky != 0 && f.UID != uid {
+			continue
+		}
+		return dir + "/"
+	}
+	return ""
+}
+
+// writableBy reports whether the user uid:gid can write f. Root can write
+// anything, so only world-writable files count for it.
+func writableBy(f File, uid, gid int) bool {
+	perm := f.Mode.Perm()
+	if perm&0002 != 0 {
+		return true
+	}
+	if uid == 0 {
+		return false
+	}
+	return (f.UID == uid && perm&0200 != 0) || (f.GID == gid && perm&0020 != 0)
+}
+
+// lsMode formats a mode the way ls -l does, as in -rwsr-xr-x.
+func lsMode(m os.FileMode) string {
+	b := []byte("----------")
+	switch {
+	case m.IsDir():
+		b[0] = 'd'
+	case m&os.ModeSymlink != 0:
+		b[0] = 'l'
+	}
+	for i, c := range "rwxrwxrwx" {
+		if m&(1<<uint(8-i)) != 0 {
+			b[i+1] = byte(c)
+		}
+	}
+	special := func(i int, set bool, exec, noExec byte) {
+		if !set {
+			return
+		}
+		if b[i] == 'x' {
+			b[i] = exec
+		} else {
+			b[i] = noExec
+		}
+	}
+	special(3, m&os.ModeSetuid != 0, 's', 'S')
+	special(6, m&os.ModeSetgid != 0, 's', 'S')
+	special(9, m&os.ModeSticky != 0, 't', 'T')
+	return string(b)
+}
+
+// capabilityNames are the Linux capabilities by bit number.
+var capabilityNames = []string{
+	"cap_chown", "cap_dac_override", "cap_dac_read_search", "cap_fowner",
+	"cap_fsetid", "cap_kill", "cap_setgid", "cap_setuid", "cap_setpcap",
+	"cap_linux_immutable", "cap_net_bind_service", "cap_net_broadcast",
+	"cap_net_admin", "cap_net_raw", "cap_ipc_lock", "cap_ipc_owner",
+	"cap_sys_module", "cap_sys_rawio", "cap_sys_chroot", "cap_sys_ptrace",
+	"cap_sys_pacct", "cap_sys_admin", "cap_sys_boot", "cap_sys_nice",
+	"cap_sys_resource", "cap_sys_time", "cap_sys_tty_config", "cap_mknod",
+	"cap_lease", "cap_audit_write", "cap_audit_control", "cap_setfcap",
+	"cap_mac_override", "cap_mac_admin", "cap_syslog", "cap_wake_alarm",
+	"cap_block_suspend", "cap_audit_read", "cap_perfmon", "cap_bpf",
+	"cap_checkpoint_restore",
+}
+
+// decodeCapabilities formats a security.capability xattr like getcap, as in
+// cap_net_bind_service=ep.
+func decodeCapabilities(data []byte) string {
+	if len(data) < 12 {
+		return "invalid capability data"
+	}
+	magic := binary.LittleEndian.Uint32(data)
+	permitted := uint64(binary.LittleEndian.Uint32(data[4:]))
+	inheritable := uint64(binary.LittleEndian.Uint32(data[8:]))
+	// Revisions 2 and 3 add the upper 32 capabilities
+	if magic&0xff000000 != 0x01000000 && len(data) >= 20 {
+		permitted |= uint64(binary.LittleEndian.Uint32(data[12:])) << 32
+		inheritable |= uint64(binary.LittleEndian.Uint32(data[16:])) << 32
+	}
+	var parts []string
+	flags := "p"
+	if magic&1 != 0 {
+		flags = "ep"
+	}
+	if permitted != 0 {
+		parts = append(parts, capabilitySet(permitted)+"="+flags)
+	}
+	if inheritable != 0 {
+		parts = append(parts, capabilitySet(inheritable)+"+i")
+	}
+	if len(parts) == 0 {
+		return "no capabilities"
+	}
+	return strings.Join(parts, " ")
+}
+
+func capabilitySet(bits uint64) string {
+	var names []string
+	for i := 0; i < 64; i++ {
+		if bits&(1<<uint(i)) == 0 {
+			continue
+		}
+		if i < len(capabilityNames) {
+			names = append(names, capabilityNames[i])
+		} else {
+			names = append(names, fmt.Sprintf("cap_%d", i))
+		}
+	}
+	return strings.Join(names, ",")
+}
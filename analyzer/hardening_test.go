@@ -0,0 +1,105 @@
+package analyzer
+
+import (
+	"archive/tar"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHardening(t *testing.T) {
+	const passwd = "root:x:0:0:root:/root:/bin/sh\napp:x:1000:1000::/app:/bin/sh\n"
+	// cap_net_bind_service and cap_net_raw, effective, revision 2
+	caps := string([]byte{0x01, 0x00, 0x00, 0x02, 0x00, 0x24, 0x00, 0x00, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	config := `{
+		"config": {"User": "app"},
+		"history": [
+			{"created_by": "/bin/sh -c #(nop) ADD file:abc in / "},
+			{"created_by": "/bin/sh -c chmod u+s /usr/bin/helper"},
+			{"created_by": "COPY --chown=app dir:123 in /app"}
+		]
+	}`
+	data := dockerArchive(t, config,
+		[]testEntry{
+			{hdr: tar.Header{Name: "etc/passwd"}, body: passwd},
+			{hdr: tar.Header{Name: "tmp/", Typeflag: tar.TypeDir, Mode: 01777}},
+			{hdr: tar.Header{Name: "usr/bin/passwd", Mode: 04755}},
+			{hdr: tar.Header{Name: "usr/bin/helper", Mode: 0755}},
+			{hdr: tar.Header{Name: "usr/bin/ping", Mode: 0755, PAXRecords: map[string]string{capabilityXattr: caps}}},
+			{hdr: tar.Header{Name: "var/log/app.log", Mode: 0666}},
+			{hdr: tar.Header{Name: "bin/sh", Typeflag: tar.TypeSymlink, Linkname: "busybox", Mode: 0777}},
+		},
+		[]testEntry{
+			{hdr: tar.Header{Name: "usr/bin/helper", Mode: 06755}},
+		},
+		[]testEntry{
+			{hdr: tar.Header{Name: "app/", Typeflag: tar.TypeDir, Mode: 0755, Uid: 1000, Gid: 1000}},
+			{hdr: tar.Header{Name: "app/run.sh", Mode: 0755}},
+			{hdr: tar.Header{Name: "app/data", Mode: 0644, Uid: 1500}},
+			{hdr: tar.Header{Name: "tmp/tool", Mode: 0755}},
+			{hdr: tar.Header{Name: "tmp/mine", Mode: 0755, Uid: 1000}},
+		},
+	)
+
+	a := newTestAnalyzer(t, Options{})
+	report, err := a.Analyze(context.Background(), &memorySource{name: "hardening", data: data})
+	if !assert.NoError(t, err) {
+		return
+	}
+	type issue struct{ kind, path, mode, detail, instruction string }
+	var issues []issue
+	for _, i := range report.Hardening {
+		issues = append(issues, issue{i.Kind, i.Path, i.Mode, i.Detail, i.Instruction})
+	}
+	assert.Equal(t, []issue{
+		{HardeningUnknownOwner, "app/data", "-rw-r--r--", "no user of etc/passwd has UID 1500", "COPY --chown=app dir:123 in /app"},
+		{HardeningWritableExecutable, "app/run.sh", "-rwxr-xr-x", "app/ can be replaced by user app", "COPY --chown=app dir:123 in /app"},
+		{HardeningWritableExecutable, "tmp/mine", "-rwxr-xr-x", "tmp/mine can be replaced by user app", "COPY --chown=app dir:123 in /app"},
+		{HardeningSetuid, "usr/bin/helper", "-rwsr-sr-x", "runs as UID 0", "RUN chmod u+s /usr/bin/helper"},
+		{HardeningSetgid, "usr/bin/helper", "-rwsr-sr-x", "runs as GID 0", "RUN chmod u+s /usr/bin/helper"},
+		{HardeningSetuid, "usr/bin/passwd", "-rwsr-xr-x", "runs as UID 0", "ADD file:abc in /"},
+		{HardeningCapabilities, "usr/bin/ping", "-rwxr-xr-x", "cap_net_bind_service,cap_net_raw=ep", "ADD file:abc in /"},
+		{HardeningWorldWritable, "var/log/app.log", "-rw-rw-rw-", "", "ADD file:abc in /"},
+	}, issues, "tmp/tool sits in a sticky directory and is owned by root")
+	assert.Equal(t, "layer1/layer.tar", report.Hardening[3].Layer)
+	assert.Equal(t, 1500, report.Hardening[0].UID)
+}
+
+func TestHardeningRoot(t *testing.T) {
+	// Root can write anything, only world-writable directories make
+	// executables replaceable
+	data := dockerArchive(t, `{"history": [{"created_by": "COPY . /"}]}`, []testEntry{
+		{hdr: tar.Header{Name: "opt/", Typeflag: tar.TypeDir, Mode: 0777}},
+		{hdr: tar.Header{Name: "opt/tool", Mode: 0755}},
+		{hdr: tar.Header{Name: "usr/bin/tool", Mode: 0755, Uid: 1234}},
+	})
+	report, err := newTestAnalyzer(t, Options{}).Analyze(context.Background(), &memorySource{name: "root", data: data})
+	if !assert.NoError(t, err) {
+		return
+	}
+	var kinds []string
+	for _, i := range report.Hardening {
+		kinds = append(kinds, i.Kind+" "+i.Path+" "+i.Detail)
+	}
+	assert.Equal(t, []string{
+		"world-writable opt ",
+		"writable-executable opt/tool opt/ can be replaced by user root",
+	}, kinds, "owners are not checked without etc/passwd")
+}
+
+func TestLsMode(t *testing.T) {
+	assert.Equal(t, "-rwsr-xr-x", lsMode(0755|os.ModeSetuid))
+	assert.Equal(t, "-rwSr--r--", lsMode(0644|os.ModeSetuid))
+	assert.Equal(t, "drwxrwxrwt", lsMode(0777|os.ModeDir|os.ModeSticky))
+	assert.Equal(t, "lrwxrwxrwx", lsMode(0777|os.ModeSymlink))
+}
+
+func TestDecodeCapabilities(t *testing.T) {
+	// Revision 1, permitted cap_chown, not effective
+	assert.Equal(t, "cap_chown=p", decodeCapabilities([]byte{0, 0, 0, 1, 1, 0, 0, 0, 0, 0, 0, 0}))
+	// Revision 3, cap_bpf (bit 39) effective and cap_kill inheritable
+	assert.Equal(t, "cap_bpf=ep cap_kill+i", decodeCapabilities([]byte{1, 0, 0, 3, 0, 0, 0, 0, 0x20, 0, 0, 0, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}))
+	assert.Equal(t, "invalid capability data", decodeCapabilities([]byte{1, 2}))
+}
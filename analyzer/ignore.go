@@ -1,7 +1,8 @@
-package main
-//This file is copied from https://raw.githubusercontent.com/github/linguist/master/lib/linguist/vendor.yml
-//This file filters items that are considered noisey and not useful in most situations.
-var InternalWordlist = []string{
+package analyzer
+
+// This file is copied from https://raw.githubusercontent.com/github/linguist/master/lib/linguist/vendor.yml
+// This file filters items that are considered noisey and not useful in most situations.
+var internalWordlist = []string{
 	".npm/",
 	"usr/share/",
 	"(^|/)cache/",
@@ -161,3 +162,9 @@ var InternalWordlist = []string{
 	"(^|/)\\.google_apis/",
 	"^Jenkinsfile$",
 }
+
+// DefaultIgnorePatterns returns a copy of the built-in noise filter used when
+// Options.IgnorePatterns is empty.
+func DefaultIgnorePatterns() []string {
+	return append([]string(nil), internalWordlist...)
+}
@@ -0,0 +1,597 @@
+package analyzer
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/buger/jsonparser"
+)
+
+type manifest struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// OCI index and manifest entries
+type ociIndex struct {
+	Manifests []ociManifest `json:"manifests"`
+}
+
+type ociManifest struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int    `json:"size"`
+}
+
+// imageConfig is the subset of the image config blob we report on
+type imageConfig struct {
+	Config struct {
+		Env          []string               `json:"Env"`
+		ExposedPorts map[string]interface{} `json:"ExposedPorts"`
+		User         string                 `json:"User"`
+		Labels       map[string]string      `json:"Labels"`
+	} `json:"config"`
+	DockerVersion string `json:"docker_version"`
+}
+
+func (c *imageConfig) metadata() Metadata {
+	return Metadata{
+		Source:        MetadataConfig,
+		DockerVersion: c.DockerVersion,
+		Env:           c.Config.Env,
+		ExposedPorts:  sortedPorts(c.Config.ExposedPorts),
+		User:          c.Config.User,
+		Labels:        c.Config.Labels,
+	}
+}
+
+// analyzeImage walks a docker save or OCI layout tarball, lists the files of
+// every layer and maps them onto the image history.
+func (s *scan) analyzeImage(imageStream io.ReadCloser) ([]History, *imageConfig, string, error) {
+	defer imageStream.Close()
+
+	tr := tar.NewReader(imageStream)
+	var configs []manifest
+	var hist []History
+	var isOCIFormat bool
+	var blobsFound []string
+
+	var imgConfig *imageConfig
+	var ociBlobs = make(map[string][]byte)   // Store all blobs, not just tar files
+	var ociConfigs = make(map[string][]byte) // Store config blobs specifically
+
+	// First pass to determine format and read manifests
+	for {
+		imageFile, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, "", err
+		}
+
+		// Check if this is OCI format and collect all blobs
+		if strings.HasPrefix(imageFile.Name, "blobs/sha256/") && imageFile.Typeflag != tar.TypeDir {
+			isOCIFormat = true
+			blobName := filepath.Base(imageFile.Name)
+			blobsFound = append(blobsFound, blobName)
+
+			// Read all blob data
+			blobData, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, nil, "", fmt.Errorf("failed to read blob data: %v", err)
+			}
+
+			// Store JSON blobs separately for config processing
+			if strings.HasSuffix(blobName, ".json") || containsJSON(blobData) {
+				ociConfigs[blobName] = blobData
+			}
+
+			// Store all non-JSON blobs for layer processing
+			if !strings.HasSuffix(blobName, ".json") {
+				ociBlobs[blobName] = blobData
+			}
+			continue
+		}
+
+		// Handle config files and history
+		if (!isOCIFormat && strings.Contains(imageFile.Name, ".json") && imageFile.Name != "manifest.json") ||
+			(isOCIFormat && strings.HasPrefix(imageFile.Name, "blobs/sha256/")) {
+			jsonBytes, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, nil, "", fmt.Errorf("failed to read config file: %v", err)
+			}
+
+			// Try to get history from the JSON
+			h, dataType, _, err := jsonparser.Get(jsonBytes, "history")
+			if err == nil && dataType == jsonparser.Array {
+				if err := json.Unmarshal(h, &hist); err != nil {
+					return nil, nil, "", fmt.Errorf("unable to parse history from json file: %v", err)
+				}
+			}
+
+			// When handling config files, also try to parse image config
+			var cfg imageConfig
+			if err := json.Unmarshal(jsonBytes, &cfg); err == nil {
+				imgConfig = &cfg
+			}
+		}
+
+		// Handle manifest files
+		if imageFile.Name == "manifest.json" || imageFile.Name == "index.json" {
+			byteValue, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, nil, "", fmt.Errorf("failed to read manifest file: %v", err)
+			}
+
+			if imageFile.Name == "index.json" {
+				// Handle OCI format
+				var index ociIndex
+				if err := json.Unmarshal(byteValue, &index); err != nil {
+					return nil, nil, "", fmt.Errorf("unable to parse OCI index.json: %v", err)
+				}
+				// Convert OCI manifest to our format
+				configs = []manifest{{
+					Config: strings.TrimPrefix(index.Manifests[0].Digest, "sha256:"),
+					Layers: make([]string, 0),
+				}}
+				// We'll populate the layers later from the blobs
+			} else {
+				// Handle Docker format
+				if err := json.Unmarshal(byteValue, &configs); err != nil {
+					return nil, nil, "", fmt.Errorf("unable to parse manifest.json: %v", err)
+				}
+			}
+		}
+
+		// Handle layer files for non-OCI format
+		if !isOCIFormat && strings.Contains(imageFile.Name, "layer.tar") {
+			if s.a.opts.LayerCache != nil {
+				s.readCachedDockerLayer(imageFile.Name, tr)
+			} else {
+				s.readDockerLayer(imageFile.Name, tr)
+			}
+		}
+	}
+
+	// Process all OCI blobs, attempting to treat each as a potential layer
+	if isOCIFormat {
+		s.warn("Processing %d OCI blobs...", len(ociBlobs))
+
+		// First, scan all blobs for secrets
+		for _, blobName := range sortedKeys(ociBlobs) {
+			blobData := ociBlobs[blobName]
+			digest := "sha256:" + blobName
+			if s.restoreLayer(digest, blobName) {
+				continue
+			}
+			m := s.mark()
+			// Try to process each blob as a potential layer
+			layerReader := bytes.NewReader(blobData)
+
+			// Try several approaches to read the blob
+			s.layers[blobName] = make([]File, 0)
+			var processed bool
+
+			// Approach 1: Try as plain tar
+			if !processed {
+				if s.processLayerAsTar(layerReader, blobName, 0) {
+					processed = true
+				}
+				layerReader.Seek(0, io.SeekStart) // Reset for next attempt
+			}
+
+			// Approach 2: Try as gzipped tar - use standard gzip package
+			if !processed {
+				gzipReader, err := gzip.NewReader(layerReader)
+				if err == nil {
+					if s.processLayerAsTar(gzipReader, blobName, int64(len(blobData))) {
+						processed = true
+					}
+					gzipReader.Close()                // Make sure to close the gzip reader
+					layerReader.Seek(0, io.SeekStart) // Reset for next attempt
+				}
+			}
+
+			// Approach 3: Try as raw content for secrets
+			if !processed {
+				// Scan the raw content for secrets
+				rawContent := string(blobData)
+				lines := strings.Split(rawContent, "\n")
+				for _, line := range lines {
+					if !s.a.ignored(line) && len(line) > 5 { // Skip very short lines
+						s.checkingNames()
+						s.scanFilename(line, blobName)
+					}
+				}
+			}
+			s.storeLayer(digest, blobName, m)
+		}
+	}
+
+	// For OCI format, specifically look for config with history
+	if isOCIFormat && len(hist) == 0 {
+		s.warn("Looking for history in OCI config files...")
+		for _, blobName := range sortedKeys(ociConfigs) {
+			jsonData := ociConfigs[blobName]
+			// Try to extract history from each config blob
+			h, dataType, _, err := jsonparser.Get(jsonData, "history")
+			if err == nil && dataType == jsonparser.Array {
+				if err := json.Unmarshal(h, &hist); err == nil {
+					s.warn("Found history in %s", blobName)
+					break
+				}
+			}
+		}
+
+		// If still no history, try once more with a full JSON decode approach
+		if len(hist) == 0 {
+			for _, jsonData := range ociConfigs {
+				var configObj map[string]interface{}
+				if err := json.Unmarshal(jsonData, &configObj); err == nil {
+					if historyArr, ok := configObj["history"].([]interface{}); ok {
+						s.warn("Found %d history entries using alternate approach", len(historyArr))
+						// Convert to our history format
+						for _, item := range historyArr {
+							if histItem, ok := item.(map[string]interface{}); ok {
+								histEntry := History{}
+								if created, ok := histItem["created"].(string); ok {
+									histEntry.Created = created
+								}
+								if createdBy, ok := histItem["created_by"].(string); ok {
+									histEntry.CreatedBy = createdBy
+								}
+								if emptyLayer, ok := histItem["empty_layer"].(bool); ok {
+									histEntry.EmptyLayer = emptyLayer
+								}
+								hist = append(hist, histEntry)
+							}
+						}
+						break
+					}
+				}
+			}
+		}
+	}
+
+	// If we still have no history in OCI format, generate a basic one
+	if isOCIFormat && len(hist) == 0 {
+		s.warn("No history found in image, generating basic history")
+		// Create some placeholder history
+		hist = append(hist, History{
+			Created:   "unknown",
+			CreatedBy: "FROM base image",
+		})
+	}
+
+	if s.report.Metadata.ID == "" {
+		s.report.Metadata.ID = configDigest(configs, ociConfigs)
+	}
+
+	if isOCIFormat && len(configs) == 0 {
+		return nil, nil, "", fmt.Errorf("no manifest.json or index.json found in image")
+	}
+
+	// An OCI layout without manifest.json lists its layers in the image
+	// manifest the index points at. Fall back to every blob if that fails.
+	if isOCIFormat && len(configs[0].Layers) == 0 {
+		configs[0].Layers = ociManifestLayers(configs[0].Config, ociBlobs)
+		if len(configs[0].Layers) == 0 {
+			configs[0].Layers = blobsFound
+		}
+	}
+
+	// Map history to layers
+	layerIndex := 0
+	result := hist[:0]
+	for _, i := range hist {
+		if !i.EmptyLayer {
+			if len(configs) > 0 && layerIndex < len(configs[0].Layers) {
+				layerID := configs[0].Layers[layerIndex]
+				if isOCIFormat {
+					layerID = filepath.Base(layerID)
+				}
+				i.LayerID = layerID
+				i.Digest = s.digests[layerID]
+				i.Size = s.sizes[layerID].size
+				i.CompressedSize = s.sizes[layerID].compressed
+				i.Files = s.layers[layerID]
+				layerIndex++
+			}
+		}
+		result = append(result, i)
+	}
+
+	s.report.Packages = s.attributePackages(result)
+	for _, h := range result {
+		if release, ok := s.osReleases[h.LayerID]; ok {
+			s.report.OS = release
+		}
+	}
+
+	if isOCIFormat {
+		s.warn("OCI format detected:")
+		s.warn("Found %d history entries (%d non-empty)", len(hist), layerIndex)
+		s.warn("Found %d layer files", len(configs[0].Layers))
+		return result, imgConfig, FormatOCI, nil
+	}
+
+	if len(configs) == 0 {
+		return nil, nil, "", fmt.Errorf("no manifest.json or index.json found in image")
+	}
+	if layerIndex != len(configs[0].Layers) {
+		return nil, nil, "", fmt.Errorf("layer mismatch: found %d layers but expected %d", layerIndex, len(configs[0].Layers))
+	}
+
+	return result, imgConfig, FormatDocker, nil
+}
+
+// readDockerLayer lists the entries of a layer of docker save output, read
+// from r.
+func (s *scan) readDockerLayer(layerName string, r io.Reader) {
+	hash := sha256.New()
+	meter := newLayerMeter(false)
+	measure := io.MultiWriter(hash, meter)
+	ttr := tar.NewReader(io.TeeReader(r, measure))
+	s.layers[layerName] = make([]File, 0)
+	for {
+		tarLayerFile, err := ttr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			s.warn("%s: %v", layerName, err)
+			break
+		}
+		s.addFile(layerName, tarLayerFile, ttr)
+	}
+	s.scanGitRepos(layerName)
+	// Hash the tar padding too so the digest matches the diff ID
+	io.Copy(measure, r)
+	s.digests[layerName] = digestOf(hash)
+	s.sizes[layerName] = layerSize{size: meter.size, compressed: meter.compressedSize()}
+}
+
+// addFile records a layer entry and scans it when it is not noise. content
+// reads the body of the entry.
+func (s *scan) addFile(layerName string, hdr *tar.Header, content io.Reader) {
+	name := hdr.Name
+	// Archives are read first so their entries can be scanned after the
+	// archive itself has been, as a JAR is also a dependency
+	var archive []byte
+	if s.a.isArchive(name, hdr, 1) {
+		data, err := io.ReadAll(content)
+		if err != nil {
+			s.warn("%s: failed to read %s: %v", layerName, name, err)
+		} else {
+			archive, content = data, bytes.NewReader(data)
+		}
+	}
+	if dir, rel, ok := gitPath(name); ok {
+		s.readGitFile(layerName, dir, rel, hdr.Size, content)
+	} else if kind := packageDBType(name); kind != "" && hdr.Typeflag == tar.TypeReg {
+		s.readPackageDB(layerName, name, kind, content)
+	} else if isOSRelease(name) && hdr.Typeflag == tar.TypeReg {
+		s.readOSRelease(layerName, content)
+	} else if kind := dependencyType(name, hdr); kind != "" {
+		// Executables that are not Go binaries are scanned like any file
+		if rest := s.readDependencies(layerName, name, kind, hdr, content); rest != nil {
+			s.scanSecrets(layerName, name, hdr, rest)
+		}
+	} else if kind := accountFileType(name); kind != "" && hdr.Typeflag == tar.TypeReg {
+		s.readAccountFile(layerName, name, kind, hdr.Size, content)
+	} else {
+		s.scanSecrets(layerName, name, hdr, content)
+	}
+	noise := s.a.ignored(name)
+	file := File{
+		Path:     name,
+		Size:     hdr.Size,
+		Mode:     hdr.FileInfo().Mode(),
+		ModTime:  hdr.ModTime,
+		Linkname: hdr.Linkname,
+		UID:      hdr.Uid,
+		GID:      hdr.Gid,
+		Noise:    noise,
+	}
+	if xattr, ok := hdr.PAXRecords[capabilityXattr]; ok {
+		file.Capabilities = decodeCapabilities([]byte(xattr))
+	}
+	s.layers[layerName] = append(s.layers[layerName], file)
+	if !noise {
+		s.checkingNames()
+		s.scanFilename(name, layerName)
+	}
+	if archive != nil {
+		s.scanArchive(layerName, name, archive, 1)
+	}
+}
+
+// scanSecrets reads the keys of a key file and, when entropy scanning is
+// enabled, the random looking strings of any other file.
+func (s *scan) scanSecrets(layerName, name string, hdr *tar.Header, content io.Reader) {
+	if hdr.Typeflag != tar.TypeReg {
+		return
+	}
+	if s.a.isKeyFile(name) {
+		s.readKeyFile(layerName, name, hdr.Size, content)
+	} else if s.a.opts.Entropy != nil && !s.a.ignored(name) {
+		s.scanContent(layerName, name, hdr, content)
+	}
+}
+
+func (s *scan) warn(format string, a ...interface{}) {
+	s.report.Warnings = append(s.report.Warnings, fmt.Sprintf(format, a...))
+}
+
+// checkingNames records how many warnings came before the first file name
+// was checked for secrets.
+func (s *scan) checkingNames() {
+	if !s.checkedNames {
+		s.checkedNames = true
+		s.report.WarningsBeforeFindings = len(s.report.Warnings)
+	}
+}
+
+// ignored reports whether name matches the noise filter.
+func (a *Analyzer) ignored(name string) bool {
+	return a.ignore.MatchString(name)
+}
+
+// configDigest returns the digest of the image config blob, which is the
+// image ID docker reports.
+func configDigest(configs []manifest, ociConfigs map[string][]byte) string {
+	if len(configs) == 0 || configs[0].Config == "" {
+		return ""
+	}
+	name := strings.TrimSuffix(filepath.Base(configs[0].Config), ".json")
+	// An OCI index points at the image manifest, which points at the config
+	if blob, ok := ociConfigs[name]; ok {
+		if digest, err := jsonparser.GetString(blob, "config", "digest"); err == nil {
+			return digest
+		}
+	}
+	return "sha256:" + name
+}
+
+// ociManifestLayers follows an OCI index entry to the image manifest and
+// returns the blob names of its layers in order.
+func ociManifestLayers(digest string, blobs map[string][]byte) []string {
+	for depth := 0; depth < 4; depth++ {
+		blob, ok := blobs[strings.TrimPrefix(digest, "sha256:")]
+		if !ok {
+			return nil
+		}
+		var m struct {
+			Manifests []ociManifest `json:"manifests"`
+			Layers    []ociManifest `json:"layers"`
+		}
+		if err := json.Unmarshal(blob, &m); err != nil {
+			return nil
+		}
+		if len(m.Layers) > 0 {
+			var layers []string
+			for _, l := range m.Layers {
+				layers = append(layers, strings.TrimPrefix(l.Digest, "sha256:"))
+			}
+			return layers
+		}
+		if len(m.Manifests) == 0 {
+			return nil
+		}
+		// Nested index, follow the first manifest
+		digest = m.Manifests[0].Digest
+	}
+	return nil
+}
+
+func digestOf(h hash.Hash) string {
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Helper function to check if a byte slice likely contains JSON
+func containsJSON(data []byte) bool {
+	// Simple check: if it starts with '{' and contains "config" or "history"
+	if len(data) > 0 && data[0] == '{' {
+		s := string(data[:min(200, len(data))])
+		return strings.Contains(s, "\"config\"") ||
+			strings.Contains(s, "\"history\"") ||
+			strings.Contains(s, "\"rootfs\"")
+	}
+	return false
+}
+
+// processLayerAsTar lists the entries of a layer tarball
+func (s *scan) processLayerAsTar(r io.Reader, layerName string, compressed int64) bool {
+	fileCount := 0
+	hash := sha256.New()
+	meter := newLayerMeter(compressed > 0)
+	r = io.TeeReader(r, io.MultiWriter(hash, meter))
+	tarReader := tar.NewReader(r)
+
+	for {
+		fileHeader, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Not a valid tar, don't report error but return false
+			return false
+		}
+
+		fileCount++
+		s.addFile(layerName, fileHeader, tarReader)
+	}
+	s.scanGitRepos(layerName)
+	io.Copy(io.Discard, r)
+	s.digests[layerName] = digestOf(hash)
+	if compressed == 0 {
+		compressed = meter.compressedSize()
+	}
+	s.sizes[layerName] = layerSize{size: meter.size, compressed: compressed}
+
+	return fileCount > 0 // Return true if we processed at least one file
+}
+
+// extractImageConfig reads just the image config without a full analysis
+func extractImageConfig(imageStream io.ReadCloser) (*imageConfig, error) {
+	defer imageStream.Close()
+	tr := tar.NewReader(imageStream)
+	var imgConfig *imageConfig
+	var isOCIFormat bool
+
+	for {
+		imageFile, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Check if this is OCI format
+		if strings.HasPrefix(imageFile.Name, "blobs/sha256/") {
+			isOCIFormat = true
+		}
+
+		// Handle config files
+		if (!isOCIFormat && strings.Contains(imageFile.Name, ".json") && imageFile.Name != "manifest.json") ||
+			(isOCIFormat && strings.HasPrefix(imageFile.Name, "blobs/sha256/")) {
+			jsonBytes, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read config file: %v", err)
+			}
+
+			// Try to parse image config
+			var cfg imageConfig
+			if err := json.Unmarshal(jsonBytes, &cfg); err == nil {
+				imgConfig = &cfg
+				// Once we have the config, we can return
+				if imgConfig.DockerVersion != "" && len(imgConfig.Config.Env) > 0 {
+					return imgConfig, nil
+				}
+			}
+		}
+	}
+	return imgConfig, nil
+}
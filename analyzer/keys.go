@@ -0,0 +1,435 @@
+package analyzer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of key material
+const (
+	KeyPrivate     = "private-key"
+	KeyCertificate = "certificate"
+	// KeyStore is a PKCS#12 bundle whose content cannot be read without
+	// its password
+	KeyStore = "keystore"
+)
+
+// FindingKey is the type of findings on private keys that pair with a
+// certificate of the image.
+const FindingKey = "Key"
+
+// maxKeyFileSize is the largest key or certificate file that is parsed.
+const maxKeyFileSize = 1 << 20
+
+// KeyMaterial is a private key or certificate parsed from a layer file. A
+// file holding a certificate chain yields one entry per certificate.
+type KeyMaterial struct {
+	Path  string `json:"path"`
+	Layer string `json:"layer"`
+	Kind  string `json:"kind"`
+	// Format is the encoding of the file: PEM, DER, OpenSSH, PKCS#12 or JKS
+	Format string `json:"format"`
+	// Algorithm and Bits describe the key, or the public key of a
+	// certificate. They are unknown for most encrypted keys.
+	Algorithm string `json:"algorithm,omitempty"`
+	Bits      int    `json:"bits,omitempty"`
+	Encrypted bool   `json:"encrypted,omitempty"`
+	// PublicKeySHA256 fingerprints the public key, pairing private keys
+	// with their certificates
+	PublicKeySHA256 string     `json:"public_key_sha256,omitempty"`
+	Subject         string     `json:"subject,omitempty"`
+	Issuer          string     `json:"issuer,omitempty"`
+	NotAfter        *time.Time `json:"not_after,omitempty"`
+	Expired         bool       `json:"expired,omitempty"`
+	SelfSigned      bool       `json:"self_signed,omitempty"`
+	// PairedWith lists the certificates matching a private key, or the
+	// private keys matching a certificate
+	PairedWith []string `json:"paired_with,omitempty"`
+}
+
+var (
+	keyFileName = regexp.MustCompile(`(?i)(\.(pem|key|crt|cer|der|p12|pfx|pkcs12|jks|keystore)|(^|/)id_(rsa|dsa|ecdsa|ed25519))$`)
+	// trustStore matches the CA certificates shipped by distributions and
+	// language runtimes, hundreds of public certificates of no interest
+	trustStore = regexp.MustCompile(`(^|/)(etc/ssl/certs/|etc/pki/(ca-trust|tls/certs)/|etc/ca-certificates/)|(^|/)(ca-certificates\.crt|ca-bundle(\.trust)?\.crt|cacert\.pem)$`)
+)
+
+// isKeyFile reports whether name is worth parsing for keys and certificates.
+func (a *Analyzer) isKeyFile(name string) bool {
+	return keyFileName.MatchString(name) && !trustStore.MatchString(name) && !a.ignored(name)
+}
+
+// readKeyFile parses the keys and certificates of a layer file. Files that
+// hold none are skipped silently, the extensions are used for other things.
+func (s *scan) readKeyFile(layerName, name string, size int64, content io.Reader) {
+	if size > maxKeyFileSize {
+		return
+	}
+	data, err := io.ReadAll(content)
+	if err != nil {
+		s.warn("%s: failed to read %s: %v", layerName, name, err)
+		return
+	}
+	for _, k := range parseKeyMaterial(data, time.Now()) {
+		k.Path, k.Layer = name, layerName
+		s.report.Keys = append(s.report.Keys, k)
+	}
+}
+
+// parseKeyMaterial returns the keys and certificates in data, which may be
+// PEM, DER, a Java keystore or a PKCS#12 bundle.
+func parseKeyMaterial(data []byte, now time.Time) []KeyMaterial {
+	if bytes.HasPrefix(data, jksMagic) {
+		keys, _ := parseJKS(data, now)
+		return keys
+	}
+	if bytes.Contains(data, []byte("-----BEGIN ")) {
+		var keys []KeyMaterial
+		for rest := data; ; {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if k, ok := parsePEMBlock(block, now); ok {
+				keys = append(keys, k)
+			}
+		}
+		return keys
+	}
+	if k, ok := parseDER(data, now); ok {
+		return []KeyMaterial{k}
+	}
+	return nil
+}
+
+func parsePEMBlock(block *pem.Block, now time.Time) (KeyMaterial, bool) {
+	k := KeyMaterial{Kind: KeyPrivate, Format: "PEM"}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return k, false
+		}
+		return certificate(cert, "PEM", now), true
+	case "OPENSSH PRIVATE KEY":
+		k, err := parseOpenSSHKey(block.Bytes)
+		return k, err == nil
+	case "ENCRYPTED PRIVATE KEY":
+		k.Encrypted = true
+		return k, true
+	case "RSA PRIVATE KEY", "EC PRIVATE KEY", "DSA PRIVATE KEY", "PRIVATE KEY":
+		if _, ok := block.Headers["DEK-Info"]; ok {
+			k.Encrypted = true
+			k.Algorithm = strings.TrimSuffix(strings.TrimSuffix(block.Type, "PRIVATE KEY"), " ")
+			return k, true
+		}
+		if block.Type == "DSA PRIVATE KEY" {
+			var key struct{ Version, P, Q, G, Y, X *big.Int }
+			if _, err := asn1.Unmarshal(block.Bytes, &key); err != nil {
+				return k, false
+			}
+			k.Algorithm, k.Bits = "DSA", key.P.BitLen()
+			return k, true
+		}
+		key, err := parsePrivateKey(block.Bytes)
+		if err != nil {
+			return k, false
+		}
+		k.setPublicKey(key.Public())
+		return k, true
+	}
+	return k, false
+}
+
+// parseDER tries the DER encodings of certificates, private keys and
+// PKCS#12 bundles in turn.
+func parseDER(data []byte, now time.Time) (KeyMaterial, bool) {
+	if cert, err := x509.ParseCertificate(data); err == nil {
+		return certificate(cert, "DER", now), true
+	}
+	if key, err := parsePrivateKey(data); err == nil {
+		k := KeyMaterial{Kind: KeyPrivate, Format: "DER"}
+		k.setPublicKey(key.Public())
+		return k, true
+	}
+	// PFX ::= SEQUENCE { version INTEGER (3), authSafe ContentInfo, macData MacData OPTIONAL }
+	var pfx struct {
+		Version  int
+		AuthSafe asn1.RawValue
+		MacData  asn1.RawValue `asn1:"optional"`
+	}
+	if rest, err := asn1.Unmarshal(data, &pfx); err == nil && len(rest) == 0 && pfx.Version == 3 {
+		return KeyMaterial{Kind: KeyStore, Format: "PKCS#12", Encrypted: true}, true
+	}
+	return KeyMaterial{}, false
+}
+
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, errors.New("unsupported PKCS#8 key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	return x509.ParseECPrivateKey(der)
+}
+
+// certificate describes cert, checking expiry against now.
+func certificate(cert *x509.Certificate, format string, now time.Time) KeyMaterial {
+	notAfter := cert.NotAfter.UTC()
+	k := KeyMaterial{
+		Kind:     KeyCertificate,
+		Format:   format,
+		Subject:  cert.Subject.String(),
+		Issuer:   cert.Issuer.String(),
+		NotAfter: &notAfter,
+		Expired:  now.After(cert.NotAfter),
+	}
+	// CheckSignatureFrom would also require the certificate to be a CA
+	k.SelfSigned = bytes.Equal(cert.RawSubject, cert.RawIssuer) &&
+		cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+	k.setPublicKey(cert.PublicKey)
+	return k
+}
+
+// setPublicKey records the algorithm, size and fingerprint of pub.
+func (k *KeyMaterial) setPublicKey(pub crypto.PublicKey) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		k.Algorithm, k.Bits = "RSA", pub.N.BitLen()
+	case *ecdsa.PublicKey:
+		k.Algorithm, k.Bits = "ECDSA", pub.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		k.Algorithm, k.Bits = "Ed25519", 256
+	case *dsa.PublicKey:
+		k.Algorithm, k.Bits = "DSA", pub.P.BitLen()
+	}
+	if der, err := x509.MarshalPKIXPublicKey(pub); err == nil {
+		sum := sha256.Sum256(der)
+		k.PublicKeySHA256 = hex.EncodeToString(sum[:])
+	}
+}
+
+var opensshMagic = []byte("openssh-key-v1\x00")
+
+// parseOpenSSHKey reads the unencrypted header of an OpenSSH private key,
+// which holds the cipher and the public key even when the key is encrypted.
+func parseOpenSSHKey(data []byte) (KeyMaterial, error) {
+	k := KeyMaterial{Kind: KeyPrivate, Format: "OpenSSH"}
+	if !bytes.HasPrefix(data, opensshMagic) {
+		return k, errors.New("not an OpenSSH key")
+	}
+	r := sshReader{data: data[len(opensshMagic):]}
+	cipher := r.bytes()
+	r.bytes() // kdf name
+	r.bytes() // kdf options
+	if n := r.uint32(); n < 1 {
+		return k, errors.New("no keys")
+	}
+	pub := sshReader{data: r.bytes()}
+	if r.err != nil {
+		return k, r.err
+	}
+	k.Encrypted = string(cipher) != "none"
+	switch keyType := string(pub.bytes()); {
+	case keyType == "ssh-rsa":
+		e, n := pub.mpint(), pub.mpint()
+		if pub.err == nil {
+			k.setPublicKey(&rsa.PublicKey{N: n, E: int(e.Int64())})
+		}
+	case keyType == "ssh-ed25519":
+		if key := pub.bytes(); pub.err == nil && len(key) == ed25519.PublicKeySize {
+			k.setPublicKey(ed25519.PublicKey(key))
+		}
+	case strings.HasPrefix(keyType, "ecdsa-sha2-"):
+		curves := map[string]elliptic.Curve{"nistp256": elliptic.P256(), "nistp384": elliptic.P384(), "nistp521": elliptic.P521()}
+		curve, point := curves[string(pub.bytes())], pub.bytes()
+		if curve != nil && pub.err == nil {
+			if x, y := elliptic.Unmarshal(curve, point); x != nil {
+				k.setPublicKey(&ecdsa.PublicKey{Curve: curve, X: x, Y: y})
+			}
+		}
+	case keyType == "ssh-dss":
+		p := pub.mpint()
+		k.Algorithm, k.Bits = "DSA", p.BitLen()
+	default:
+		k.Algorithm = keyType
+	}
+	return k, nil
+}
+
+// sshReader decodes the wire format of SSH keys, remembering the first
+// error.
+type sshReader struct {
+	data []byte
+	err  error
+}
+
+func (r *sshReader) uint32() uint32 {
+	if len(r.data) < 4 {
+		r.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	n := binary.BigEndian.Uint32(r.data)
+	r.data = r.data[4:]
+	return n
+}
+
+func (r *sshReader) bytes() []byte {
+	n := r.uint32()
+	if r.err != nil || uint32(len(r.data)) < n {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *sshReader) mpint() *big.Int { return new(big.Int).SetBytes(r.bytes()) }
+
+var jksMagic = []byte{0xfe, 0xed, 0xfe, 0xed}
+
+// parseJKS lists the entries of a Java keystore. Private keys are always
+// encrypted with the keystore password, but their certificate chains and
+// the trusted certificates are not.
+func parseJKS(data []byte, now time.Time) ([]KeyMaterial, error) {
+	r := jksReader{data: data[len(jksMagic):]}
+	r.uint32() // version
+	count := r.uint32()
+	var keys []KeyMaterial
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		tag := r.uint32()
+		r.utf()    // alias
+		r.uint64() // creation time
+		switch tag {
+		case 1: // private key entry
+			r.bytes32() // encrypted key
+			k := KeyMaterial{Kind: KeyPrivate, Format: "JKS", Encrypted: true}
+			chain := r.uint32()
+			for j := uint32(0); j < chain && r.err == nil; j++ {
+				r.utf() // certificate type
+				der := r.bytes32()
+				cert, err := x509.ParseCertificate(der)
+				if err != nil {
+					continue
+				}
+				if j == 0 {
+					k.setPublicKey(cert.PublicKey)
+				}
+				keys = append(keys, certificate(cert, "JKS", now))
+			}
+			keys = append(keys, k)
+		case 2: // trusted certificate entry
+			r.utf()
+			if cert, err := x509.ParseCertificate(r.bytes32()); err == nil {
+				keys = append(keys, certificate(cert, "JKS", now))
+			}
+		default:
+			return keys, fmt.Errorf("unknown keystore entry %d", tag)
+		}
+	}
+	return keys, r.err
+}
+
+// jksReader decodes the big endian fields of Java keystores.
+type jksReader struct {
+	data []byte
+	err  error
+}
+
+func (r *jksReader) next(n int) []byte {
+	if r.err != nil || len(r.data) < n {
+		r.err = io.ErrUnexpectedEOF
+		return make([]byte, n)
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *jksReader) uint32() uint32 { return binary.BigEndian.Uint32(r.next(4)) }
+
+func (r *jksReader) uint64() uint64 { return binary.BigEndian.Uint64(r.next(8)) }
+
+func (r *jksReader) utf() string {
+	return string(r.next(int(binary.BigEndian.Uint16(r.next(2)))))
+}
+
+func (r *jksReader) bytes32() []byte {
+	n := r.uint32()
+	if n > uint32(len(r.data)) {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	return r.next(int(n))
+}
+
+// pairKeys links private keys with the certificates of the same public key
+// and reports every such private key as a finding.
+func (s *scan) pairKeys() {
+	byFingerprint := make(map[string][]int)
+	for i, k := range s.report.Keys {
+		if k.PublicKeySHA256 != "" {
+			byFingerprint[k.PublicKeySHA256] = append(byFingerprint[k.PublicKeySHA256], i)
+		}
+	}
+	keys := s.report.Keys
+	for i := range keys {
+		if keys[i].Kind != KeyPrivate || keys[i].PublicKeySHA256 == "" {
+			continue
+		}
+		var subjects []string
+		for _, j := range byFingerprint[keys[i].PublicKeySHA256] {
+			if keys[j].Kind != KeyCertificate {
+				continue
+			}
+			keys[i].PairedWith = appendUnique(keys[i].PairedWith, keys[j].Path)
+			keys[j].PairedWith = appendUnique(keys[j].PairedWith, keys[i].Path)
+			subjects = appendUnique(subjects, keys[j].Subject)
+		}
+		if len(subjects) == 0 {
+			continue
+		}
+		sort.Strings(subjects)
+		s.report.Findings = append(s.report.Findings, Finding{
+			Type:        FindingKey,
+			Description: "Private key for certificate " + strings.Join(subjects, ", "),
+			Pattern:     "public key " + keys[i].PublicKeySHA256[:16],
+			Path:        keys[i].Path,
+			Layer:       keys[i].Layer,
+		})
+	}
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, e := range list {
+		if e == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
@@ -0,0 +1,193 @@
+package analyzer
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var keyTestNow = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// testCertificate returns a new key and a DER certificate for it, signed by
+// itself unless parent is given.
+func testCertificate(t *testing.T, cn string, notAfter time.Time, parent *x509.Certificate, parentKey crypto.Signer) (*ecdsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    notAfter.AddDate(-1, 0, 0),
+		NotAfter:     notAfter,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, der
+}
+
+func pemBlock(typ string, der []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}))
+}
+
+func TestParseKeyMaterial(t *testing.T) {
+	caKey, caDER := testCertificate(t, "Test CA", keyTestNow.AddDate(5, 0, 0), nil, nil)
+	ca, _ := x509.ParseCertificate(caDER)
+	key, der := testCertificate(t, "example.com", keyTestNow.AddDate(0, -1, 0), ca, caKey)
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(key)
+	encrypted := string(pem.EncodeToMemory(&pem.Block{
+		Type: "RSA PRIVATE KEY", Headers: map[string]string{"Proc-Type": "4,ENCRYPTED", "DEK-Info": "AES-128-CBC,00"}, Bytes: []byte{1},
+	}))
+
+	keys := parseKeyMaterial([]byte(pemBlock("PRIVATE KEY", pkcs8)+pemBlock("CERTIFICATE", der)+pemBlock("CERTIFICATE", caDER)+encrypted), keyTestNow)
+	if assert.Len(t, keys, 4) {
+		assert.Equal(t, KeyPrivate, keys[0].Kind)
+		assert.Equal(t, "ECDSA", keys[0].Algorithm)
+		assert.Equal(t, 256, keys[0].Bits)
+		assert.False(t, keys[0].Encrypted)
+
+		assert.Equal(t, KeyCertificate, keys[1].Kind)
+		assert.Equal(t, "CN=example.com", keys[1].Subject)
+		assert.Equal(t, "CN=Test CA", keys[1].Issuer)
+		assert.True(t, keys[1].Expired)
+		assert.False(t, keys[1].SelfSigned)
+		assert.Equal(t, keys[0].PublicKeySHA256, keys[1].PublicKeySHA256)
+
+		assert.True(t, keys[2].SelfSigned)
+		assert.False(t, keys[2].Expired)
+		assert.Equal(t, keyTestNow.AddDate(5, 0, 0), *keys[2].NotAfter)
+
+		assert.Equal(t, KeyMaterial{Kind: KeyPrivate, Format: "PEM", Algorithm: "RSA", Encrypted: true}, keys[3])
+	}
+
+	der1 := parseKeyMaterial(der, keyTestNow)
+	if assert.Len(t, der1, 1) {
+		assert.Equal(t, "DER", der1[0].Format)
+	}
+	assert.Empty(t, parseKeyMaterial([]byte("ssl_certificate_key /etc/nginx/server.key;"), keyTestNow))
+}
+
+// sshString encodes b in the SSH wire format.
+func sshString(b []byte) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(b))), b...)
+}
+
+func openSSHKey(cipher string, pub ed25519.PublicKey) []byte {
+	var b bytes.Buffer
+	b.Write(opensshMagic)
+	b.Write(sshString([]byte(cipher)))
+	b.Write(sshString([]byte("none")))
+	b.Write(sshString(nil))
+	b.Write(binary.BigEndian.AppendUint32(nil, 1))
+	b.Write(sshString(append(sshString([]byte("ssh-ed25519")), sshString(pub)...)))
+	b.Write(sshString([]byte("private section")))
+	return b.Bytes()
+}
+
+func TestParseOpenSSHKey(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	k, err := parseOpenSSHKey(openSSHKey("none", pub))
+	assert.NoError(t, err)
+	assert.Equal(t, "Ed25519", k.Algorithm)
+	assert.Equal(t, 256, k.Bits)
+	assert.False(t, k.Encrypted)
+	assert.NotEmpty(t, k.PublicKeySHA256)
+
+	k, err = parseOpenSSHKey(openSSHKey("aes256-ctr", pub))
+	assert.NoError(t, err)
+	assert.True(t, k.Encrypted)
+
+	_, err = parseOpenSSHKey(openSSHKey("none", pub)[:30])
+	assert.Error(t, err)
+}
+
+func TestParseJKS(t *testing.T) {
+	_, der := testCertificate(t, "server", keyTestNow.AddDate(1, 0, 0), nil, nil)
+	utf := func(s string) []byte { return append(binary.BigEndian.AppendUint16(nil, uint16(len(s))), s...) }
+	var b bytes.Buffer
+	b.Write(jksMagic)
+	b.Write(binary.BigEndian.AppendUint32(nil, 2))
+	b.Write(binary.BigEndian.AppendUint32(nil, 2))
+	// A private key entry with its chain
+	b.Write(binary.BigEndian.AppendUint32(nil, 1))
+	b.Write(utf("server"))
+	b.Write(make([]byte, 8))
+	b.Write(sshString([]byte("encrypted key")))
+	b.Write(binary.BigEndian.AppendUint32(nil, 1))
+	b.Write(utf("X.509"))
+	b.Write(sshString(der))
+	// A trusted certificate entry
+	b.Write(binary.BigEndian.AppendUint32(nil, 2))
+	b.Write(utf("ca"))
+	b.Write(make([]byte, 8))
+	b.Write(utf("X.509"))
+	b.Write(sshString(der))
+
+	keys := parseKeyMaterial(b.Bytes(), keyTestNow)
+	if assert.Len(t, keys, 3) {
+		assert.Equal(t, KeyCertificate, keys[0].Kind)
+		assert.Equal(t, KeyPrivate, keys[1].Kind)
+		assert.True(t, keys[1].Encrypted)
+		assert.Equal(t, "ECDSA", keys[1].Algorithm)
+		assert.Equal(t, keys[0].PublicKeySHA256, keys[1].PublicKeySHA256)
+		assert.Equal(t, "JKS", keys[2].Format)
+	}
+}
+
+func TestKeyPairing(t *testing.T) {
+	key, der := testCertificate(t, "example.com", time.Now().AddDate(1, 0, 0), nil, nil)
+	sec1, _ := x509.MarshalECPrivateKey(key)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherDER, _ := x509.MarshalECPrivateKey(other)
+
+	config := `{"history": [{"created_by": "COPY tls /etc/nginx/tls"}]}`
+	data := dockerArchive(t, config, []testEntry{
+		{hdr: tar.Header{Name: "etc/nginx/tls/server.key"}, body: pemBlock("EC PRIVATE KEY", sec1)},
+		{hdr: tar.Header{Name: "etc/nginx/tls/server.crt"}, body: pemBlock("CERTIFICATE", der)},
+		{hdr: tar.Header{Name: "etc/nginx/tls/old.key"}, body: pemBlock("EC PRIVATE KEY", otherDER)},
+		{hdr: tar.Header{Name: "etc/ssl/certs/ca-certificates.crt"}, body: pemBlock("CERTIFICATE", der)},
+	})
+	a := newTestAnalyzer(t, Options{})
+	report, err := a.Analyze(context.Background(), &memorySource{name: "tls", data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, report.Keys, 3) {
+		assert.Equal(t, []string{"etc/nginx/tls/server.crt"}, report.Keys[0].PairedWith)
+		assert.Equal(t, []string{"etc/nginx/tls/server.key"}, report.Keys[1].PairedWith)
+		assert.Empty(t, report.Keys[2].PairedWith)
+		assert.True(t, report.Keys[1].SelfSigned)
+	}
+	var keyFindings []Finding
+	for _, f := range report.Findings {
+		if f.Type == FindingKey {
+			keyFindings = append(keyFindings, f)
+		}
+	}
+	if assert.Len(t, keyFindings, 1) {
+		assert.Equal(t, "etc/nginx/tls/server.key", keyFindings[0].Path)
+		assert.Equal(t, "Private key for certificate CN=example.com", keyFindings[0].Description)
+		assert.Equal(t, "layer0/layer.tar", keyFindings[0].Layer)
+	}
+}
@@ -0,0 +1,400 @@
+package analyzer
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"whaler/internal/diskcache"
+)
+
+// ScannerVersion identifies the layer scanning logic in the layer cache. It
+// is bumped whenever a change alters what scanning a layer finds, so that
+// layers cached by older versions are scanned again.
+const ScannerVersion = 6
+
+// LayerCache stores what scanning a layer found, its files, packages,
+// findings and keys, so that layers shared by several images are only read
+// once. Entries are keyed by the digest of the layer, the scanner version
+// and a hash of the pattern set and scan options, see
+// Analyzer.CacheNamespace.
+//
+// Entries hold the secrets found in clear text and are only readable by
+// their owner.
+type LayerCache struct {
+	Dir string
+}
+
+// DefaultLayerCacheDir returns the layer cache in the cache directory of the
+// user, or in the temporary directory when there is none.
+func DefaultLayerCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "whaler", "layers")
+}
+
+// cachedLayer is what scanning a layer produced.
+type cachedLayer struct {
+	// Layer is the name the layer was scanned under. Layers stored
+	// uncompressed in docker save output are named after an ID that
+	// depends on their parents, so the names in findings, keys and
+	// warnings are replaced when the entry is reused.
+	Layer          string                  `json:"layer"`
+	Digest         string                  `json:"digest,omitempty"`
+	Size           int64                   `json:"size,omitempty"`
+	CompressedSize int64                   `json:"compressed_size,omitempty"`
+	Files          []File                  `json:"files"`
+	PackageDBs     []packageDB             `json:"package_dbs,omitempty"`
+	Dependencies   []packageDB             `json:"dependencies,omitempty"`
+	OSRelease      *OSRelease              `json:"os_release,omitempty"`
+	Accounts       map[string]*accountFile `json:"accounts,omitempty"`
+	GitRepos       []GitRepo               `json:"git_repos,omitempty"`
+	Findings       []Finding               `json:"findings,omitempty"`
+	Keys           []KeyMaterial           `json:"keys,omitempty"`
+	Warnings       []string                `json:"warnings,omitempty"`
+}
+
+// CacheNamespace names the entries of the layer cache usable by a: the
+// scanner version and a hash of the secret patterns, the ignore list and
+// every option changing what scanning a layer finds.
+func (a *Analyzer) CacheNamespace() string {
+	h := sha256.New()
+	for _, p := range a.patterns {
+		fmt.Fprintf(h, "pattern %q %q %q %q\n", p.Description, p.SecretType, p.Value, p.Validator)
+	}
+	fmt.Fprintf(h, "ignore %q\n", a.ignore.String())
+	fmt.Fprintf(h, "archives %d %d\n", a.archiveDepth(), a.maxArchiveSize())
+	if a.opts.Entropy != nil {
+		fmt.Fprintf(h, "entropy %+v\n", a.opts.Entropy.withDefaults())
+	}
+	return fmt.Sprintf("v%d-%s", ScannerVersion, hex.EncodeToString(h.Sum(nil))[:16])
+}
+
+// ReportNamespace names the reports a returns for an image: the layer cache
+// namespace and a hash of the options applied to the whole report, the
+// advisories, policy and baseline among them. Reports cached under another
+// namespace are stale.
+func (a *Analyzer) ReportNamespace() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "layers %s\n", a.namespace)
+	fmt.Fprintf(h, "verbose %t redact %t\n", a.opts.Verbose, a.opts.Redact)
+	if a.opts.Advisories != nil {
+		fmt.Fprintf(h, "advisories %s\n", a.opts.Advisories.Digest())
+	}
+	for _, v := range []interface{}{a.opts.Policy, a.opts.Baseline} {
+		data, _ := json.Marshal(v)
+		fmt.Fprintf(h, "%T %s\n", v, data)
+	}
+	return fmt.Sprintf("v%d-%s", ScannerVersion, hex.EncodeToString(h.Sum(nil))[:16])
+}
+
+func (c *LayerCache) path(namespace, digest string) (string, bool) {
+	return diskcache.Path(filepath.Join(c.Dir, namespace), digest, ".json.gz")
+}
+
+// get returns the cached scan of a layer, if any, and marks it used.
+// Unreadable entries are treated as missing.
+func (c *LayerCache) get(namespace, digest string) (*cachedLayer, bool) {
+	name, ok := c.path(namespace, digest)
+	if !ok {
+		return nil, false
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, false
+	}
+	var entry cachedLayer
+	if err := json.NewDecoder(zr).Decode(&entry); err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(name, now, now)
+	return &entry, true
+}
+
+// put stores the scan of a layer, never visible partially written to
+// concurrent scans.
+func (c *LayerCache) put(namespace, digest string, entry *cachedLayer) error {
+	name, ok := c.path(namespace, digest)
+	if !ok {
+		return nil
+	}
+	return diskcache.WriteFile(name, func(w io.Writer) error {
+		zw := gzip.NewWriter(w)
+		err := json.NewEncoder(zw).Encode(entry)
+		if cerr := zw.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	})
+}
+
+// CacheStats describes the content of a layer cache.
+type CacheStats struct {
+	// Layers and Bytes count every cached layer
+	Layers int
+	Bytes  int64
+	// Usable and UsableBytes count the layers of the namespace the stats
+	// were taken for
+	Usable      int
+	UsableBytes int64
+	// Namespaces is the number of scanner versions and pattern sets with
+	// cached layers
+	Namespaces int
+	// Oldest and Newest are the earliest and latest last use of a layer
+	Oldest time.Time
+	Newest time.Time
+}
+
+// cacheEntry is a file of the layer cache.
+type cacheEntry struct {
+	namespace string
+	path      string
+	info      os.FileInfo
+}
+
+// entries lists the files of the cache. A missing cache has none.
+func (c *LayerCache) entries() ([]cacheEntry, error) {
+	namespaces, err := os.ReadDir(c.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []cacheEntry
+	for _, ns := range namespaces {
+		if !ns.IsDir() {
+			continue
+		}
+		dir := filepath.Join(c.Dir, ns.Name())
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			info, err := f.Info()
+			if err != nil {
+				continue
+			}
+			entries = append(entries, cacheEntry{namespace: ns.Name(), path: filepath.Join(dir, f.Name()), info: info})
+		}
+	}
+	return entries, nil
+}
+
+// Stats counts the cached layers, and those usable with namespace.
+func (c *LayerCache) Stats(namespace string) (CacheStats, error) {
+	entries, err := c.entries()
+	if err != nil {
+		return CacheStats{}, err
+	}
+	var stats CacheStats
+	namespaces := make(map[string]bool)
+	for _, e := range entries {
+		if strings.HasPrefix(e.info.Name(), ".") {
+			continue
+		}
+		namespaces[e.namespace] = true
+		stats.Layers++
+		stats.Bytes += e.info.Size()
+		if e.namespace == namespace {
+			stats.Usable++
+			stats.UsableBytes += e.info.Size()
+		}
+		used := e.info.ModTime()
+		if stats.Oldest.IsZero() || used.Before(stats.Oldest) {
+			stats.Oldest = used
+		}
+		if used.After(stats.Newest) {
+			stats.Newest = used
+		}
+	}
+	stats.Namespaces = len(namespaces)
+	return stats, nil
+}
+
+// Prune removes the layers not used since before, and those cached by other
+// scanner versions, which no scan can use anymore. It returns the number of
+// layers and bytes removed.
+func (c *LayerCache) Prune(before time.Time) (int, int64, error) {
+	entries, err := c.entries()
+	if err != nil {
+		return 0, 0, err
+	}
+	current := fmt.Sprintf("v%d-", ScannerVersion)
+	var layers int
+	var bytes int64
+	for _, e := range entries {
+		used := e.info.ModTime()
+		if strings.HasPrefix(e.info.Name(), ".") {
+			// Leftovers of interrupted writes
+			if used.Before(time.Now().Add(-time.Hour)) {
+				os.Remove(e.path)
+			}
+			continue
+		}
+		if strings.HasPrefix(e.namespace, current) && !used.Before(before) {
+			continue
+		}
+		if err := os.Remove(e.path); err != nil {
+			return layers, bytes, err
+		}
+		layers++
+		bytes += e.info.Size()
+	}
+	// Remove the namespaces left empty, which fails for the others
+	namespaces, _ := os.ReadDir(c.Dir)
+	for _, ns := range namespaces {
+		if ns.IsDir() {
+			os.Remove(filepath.Join(c.Dir, ns.Name()))
+		}
+	}
+	return layers, bytes, nil
+}
+
+// layerMark records how many findings, keys, warnings and git repositories
+// the report had before a layer was scanned, to tell apart those the layer
+// added.
+type layerMark struct {
+	findings, keys, warnings, gitRepos int
+}
+
+func (s *scan) mark() layerMark {
+	return layerMark{len(s.report.Findings), len(s.report.Keys), len(s.report.Warnings), len(s.report.GitRepos)}
+}
+
+// restoreLayer reads the scan of the layer with digest from the layer
+// cache, as if layerName had just been scanned. It reports whether the
+// layer was cached.
+func (s *scan) restoreLayer(digest, layerName string) bool {
+	c := s.a.opts.LayerCache
+	if c == nil {
+		return false
+	}
+	entry, ok := c.get(s.a.namespace, digest)
+	if !ok {
+		return false
+	}
+	files := make([]File, 0, len(entry.Files))
+	for _, f := range entry.Files {
+		// Tar headers carry local times, JSON decodes them in UTC
+		f.ModTime = f.ModTime.Local()
+		files = append(files, f)
+	}
+	s.layers[layerName] = files
+	for _, f := range files {
+		if !f.Noise {
+			s.checkingNames()
+			break
+		}
+	}
+	if entry.Digest != "" {
+		s.digests[layerName] = entry.Digest
+		s.sizes[layerName] = layerSize{size: entry.Size, compressed: entry.CompressedSize}
+	}
+	if len(entry.PackageDBs) > 0 {
+		s.packageDBs[layerName] = entry.PackageDBs
+	}
+	if len(entry.Dependencies) > 0 {
+		s.dependencies[layerName] = entry.Dependencies
+	}
+	if entry.OSRelease != nil {
+		s.osReleases[layerName] = entry.OSRelease
+	}
+	if entry.Accounts != nil {
+		s.accounts[layerName] = entry.Accounts
+	}
+	for _, r := range entry.GitRepos {
+		r.Layer = layerName
+		s.report.GitRepos = append(s.report.GitRepos, r)
+	}
+	for _, f := range entry.Findings {
+		f.Layer = layerName
+		s.report.Findings = append(s.report.Findings, f)
+	}
+	now := time.Now()
+	for _, k := range entry.Keys {
+		k.Layer = layerName
+		// Certificates expire while they sit in the cache
+		k.Expired = k.NotAfter != nil && now.After(*k.NotAfter)
+		s.report.Keys = append(s.report.Keys, k)
+	}
+	for _, w := range entry.Warnings {
+		s.report.Warnings = append(s.report.Warnings, strings.ReplaceAll(w, entry.Layer, layerName))
+	}
+	return true
+}
+
+// storeLayer caches what scanning layerName found since m under digest.
+// Failing to cache a layer does not fail the analysis.
+func (s *scan) storeLayer(digest, layerName string, m layerMark) {
+	c := s.a.opts.LayerCache
+	if c == nil {
+		return
+	}
+	entry := &cachedLayer{
+		Layer:          layerName,
+		Digest:         s.digests[layerName],
+		Size:           s.sizes[layerName].size,
+		CompressedSize: s.sizes[layerName].compressed,
+		Files:          s.layers[layerName],
+		PackageDBs:     s.packageDBs[layerName],
+		Dependencies:   s.dependencies[layerName],
+		OSRelease:      s.osReleases[layerName],
+		Accounts:       s.accounts[layerName],
+		GitRepos:       s.report.GitRepos[m.gitRepos:],
+		Findings:       s.report.Findings[m.findings:],
+		Keys:           s.report.Keys[m.keys:],
+		Warnings:       s.report.Warnings[m.warnings:],
+	}
+	if err := c.put(s.a.namespace, digest, entry); err != nil {
+		s.warn("layer cache: %v", err)
+	}
+}
+
+// readCachedDockerLayer reads a layer of docker save output through the
+// layer cache. Its digest is only known once read, so the layer is first
+// copied to a temporary file while hashed, and only scanned when it is not
+// cached.
+func (s *scan) readCachedDockerLayer(layerName string, r io.Reader) {
+	s.layers[layerName] = make([]File, 0)
+	f, err := os.CreateTemp("", "whaler-layer-*.tar")
+	if err != nil {
+		s.warn("layer cache: %v", err)
+		s.readDockerLayer(layerName, r)
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, hash), r); err != nil {
+		s.warn("%s: %v", layerName, err)
+		return
+	}
+	digest := digestOf(hash)
+	if s.restoreLayer(digest, layerName) {
+		return
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		s.warn("%s: %v", layerName, err)
+		return
+	}
+	m := s.mark()
+	s.readDockerLayer(layerName, f)
+	s.storeLayer(digest, layerName, m)
+}
@@ -0,0 +1,163 @@
+package analyzer
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"whaler/vulndb"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayerCache(t *testing.T) {
+	base := []testEntry{{hdr: tar.Header{Name: "var/lib/dpkg/status"}, body: dpkgBase}}
+	app := []testEntry{{hdr: tar.Header{Name: "app/.ssh/id_rsa"}, body: "key"}}
+	image := dockerArchive(t, `{"history": [
+		{"created_by": "/bin/sh -c #(nop) ADD file:abc in / "},
+		{"created_by": "COPY dir:123 in /app"}
+	]}`, base, app)
+	// The same application layer on its own is named layer0
+	appOnly := dockerArchive(t, `{"history": [{"created_by": "COPY dir:123 in /app"}]}`, app)
+
+	cache := &LayerCache{Dir: t.TempDir()}
+	a := newTestAnalyzer(t, Options{LayerCache: cache})
+	uncached, err := newTestAnalyzer(t, Options{}).Analyze(context.Background(), &memorySource{name: "image", data: image})
+	assert.NoError(t, err)
+	first, err := a.Analyze(context.Background(), &memorySource{name: "image", data: image})
+	assert.NoError(t, err)
+	assert.Equal(t, uncached, first)
+
+	stats, err := cache.Stats(a.CacheNamespace())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stats.Layers)
+	assert.Equal(t, 2, stats.Usable)
+	assert.Equal(t, 1, stats.Namespaces)
+
+	// Cached layers are not read again: a tampered entry shows up
+	digest := first.History[1].Digest
+	entry, ok := cache.get(a.namespace, digest)
+	if !assert.True(t, ok) {
+		return
+	}
+	entry.Findings[0].Description = "From the cache"
+	assert.NoError(t, cache.put(a.namespace, digest, entry))
+
+	second, err := a.Analyze(context.Background(), &memorySource{name: "image", data: image})
+	assert.NoError(t, err)
+	assert.Equal(t, "From the cache", second.Findings[0].Description)
+	assert.Equal(t, first.Packages, second.Packages)
+	assert.Equal(t, first.History, second.History)
+
+	// Findings are attributed to the layer name of the image being read
+	other, err := a.Analyze(context.Background(), &memorySource{name: "app", data: appOnly})
+	assert.NoError(t, err)
+	if assert.Len(t, other.Findings, 1) {
+		assert.Equal(t, "From the cache", other.Findings[0].Description)
+		assert.Equal(t, "layer0/layer.tar", other.Findings[0].Layer)
+	}
+
+	// Other pattern sets and options do not share entries
+	entropy := newTestAnalyzer(t, Options{LayerCache: cache, Entropy: &EntropyOptions{}})
+	assert.NotEqual(t, a.CacheNamespace(), entropy.CacheNamespace())
+	report, err := entropy.Analyze(context.Background(), &memorySource{name: "image", data: image})
+	assert.NoError(t, err)
+	assert.Equal(t, uncached.Findings[0].Description, report.Findings[0].Description)
+	stats, err = cache.Stats(a.CacheNamespace())
+	assert.NoError(t, err)
+	assert.Equal(t, 4, stats.Layers)
+	assert.Equal(t, 2, stats.Usable)
+	assert.Equal(t, 2, stats.Namespaces)
+}
+
+func TestReportNamespace(t *testing.T) {
+	dir, err := vulndb.Open("../vulndb/testdata/osv")
+	assert.NoError(t, err)
+	file, err := vulndb.Open("../vulndb/testdata/osv.sqlite")
+	assert.NoError(t, err)
+
+	seen := make(map[string]bool)
+	for _, opts := range []Options{
+		{},
+		{Redact: true},
+		{Entropy: &EntropyOptions{}},
+		{Advisories: dir},
+		{Advisories: file},
+		{Policy: &Policy{Rules: []Rule{{ID: "root", Check: "no-root"}}}},
+		{Baseline: &Baseline{Findings: []Suppression{{Fingerprint: "0123"}}}},
+	} {
+		ns := newTestAnalyzer(t, opts).ReportNamespace()
+		assert.False(t, seen[ns], "%+v", opts)
+		seen[ns] = true
+	}
+	again, err := vulndb.Open("../vulndb/testdata/osv")
+	assert.NoError(t, err)
+	assert.Equal(t, dir.Digest(), again.Digest())
+	assert.Equal(t, newTestAnalyzer(t, Options{}).ReportNamespace(), newTestAnalyzer(t, Options{}).ReportNamespace())
+}
+
+func TestLayerCacheOCI(t *testing.T) {
+	source := &TarFile{Path: filepath.Join("testdata", "test-image.tar")}
+	cache := &LayerCache{Dir: t.TempDir()}
+	a := newTestAnalyzer(t, Options{LayerCache: cache})
+	first, err := a.Analyze(context.Background(), source)
+	assert.NoError(t, err)
+	second, err := a.Analyze(context.Background(), source)
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	stats, err := cache.Stats(a.CacheNamespace())
+	assert.NoError(t, err)
+	assert.NotZero(t, stats.Layers)
+}
+
+func TestLayerCachePrune(t *testing.T) {
+	cache := &LayerCache{Dir: t.TempDir()}
+	a := newTestAnalyzer(t, Options{})
+	digest := func(b byte) string {
+		return "sha256:" + strings.Repeat(fmt.Sprintf("%02x", b), 32)
+	}
+	for _, ns := range []string{a.CacheNamespace(), "v0-0123456789abcdef"} {
+		for _, b := range []byte{1, 2} {
+			assert.NoError(t, cache.put(ns, digest(b), &cachedLayer{Layer: "layer.tar"}))
+		}
+	}
+	// The first layer was last used a month ago
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	name, _ := cache.path(a.CacheNamespace(), digest(1))
+	assert.NoError(t, os.Chtimes(name, old, old))
+
+	stats, err := cache.Stats(a.CacheNamespace())
+	assert.NoError(t, err)
+	assert.Equal(t, CacheStats{
+		Layers: 4, Bytes: stats.Bytes, Usable: 2, UsableBytes: stats.Bytes / 2,
+		Namespaces: 2, Oldest: stats.Oldest, Newest: stats.Newest,
+	}, stats)
+	assert.WithinDuration(t, old, stats.Oldest, time.Second)
+
+	// Other scanner versions and layers unused for a week are removed
+	layers, bytes, err := cache.Prune(time.Now().Add(-7 * 24 * time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, layers)
+	assert.Equal(t, stats.Bytes*3/4, bytes)
+	_, ok := cache.get(a.CacheNamespace(), digest(2))
+	assert.True(t, ok)
+	assert.NoDirExists(t, filepath.Join(cache.Dir, "v0-0123456789abcdef"))
+
+	layers, _, err = cache.Prune(time.Now().Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, layers)
+	stats, err = cache.Stats(a.CacheNamespace())
+	assert.NoError(t, err)
+	assert.Zero(t, stats.Layers)
+
+	// A missing cache is empty
+	stats, err = (&LayerCache{Dir: filepath.Join(cache.Dir, "missing")}).Stats("")
+	assert.NoError(t, err)
+	assert.Zero(t, stats.Layers)
+}
@@ -0,0 +1,204 @@
+package analyzer
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"whaler/internal/rpmdb"
+)
+
+// Package types
+const (
+	PackageDeb = "deb"
+	PackageApk = "apk"
+	PackageRpm = "rpm"
+)
+
+// packageDB is the package list read from one database file of a layer.
+type packageDB struct {
+	Path     string
+	Packages []Package
+}
+
+// packageDBType returns the type of package database stored at name, or ""
+// when name is not one.
+func packageDBType(name string) string {
+	name = CleanPath(name)
+	switch name {
+	case "var/lib/dpkg/status":
+		return PackageDeb
+	case "lib/apk/db/installed":
+		return PackageApk
+	case "var/lib/rpm/Packages", "var/lib/rpm/rpmdb.sqlite",
+		"usr/lib/sysimage/rpm/Packages", "usr/lib/sysimage/rpm/rpmdb.sqlite":
+		return PackageRpm
+	}
+	// Distroless images keep one status file per package
+	if path.Dir(name) == "var/lib/dpkg/status.d" && !strings.HasSuffix(name, ".md5sums") {
+		return PackageDeb
+	}
+	return ""
+}
+
+// readPackageDB parses a package database found in layerName.
+func (s *scan) readPackageDB(layerName, name, kind string, r io.Reader) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		s.warn("%s: failed to read %s: %v", layerName, name, err)
+		return
+	}
+	var pkgs []Package
+	switch kind {
+	case PackageDeb:
+		pkgs = parseDpkgStatus(data)
+	case PackageApk:
+		pkgs = parseApkInstalled(data)
+	case PackageRpm:
+		rpms, err := rpmdb.Parse(data)
+		if err != nil {
+			s.warn("%s: failed to parse %s: %v", layerName, name, err)
+			return
+		}
+		for _, p := range rpms {
+			pkgs = append(pkgs, Package{
+				Type:    PackageRpm,
+				Name:    p.Name,
+				Version: p.EVR(),
+				Arch:    p.Arch,
+				Source:  p.SourceName(),
+			})
+		}
+	}
+	location := CleanPath(name)
+	for i := range pkgs {
+		pkgs[i].Location = location
+	}
+	s.packageDBs[layerName] = append(s.packageDBs[layerName], packageDB{Path: location, Packages: pkgs})
+}
+
+// parseControl splits a dpkg or apk database into stanzas of key/value
+// pairs separated by blank lines. Continuation lines are dropped.
+func parseControl(data []byte, sep string) []map[string]string {
+	var stanzas []map[string]string
+	current := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			if len(current) > 0 {
+				stanzas = append(stanzas, current)
+				current = make(map[string]string)
+			}
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, sep); ok {
+			current[key] = strings.TrimSpace(value)
+		}
+	}
+	if len(current) > 0 {
+		stanzas = append(stanzas, current)
+	}
+	return stanzas
+}
+
+func parseDpkgStatus(data []byte) []Package {
+	var pkgs []Package
+	for _, st := range parseControl(data, ":") {
+		if st["Package"] == "" {
+			continue
+		}
+		// status.d files carry no Status field
+		if status, ok := st["Status"]; ok && !strings.HasSuffix(status, " installed") {
+			continue
+		}
+		source := st["Package"]
+		if src := st["Source"]; src != "" {
+			source = strings.Fields(src)[0]
+		}
+		pkgs = append(pkgs, Package{
+			Type:    PackageDeb,
+			Name:    st["Package"],
+			Version: st["Version"],
+			Arch:    st["Architecture"],
+			Source:  source,
+		})
+	}
+	return pkgs
+}
+
+func parseApkInstalled(data []byte) []Package {
+	var pkgs []Package
+	for _, st := range parseControl(data, ":") {
+		if st["P"] == "" {
+			continue
+		}
+		pkgs = append(pkgs, Package{
+			Type:    PackageApk,
+			Name:    st["P"],
+			Version: st["V"],
+			Arch:    st["A"],
+			Source:  st["o"],
+		})
+	}
+	return pkgs
+}
+
+// attributePackages builds the package inventory of the final image, OS
+// packages and language dependencies alike. Every OS package is attributed to the first layer of an unbroken run of layers whose
+// copy of the database lists it, so a package upgraded or reinstalled later
+// is attributed to the instruction that did so.
+func (s *scan) attributePackages(history []History) []Package {
+	type key struct{ name, version, arch string }
+	latest := make(map[string][]Package)
+	introduced := make(map[string]map[key]int)
+	for i, h := range history {
+		if h.LayerID == "" {
+			continue
+		}
+		for _, db := range s.packageDBs[h.LayerID] {
+			prev := introduced[db.Path]
+			next := make(map[key]int)
+			for _, p := range db.Packages {
+				k := key{p.Name, p.Version, p.Arch}
+				if at, ok := prev[k]; ok {
+					next[k] = at
+				} else {
+					next[k] = i
+				}
+			}
+			introduced[db.Path] = next
+			latest[db.Path] = db.Packages
+		}
+	}
+
+	var paths []string
+	for p := range latest {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	pkgs := []Package{}
+	for _, p := range paths {
+		for _, pkg := range latest[p] {
+			at := introduced[p][key{pkg.Name, pkg.Version, pkg.Arch}]
+			pkg.Layer = history[at].LayerID
+			pkg.Instruction = history[at].Instruction()
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	pkgs = append(pkgs, s.attributeDependencies(history)...)
+	sort.SliceStable(pkgs, func(i, j int) bool {
+		if pkgs[i].Type != pkgs[j].Type {
+			return pkgs[i].Type < pkgs[j].Type
+		}
+		return pkgs[i].Name < pkgs[j].Name
+	})
+	return pkgs
+}
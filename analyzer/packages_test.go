@@ -0,0 +1,95 @@
+package analyzer
+
+import (
+	"archive/tar"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const dpkgBase = `Package: libc6
+Status: install ok installed
+Architecture: amd64
+Source: glibc (2.36-9)
+Version: 2.36-9+deb12u4
+Description: GNU C Library
+ multi-line description
+
+Package: removed-pkg
+Status: deinstall ok config-files
+Version: 1.0
+
+Package: bash
+Status: install ok installed
+Architecture: amd64
+Version: 5.2.15-2+b2
+`
+
+const dpkgCurl = dpkgBase + `
+Package: curl
+Status: install ok installed
+Architecture: amd64
+Version: 7.88.1-10+deb12u5
+`
+
+func TestParseDpkgStatus(t *testing.T) {
+	pkgs := parseDpkgStatus([]byte(dpkgBase))
+	assert.Equal(t, []Package{
+		{Type: PackageDeb, Name: "libc6", Version: "2.36-9+deb12u4", Arch: "amd64", Source: "glibc"},
+		{Type: PackageDeb, Name: "bash", Version: "5.2.15-2+b2", Arch: "amd64", Source: "bash"},
+	}, pkgs)
+}
+
+func TestParseApkInstalled(t *testing.T) {
+	pkgs := parseApkInstalled([]byte("C:Q1abc=\nP:musl\nV:1.2.5-r0\nA:x86_64\no:musl\n\nP:busybox-binsh\nV:1.36.1-r29\nA:x86_64\no:busybox\n"))
+	assert.Equal(t, []Package{
+		{Type: PackageApk, Name: "musl", Version: "1.2.5-r0", Arch: "x86_64", Source: "musl"},
+		{Type: PackageApk, Name: "busybox-binsh", Version: "1.36.1-r29", Arch: "x86_64", Source: "busybox"},
+	}, pkgs)
+}
+
+func TestPackageAttribution(t *testing.T) {
+	rpmdb, err := os.ReadFile("../internal/rpmdb/testdata/rpmdb.sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := `{"history": [
+		{"created_by": "/bin/sh -c #(nop) ADD file:abc in / "},
+		{"created_by": "/bin/sh -c apt-get install -y curl"},
+		{"created_by": "/bin/sh -c #(nop) ENV A=b", "empty_layer": true},
+		{"created_by": "COPY rpmdb /var/lib/rpm/rpmdb.sqlite"}
+	]}`
+	data := dockerArchive(t, config,
+		[]testEntry{{hdr: tar.Header{Name: "var/lib/dpkg/status"}, body: dpkgBase}},
+		[]testEntry{{hdr: tar.Header{Name: "./var/lib/dpkg/status"}, body: dpkgCurl}},
+		[]testEntry{{hdr: tar.Header{Name: "var/lib/rpm/rpmdb.sqlite"}, body: string(rpmdb)}},
+	)
+
+	a := newTestAnalyzer(t, Options{})
+	report, err := a.Analyze(context.Background(), &memorySource{name: "pkgs", data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	installedBy := make(map[string]string)
+	for _, p := range report.Packages {
+		installedBy[p.Type+"/"+p.Name] = p.Instruction
+	}
+	assert.Equal(t, map[string]string{
+		"deb/bash":         "ADD file:abc in /",
+		"deb/libc6":        "ADD file:abc in /",
+		"deb/curl":         "RUN apt-get install -y curl",
+		"rpm/bash":         "COPY rpmdb /var/lib/rpm/rpmdb.sqlite",
+		"rpm/openssl-libs": "COPY rpmdb /var/lib/rpm/rpmdb.sqlite",
+		"rpm/tzdata":       "COPY rpmdb /var/lib/rpm/rpmdb.sqlite",
+	}, installedBy)
+	for _, p := range report.Packages {
+		if p.Name == "openssl-libs" {
+			assert.Equal(t, "1:3.0.7-27.el9", p.Version)
+			assert.Equal(t, "openssl", p.Source)
+			assert.Equal(t, "layer2/layer.tar", p.Layer)
+			assert.Equal(t, "var/lib/rpm/rpmdb.sqlite", p.Location)
+		}
+	}
+}
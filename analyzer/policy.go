@@ -0,0 +1,271 @@
+package analyzer
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Policy checks, usable as the check of a Rule
+const (
+	CheckNonRoot          = "non-root"
+	CheckPrivilegedPorts  = "no-privileged-ports"
+	CheckRequiredLabels   = "required-labels"
+	CheckBannedBaseImages = "banned-base-images"
+	CheckMaxLayers        = "max-layers"
+	CheckNoSetuid         = "no-setuid"
+	CheckNoRemoteAdd      = "no-remote-add"
+)
+
+// Rule severities
+const (
+	PolicySeverityError   = "error"
+	PolicySeverityWarning = "warning"
+)
+
+// defaultPrivilegedPorts is the first port unprivileged users can bind.
+const defaultPrivilegedPorts = 1024
+
+// Policy is a set of rules an image must pass, usually loaded from YAML:
+//
+//	rules:
+//	  - id: no-root
+//	    check: non-root
+//	  - id: labels
+//	    check: required-labels
+//	    labels: [org.opencontainers.image.source]
+//	  - id: eol-base
+//	    check: banned-base-images
+//	    images: ["centos:*", "debian:9*"]
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule is one check of a policy with its parameters.
+type Rule struct {
+	ID          string `yaml:"id"`
+	Check       string `yaml:"check"`
+	Description string `yaml:"description"`
+	// Severity is "error", the default, or "warning". Failed warnings are
+	// reported but do not fail the policy.
+	Severity string `yaml:"severity"`
+	// Labels are the labels required by required-labels
+	Labels []string `yaml:"labels"`
+	// Images are the path.Match patterns banned by banned-base-images
+	Images []string `yaml:"images"`
+	// Max is the layer limit of max-layers
+	Max int `yaml:"max"`
+	// Below is the first unprivileged port for no-privileged-ports
+	Below int `yaml:"below"`
+	// Allow lists the paths exempt from no-setuid
+	Allow []string `yaml:"allow"`
+}
+
+// PolicyResult is the outcome of one rule for an image.
+type PolicyResult struct {
+	RuleID      string `json:"rule_id"`
+	Description string `json:"description"`
+	Severity    string `json:"severity"`
+	Passed      bool   `json:"passed"`
+	Message     string `json:"message,omitempty"`
+}
+
+var defaultDescriptions = map[string]string{
+	CheckNonRoot:          "Image must not run as root",
+	CheckPrivilegedPorts:  "Image must not expose privileged ports",
+	CheckRequiredLabels:   "Image must carry the required labels",
+	CheckBannedBaseImages: "Image must not be built on a banned base image",
+	CheckMaxLayers:        "Image must not have too many layers",
+	CheckNoSetuid:         "Image must not contain setuid or setgid files",
+	CheckNoRemoteAdd:      "Dockerfile must not ADD remote URLs",
+}
+
+// LoadPolicy reads and validates a YAML policy file.
+func LoadPolicy(name string) (*Policy, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	p, err := ParsePolicy(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return p, nil
+}
+
+// ParsePolicy parses and validates a YAML policy.
+func ParsePolicy(data []byte) (*Policy, error) {
+	var p Policy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.ID == "" {
+			return nil, fmt.Errorf("rule %d has no id", i+1)
+		}
+		if seen[r.ID] {
+			return nil, fmt.Errorf("duplicate rule id %q", r.ID)
+		}
+		seen[r.ID] = true
+		if _, ok := defaultDescriptions[r.Check]; !ok {
+			return nil, fmt.Errorf("rule %s: unknown check %q", r.ID, r.Check)
+		}
+		if r.Description == "" {
+			r.Description = defaultDescriptions[r.Check]
+		}
+		switch r.Severity {
+		case "":
+			r.Severity = PolicySeverityError
+		case PolicySeverityError, PolicySeverityWarning:
+		default:
+			return nil, fmt.Errorf("rule %s: unknown severity %q", r.ID, r.Severity)
+		}
+		if r.Check == CheckMaxLayers && r.Max <= 0 {
+			return nil, fmt.Errorf("rule %s: max must be positive", r.ID)
+		}
+		for _, pattern := range r.Images {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("rule %s: bad image pattern %q", r.ID, pattern)
+			}
+		}
+	}
+	return &p, nil
+}
+
+// Evaluate runs every rule of the policy against report.
+func (p *Policy) Evaluate(report *Report) []PolicyResult {
+	results := []PolicyResult{}
+	for _, r := range p.Rules {
+		message := r.evaluate(report)
+		results = append(results, PolicyResult{
+			RuleID:      r.ID,
+			Description: r.Description,
+			Severity:    r.Severity,
+			Passed:      message == "",
+			Message:     message,
+		})
+	}
+	return results
+}
+
+// PolicyFailed reports whether any rule of severity error failed.
+func PolicyFailed(results []PolicyResult) bool {
+	for _, r := range results {
+		if !r.Passed && r.Severity == PolicySeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+var remoteAdd = regexp.MustCompile(`^ADD\s.*\bhttps?://`)
+
+// evaluate returns why report breaks the rule, or "" when it passes.
+func (r Rule) evaluate(report *Report) string {
+	md := report.Metadata
+	switch r.Check {
+	case CheckNonRoot:
+		user, _, _ := strings.Cut(md.User, ":")
+		if user == "" || user == "root" || user == "0" {
+			return "image runs as root"
+		}
+		// Other names can have UID 0 too
+		if a := report.Accounts; a != nil && a.User.Resolved && a.User.UID == 0 {
+			return fmt.Sprintf("image runs as %s, which has UID 0", user)
+		}
+	case CheckPrivilegedPorts:
+		below := r.Below
+		if below == 0 {
+			below = defaultPrivilegedPorts
+		}
+		var bad []string
+		for _, port := range md.ExposedPorts {
+			number, _, _ := strings.Cut(port, "/")
+			if n, err := strconv.Atoi(number); err == nil && n < below {
+				bad = append(bad, port)
+			}
+		}
+		if len(bad) > 0 {
+			return "exposes " + strings.Join(bad, ", ")
+		}
+	case CheckRequiredLabels:
+		var missing []string
+		for _, label := range r.Labels {
+			if _, ok := md.Labels[label]; !ok {
+				missing = append(missing, label)
+			}
+		}
+		if len(missing) > 0 {
+			return "missing labels " + strings.Join(missing, ", ")
+		}
+	case CheckBannedBaseImages:
+		for _, base := range baseImages(report) {
+			for _, pattern := range r.Images {
+				if ok, _ := path.Match(pattern, base); ok {
+					return fmt.Sprintf("base image %s matches %s", base, pattern)
+				}
+			}
+		}
+	case CheckMaxLayers:
+		layers := 0
+		for _, h := range report.History {
+			if h.LayerID != "" {
+				layers++
+			}
+		}
+		if layers > r.Max {
+			return fmt.Sprintf("%d layers, more than %d", layers, r.Max)
+		}
+	case CheckNoSetuid:
+		allowed := make(map[string]bool)
+		for _, a := range r.Allow {
+			allowed[CleanPath(a)] = true
+		}
+		var bad []string
+		for name, f := range report.Filesystem() {
+			if f.Mode&(os.ModeSetuid|os.ModeSetgid) != 0 && !allowed[name] {
+				bad = append(bad, name)
+			}
+		}
+		if len(bad) > 0 {
+			sort.Strings(bad)
+			return "setuid or setgid files " + strings.Join(bad, ", ")
+		}
+	case CheckNoRemoteAdd:
+		for _, h := range report.History {
+			if remoteAdd.MatchString(h.Instruction()) {
+				return firstLine(h.Instruction())
+			}
+		}
+	}
+	return ""
+}
+
+// baseImages names the base image of report as far as it is known: the
+// org.opencontainers.image.base.name label and the distribution as
+// "id:version", "debian:12".
+func baseImages(report *Report) []string {
+	var names []string
+	if base := report.Metadata.Labels["org.opencontainers.image.base.name"]; base != "" {
+		names = append(names, base)
+		// Also match without the registry, docker.io/library/debian:12 as debian:12
+		names = append(names, strings.TrimPrefix(strings.TrimPrefix(base, "docker.io/"), "library/"))
+	}
+	if report.OS != nil {
+		names = append(names, report.OS.ID+":"+report.OS.VersionID)
+	}
+	return names
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
@@ -0,0 +1,98 @@
+package analyzer
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testPolicy = `
+rules:
+  - id: no-root
+    check: non-root
+  - id: ports
+    check: no-privileged-ports
+  - id: labels
+    check: required-labels
+    labels: [maintainer, org.opencontainers.image.source]
+  - id: eol-base
+    check: banned-base-images
+    images: ["centos:*", "debian:9*"]
+  - id: layers
+    check: max-layers
+    max: 2
+    severity: warning
+  - id: setuid
+    check: no-setuid
+    allow: [/usr/bin/passwd]
+  - id: remote-add
+    check: no-remote-add
+    description: Use COPY or a checksummed download instead
+`
+
+func TestPolicyEvaluate(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := &Report{
+		Metadata: Metadata{
+			User:         "app",
+			ExposedPorts: []string{"443/tcp", "8080/tcp"},
+			Labels: map[string]string{
+				"maintainer":                         "ops",
+				"org.opencontainers.image.base.name": "docker.io/library/debian:9-slim",
+			},
+		},
+		History: []History{
+			{CreatedBy: "/bin/sh -c #(nop) ADD file:abc in / ", LayerID: "l0", Files: []File{
+				{Path: "usr/bin/passwd", Mode: 0755 | os.ModeSetuid},
+				{Path: "usr/bin/su", Mode: 0755 | os.ModeSetuid},
+			}},
+			{CreatedBy: "ADD https://example.com/app.tgz /app # buildkit", LayerID: "l1"},
+			{CreatedBy: "RUN rm /usr/bin/su", LayerID: "l2", Files: []File{{Path: "usr/bin/.wh.su"}}},
+		},
+	}
+
+	results := make(map[string]PolicyResult)
+	for _, r := range policy.Evaluate(report) {
+		results[r.RuleID] = r
+	}
+	assert.True(t, results["no-root"].Passed)
+	assert.Equal(t, "exposes 443/tcp", results["ports"].Message)
+	assert.Equal(t, "missing labels org.opencontainers.image.source", results["labels"].Message)
+	assert.Equal(t, "Image must carry the required labels", results["labels"].Description)
+	assert.Equal(t, "base image debian:9-slim matches debian:9*", results["eol-base"].Message)
+	assert.Equal(t, PolicyResult{RuleID: "layers", Description: "Image must not have too many layers",
+		Severity: PolicySeverityWarning, Message: "3 layers, more than 2"}, results["layers"])
+	assert.True(t, results["setuid"].Passed, "allowed or deleted setuid files pass")
+	assert.Equal(t, "ADD https://example.com/app.tgz /app # buildkit", results["remote-add"].Message)
+	assert.True(t, PolicyFailed(policy.Evaluate(report)))
+
+	report.Metadata.User = "0:0"
+	assert.Equal(t, "image runs as root", policy.Rules[0].evaluate(report))
+	report.Metadata.User = "toor"
+	report.Accounts = &Accounts{User: ImageUser{Configured: "toor", Resolved: true, Name: "toor"}}
+	assert.Equal(t, "image runs as toor, which has UID 0", policy.Rules[0].evaluate(report))
+}
+
+func TestPolicyFailedIgnoresWarnings(t *testing.T) {
+	assert.False(t, PolicyFailed([]PolicyResult{
+		{RuleID: "a", Severity: PolicySeverityError, Passed: true},
+		{RuleID: "b", Severity: PolicySeverityWarning},
+	}))
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	for policy, want := range map[string]string{
+		"rules:\n  - check: non-root":                                        "rule 1 has no id",
+		"rules:\n  - {id: a, check: non-root}\n  - {id: a, check: non-root}": `duplicate rule id "a"`,
+		"rules:\n  - {id: a, check: no-sudo}":                                `rule a: unknown check "no-sudo"`,
+		"rules:\n  - {id: a, check: max-layers}":                             "rule a: max must be positive",
+		"rules:\n  - {id: a, check: non-root, severity: fatal}":              `rule a: unknown severity "fatal"`,
+	} {
+		_, err := ParsePolicy([]byte(policy))
+		assert.EqualError(t, err, want)
+	}
+}
@@ -0,0 +1,122 @@
+package analyzer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// redactedPrefix caps how much of a secret RedactValue keeps in the clear.
+const redactedPrefix = 4
+
+// RedactValue masks a secret, keeping a short prefix and a truncated SHA-256
+// so the same secret can be recognized across reports: "hu****[3f2a91c0]".
+// At most a quarter of the value is kept.
+func RedactValue(value string) string {
+	keep := min(len(value)/4, redactedPrefix)
+	sum := sha256.Sum256([]byte(value))
+	return value[:keep] + "****[" + hex.EncodeToString(sum[:4]) + "]"
+}
+
+// Redact returns a copy of report in which every secret value found, and the
+// value of every variable or label whose name suggests a secret, is masked
+// with RedactValue wherever it appears: environment, labels, history and the
+// instructions quoted by findings, packages, vulnerabilities, hardening and
+// account issues. The passwords guessed for weak accounts are masked too.
+// A report that is already redacted is returned as is.
+func Redact(report *Report) *Report {
+	if report.Redacted {
+		return report
+	}
+	secrets := make(map[string]bool)
+	for _, f := range slices.Concat(report.Findings, report.Suppressed) {
+		if f.Secret != "" {
+			secrets[f.Secret] = true
+		}
+	}
+	for _, env := range report.Metadata.Env {
+		if name, value, _ := strings.Cut(env, "="); value != "" && secretName(name) {
+			secrets[value] = true
+		}
+	}
+	for name, value := range report.Metadata.Labels {
+		if value != "" && secretName(name) {
+			secrets[value] = true
+		}
+	}
+	// Mask longer secrets first so a secret containing another is hidden whole
+	values := sortedKeys(secrets)
+	sort.SliceStable(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	var pairs []string
+	for _, s := range values {
+		pairs = append(pairs, s, RedactValue(s))
+	}
+	r := strings.NewReplacer(pairs...)
+
+	c := *report
+	c.Redacted = true
+	c.Metadata.Env = slices.Clone(report.Metadata.Env)
+	for i := range c.Metadata.Env {
+		c.Metadata.Env[i] = r.Replace(c.Metadata.Env[i])
+	}
+	c.Metadata.Labels = maps.Clone(report.Metadata.Labels)
+	for k, v := range c.Metadata.Labels {
+		c.Metadata.Labels[k] = r.Replace(v)
+	}
+	c.History = slices.Clone(report.History)
+	for i := range c.History {
+		c.History[i].CreatedBy = r.Replace(c.History[i].CreatedBy)
+	}
+	c.Findings = redactFindings(report.Findings, r)
+	if report.Suppressed != nil {
+		c.Suppressed = redactFindings(report.Suppressed, r)
+	}
+	c.Packages = slices.Clone(report.Packages)
+	for i := range c.Packages {
+		c.Packages[i].Instruction = r.Replace(c.Packages[i].Instruction)
+	}
+	c.Vulnerabilities = slices.Clone(report.Vulnerabilities)
+	for i := range c.Vulnerabilities {
+		c.Vulnerabilities[i].Package.Instruction = r.Replace(c.Vulnerabilities[i].Package.Instruction)
+	}
+	c.Hardening = slices.Clone(report.Hardening)
+	for i := range c.Hardening {
+		c.Hardening[i].Instruction = r.Replace(c.Hardening[i].Instruction)
+	}
+	if report.Accounts != nil {
+		accounts := *report.Accounts
+		accounts.Issues = slices.Clone(report.Accounts.Issues)
+		for i := range accounts.Issues {
+			issue := &accounts.Issues[i]
+			issue.Instruction = r.Replace(issue.Instruction)
+			if issue.Password != "" {
+				masked := RedactValue(issue.Password)
+				issue.Detail = strings.ReplaceAll(issue.Detail, strconv.Quote(issue.Password), strconv.Quote(masked))
+				issue.Password = masked
+			}
+		}
+		c.Accounts = &accounts
+	}
+	c.Policy = slices.Clone(report.Policy)
+	for i := range c.Policy {
+		c.Policy[i].Message = r.Replace(c.Policy[i].Message)
+	}
+	return &c
+}
+
+// redactFindings returns a copy of findings with their secrets masked.
+func redactFindings(findings []Finding, r *strings.Replacer) []Finding {
+	c := slices.Clone(findings)
+	for i := range c {
+		f := &c[i]
+		f.Instruction = r.Replace(f.Instruction)
+		if f.Secret != "" {
+			f.Secret = RedactValue(f.Secret)
+		}
+	}
+	return c
+}
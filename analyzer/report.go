@@ -0,0 +1,241 @@
+package analyzer
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Image formats understood by Analyze.
+const (
+	FormatDocker = "docker"
+	FormatOCI    = "oci"
+)
+
+// Report is the result of analyzing a single image.
+type Report struct {
+	Image    string    `json:"image"`
+	Format   string    `json:"format"`
+	Metadata Metadata  `json:"metadata"`
+	History  []History `json:"history"`
+	Findings []Finding `json:"findings"`
+	// Suppressed are the findings hidden by the baseline of the Analyzer
+	Suppressed []Finding `json:"suppressed,omitempty"`
+	Packages   []Package `json:"packages"`
+	// OS is the distribution of the image, nil when it has no os-release file
+	OS *OSRelease `json:"os,omitempty"`
+	// Vulnerabilities are only looked up when the Analyzer has advisories
+	Vulnerabilities []Vulnerability `json:"vulnerabilities,omitempty"`
+	// Policy holds the result of every rule when the Analyzer has a policy
+	Policy []PolicyResult `json:"policy,omitempty"`
+	// Efficiency measures the bytes wasted on files hidden by later layers
+	Efficiency *Efficiency `json:"efficiency,omitempty"`
+	// Container is set for the reports of AnalyzeContainer
+	Container *Container `json:"container,omitempty"`
+	// Hardening lists the files whose permissions or ownership weaken the
+	// image
+	Hardening []HardeningIssue `json:"hardening,omitempty"`
+	// Accounts resolves the user of the image and lists the weak accounts
+	// of the final filesystem
+	Accounts *Accounts `json:"accounts,omitempty"`
+	// GitRepos lists the .git directories found in layers
+	GitRepos []GitRepo `json:"git_repos,omitempty"`
+	// Keys are the private keys and certificates found in layer files
+	Keys []KeyMaterial `json:"keys,omitempty"`
+	// Warnings are notes about how the image was read, such as layers that
+	// could not be parsed or history that had to be guessed.
+	Warnings []string `json:"warnings,omitempty"`
+	// WarningsBeforeFindings is the number of Warnings noted before the
+	// first file name was checked for secrets. The console output prints
+	// the findings there, as the original tool did while reading the image.
+	WarningsBeforeFindings int `json:"warnings_before_findings,omitempty"`
+	// Redacted is set once Redact has masked the secrets of the report
+	Redacted bool `json:"redacted,omitempty"`
+}
+
+// Sources of Metadata.
+const (
+	MetadataDaemon = "daemon"
+	MetadataConfig = "config"
+)
+
+// Metadata identifies an image and describes its runtime configuration.
+type Metadata struct {
+	// Source is MetadataDaemon or MetadataConfig, and empty when the image
+	// has no config to describe it
+	Source        string            `json:"source,omitempty"`
+	ID            string            `json:"id,omitempty"`
+	DockerVersion string            `json:"docker_version,omitempty"`
+	GraphDriver   string            `json:"graph_driver,omitempty"`
+	Env           []string          `json:"env,omitempty"`
+	ExposedPorts  []string          `json:"exposed_ports,omitempty"`
+	User          string            `json:"user,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+}
+
+// Container describes a container analyzed by AnalyzeContainer.
+type Container struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Image is the reference the container was created from
+	Image   string `json:"image"`
+	State   string `json:"state,omitempty"`
+	Started string `json:"started,omitempty"`
+	// Changes are the files added, changed or removed since the container
+	// started, as listed by the daemon
+	Changes []FileChange `json:"changes"`
+}
+
+// FileChange is a file changed in a container.
+type FileChange struct {
+	Path string `json:"path"`
+	// Kind is Added, Changed or Removed
+	Kind string `json:"kind"`
+}
+
+// History is one entry of the image history, joined with the files of the
+// layer it created.
+type History struct {
+	Created    string `json:"created"`
+	CreatedBy  string `json:"created_by"`
+	EmptyLayer bool   `json:"empty_layer"`
+	LayerID    string `json:"layer_id,omitempty"`
+	// Digest is the sha256 of the uncompressed layer tar, its diff ID.
+	Digest string `json:"digest,omitempty"`
+	// Size is the size of the uncompressed layer tar, and CompressedSize
+	// its size gzip compressed. Layers stored uncompressed in the image are
+	// compressed at the default level to estimate the size in a registry.
+	Size           int64 `json:"size,omitempty"`
+	CompressedSize int64 `json:"compressed_size,omitempty"`
+	// WastedBytes is the size of the files of the layer that later layers
+	// overwrite or delete
+	WastedBytes int64  `json:"wasted_bytes,omitempty"`
+	Files       []File `json:"files,omitempty"`
+}
+
+// File is an entry of a layer tarball.
+type File struct {
+	Path     string      `json:"path"`
+	Size     int64       `json:"size,omitempty"`
+	Mode     os.FileMode `json:"mode,omitempty"`
+	ModTime  time.Time   `json:"mod_time"`
+	Linkname string      `json:"linkname,omitempty"`
+	UID      int         `json:"uid,omitempty"`
+	GID      int         `json:"gid,omitempty"`
+	// Capabilities are the file capabilities granted by the
+	// security.capability extended attribute, formatted like getcap
+	Capabilities string `json:"capabilities,omitempty"`
+	// Noise is set for files matching the ignore list, such as node_modules.
+	Noise bool `json:"noise,omitempty"`
+}
+
+// Package is a piece of software installed in the image.
+type Package struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Arch    string `json:"arch,omitempty"`
+	// Source is the source package the package was built from
+	Source string `json:"source,omitempty"`
+	// Location is the file the package was read from
+	Location string `json:"location"`
+	// Layer and Instruction identify where the package was installed
+	Layer       string `json:"layer"`
+	Instruction string `json:"instruction"`
+}
+
+// OSRelease identifies the distribution an image is built on, as read from
+// its os-release file.
+type OSRelease struct {
+	ID        string `json:"id"`
+	VersionID string `json:"version_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+// Vulnerability is a known advisory affecting an installed package.
+type Vulnerability struct {
+	ID       string   `json:"id"`
+	CVEs     []string `json:"cves,omitempty"`
+	Severity string   `json:"severity"`
+	// Score is the CVSS v3 base score, zero when the advisory has none
+	Score   float64 `json:"score,omitempty"`
+	Summary string  `json:"summary,omitempty"`
+	// Package is the affected package and where it was installed
+	Package      Package `json:"package"`
+	FixedVersion string  `json:"fixed_version,omitempty"`
+}
+
+// Finding is a potential secret found in an image.
+type Finding struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Pattern     string `json:"pattern"`
+	Path        string `json:"path"`
+	Layer       string `json:"layer"`
+	// Instruction is set for findings outside of layer files, such as
+	// environment variables, and names the instruction that set them
+	Instruction string `json:"instruction,omitempty"`
+	// HistoryIndex is the index in History of Instruction, as instructions
+	// can repeat
+	HistoryIndex *int `json:"history_index,omitempty"`
+	// Secret is the secret value found, empty for findings on file names
+	Secret string `json:"secret,omitempty"`
+	// Entropy is the Shannon entropy of Secret in bits per character, set
+	// by the entropy detector
+	Entropy float64 `json:"entropy,omitempty"`
+	// Validation is the result of the offline check of the format of
+	// Secret: confirmed-format, unverified or invalid-format
+	Validation string `json:"validation,omitempty"`
+	// Fingerprint identifies the finding across runs, see Fingerprint
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// Instruction returns the Dockerfile instruction that produced h.
+func (h History) Instruction() string {
+	return cleanString(h.CreatedBy)
+}
+
+// IsCopy reports whether h was produced by an ADD or COPY instruction.
+func (h History) IsCopy() bool {
+	return strings.Contains(h.CreatedBy, "ADD") || strings.Contains(h.CreatedBy, "COPY")
+}
+
+// sortedPorts flattens an ExposedPorts map into a sorted list such as "80/tcp".
+func sortedPorts[K ~string, V any](ports map[K]V) []string {
+	var result []string
+	for port := range ports {
+		result = append(result, string(port))
+	}
+	sort.Strings(result)
+	return result
+}
+
+func cleanString(str string) string {
+	s := strings.Join(strings.Fields(str), " ")
+	s = strings.Replace(s, "&&", "\\\n\t&&", -1)
+
+	// Handle strings that start with /bin/sh -c
+	if strings.HasPrefix(s, "/bin/sh -c ") {
+		if strings.HasPrefix(s, "/bin/sh -c #(nop)") {
+			// Non-operation commands (like LABEL, ENV, etc.)
+			s = strings.Replace(s, "/bin/sh -c ", "", -1)
+			s = strings.Replace(s, "#(nop) ", "", -1)
+		} else {
+			// RUN commands
+			s = strings.Replace(s, "/bin/sh -c ", "RUN ", -1)
+		}
+	}
+
+	// Check if the string already starts with RUN and has a duplicated /bin/sh -c
+	if strings.HasPrefix(s, "RUN /bin/sh -c ") {
+		s = strings.Replace(s, "RUN /bin/sh -c ", "RUN ", 1)
+	}
+
+	// Remove double RUN prefix if it exists
+	if strings.HasPrefix(s, "RUN RUN ") {
+		s = strings.Replace(s, "RUN RUN ", "RUN ", 1)
+	}
+
+	return s
+}
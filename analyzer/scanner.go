@@ -1,53 +1,91 @@
-package main
+package analyzer
 
 import (
-	"regexp"
 	"encoding/json"
-	"io"
-	"github.com/fatih/color"
+	"fmt"
+	"regexp"
 )
 
-var patterns []Pattern
-
+// Pattern is a single secret signature from the built-in pattern set.
 type Pattern struct {
 	Description string
-	SecretType string
-	Value string
-	Regex *regexp.Regexp
+	SecretType  string
+	Value       string
+	// Validator optionally names the offline check of the structure of
+	// matches, see validators
+	Validator string
+	Regex     *regexp.Regexp
 }
 
-func compileSecretPatterns(){
+// compileSecretPatterns parses the built-in pattern set and compiles each
+// expression. Every Analyzer owns its own copy.
+func compileSecretPatterns() ([]Pattern, error) {
 	var temp []Pattern
-	if err := json.Unmarshal(patternsJson, &temp); err != nil {
-		panic(err)
+	if err := json.Unmarshal([]byte(patternsJSON), &temp); err != nil {
+		return nil, err
 	}
-	patterns = temp[:0]
-	for _, i := range temp{
-		i.Regex = regexp.MustCompile(i.Value)
+	patterns := temp[:0]
+	for _, i := range temp {
+		r, err := regexp.Compile(i.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret pattern %q: %v", i.Description, err)
+		}
+		if _, ok := validators[i.Validator]; i.Validator != "" && !ok {
+			return nil, fmt.Errorf("secret pattern %q: unknown validator %q", i.Description, i.Validator)
+		}
+		i.Regex = r
 		patterns = append(patterns, i)
 	}
+	return patterns, nil
 }
 
-func scanFilename(filename string, loc string) {
-	for _, i := range patterns{
-		if i.SecretType == "Filename" &&i.Regex.MatchString(filename){
-			color.Green("|Found match %s %s %s %s", filename, i.Description, i.Value, loc)
+// scanFilename records the first filename pattern matching filename.
+func (s *scan) scanFilename(filename string, loc string) {
+	for _, i := range s.a.patterns {
+		if i.SecretType == "Filename" && i.Regex.MatchString(filename) {
+			s.report.Findings = append(s.report.Findings, Finding{
+				Type:        i.SecretType,
+				Description: i.Description,
+				Pattern:     i.Value,
+				Path:        filename,
+				Layer:       loc,
+			})
 			break
 		}
 	}
 }
 
-func scanFileContent(reader io.Reader){
-	/*
-	for _, i := range patterns{
-		if i.regex.MatchString(reader){
-			color.Green("Found match %s", filename)
-		}
-	}
-	*/
-}
-
-var patternsJson = []byte(`[
+const patternsJSON = `[
+    {
+        "description": "GitHub token", 
+        "secretType": "FileContent", 
+        "value": "\\b(gh[pousr]_[A-Za-z0-9]{36}|github_pat_[A-Za-z0-9]{22}_[A-Za-z0-9]{59})\\b", 
+        "validator": "github"
+    }, 
+    {
+        "description": "AWS access key ID", 
+        "secretType": "FileContent", 
+        "value": "\\b(A3T[A-Z0-9]|AKIA|ASIA|ABIA|ACCA|AGPA|AIDA|AIPA|ANPA|ANVA|AROA|APKA|ASCA)[A-Z0-9]{16}\\b", 
+        "validator": "aws"
+    }, 
+    {
+        "description": "JSON Web Token", 
+        "secretType": "FileContent", 
+        "value": "\\beyJ[A-Za-z0-9_-]+\\.eyJ[A-Za-z0-9_-]+\\.[A-Za-z0-9_-]*", 
+        "validator": "jwt"
+    }, 
+    {
+        "description": "Private key", 
+        "secretType": "FileContent", 
+        "value": "-----BEGIN[A-Z ]*PRIVATE KEY-----[\\s\\S]+?-----END[A-Z ]*PRIVATE KEY-----", 
+        "validator": "pem"
+    }, 
+    {
+        "description": "Slack token", 
+        "secretType": "FileContent", 
+        "value": "\\bxox[abeoprs]-[0-9A-Za-z-]{10,}", 
+        "validator": "slack"
+    }, 
     {
         "description": "Azure storage standard key format", 
         "secretType": "FileContent", 
@@ -769,4 +807,4 @@ var patternsJson = []byte(`[
         "value": "secret\\s*[\\=]+"
     }
 ]
-`)
\ No newline at end of file
+`
@@ -0,0 +1,213 @@
+package analyzer
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/moby/term"
+)
+
+// DockerClient interface defines the methods we need from the Docker client
+type DockerClient interface {
+	ImageInspectWithRaw(ctx context.Context, imageID string) (image.InspectResponse, []byte, error)
+	ImageSave(ctx context.Context, imageIDs []string, options ...client.ImageSaveOption) (io.ReadCloser, error)
+	ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error)
+	ContainerDiff(ctx context.Context, containerID string) ([]container.FilesystemChange, error)
+	ContainerExport(ctx context.Context, containerID string) (io.ReadCloser, error)
+	Close() error
+}
+
+// Source provides the docker save or OCI layout tarball of an image.
+type Source interface {
+	// Name identifies the image in reports and extracted directories.
+	Name() string
+	// Open returns a fresh stream of the image tarball. Callers close it.
+	Open(ctx context.Context) (io.ReadCloser, error)
+}
+
+// Inspector is implemented by sources that can describe an image without
+// reading its layers.
+type Inspector interface {
+	Inspect(ctx context.Context) (Metadata, error)
+}
+
+// DockerImage is an image held by a docker daemon.
+type DockerImage struct {
+	Client DockerClient
+	Ref    string
+	// Progress receives the daemon's progress messages when the image is
+	// not available locally. Nothing is printed when it is nil.
+	Progress io.Writer
+}
+
+func (d *DockerImage) Name() string { return d.Ref }
+
+func (d *DockerImage) Open(ctx context.Context) (io.ReadCloser, error) {
+	return d.Client.ImageSave(ctx, []string{d.Ref})
+}
+
+func (d *DockerImage) Inspect(ctx context.Context) (Metadata, error) {
+	info, _, err := d.Client.ImageInspectWithRaw(ctx, d.Ref)
+	if err != nil {
+		out, err := d.Client.ImageSave(ctx, []string{d.Ref})
+		if err != nil {
+			return Metadata{}, err
+		}
+		defer out.Close()
+		progress := d.Progress
+		if progress == nil {
+			progress = io.Discard
+		}
+		fd, isTerminal := term.GetFdInfo(progress)
+		if err := jsonmessage.DisplayJSONMessagesStream(out, progress, fd, isTerminal, nil); err != nil {
+			fmt.Fprintln(progress, err)
+		}
+		info, _, err = d.Client.ImageInspectWithRaw(ctx, d.Ref)
+		if err != nil {
+			return Metadata{}, err
+		}
+	}
+	md := Metadata{
+		Source:        MetadataDaemon,
+		ID:            info.ID,
+		DockerVersion: info.DockerVersion,
+		GraphDriver:   info.GraphDriver.Name,
+	}
+	if info.Config != nil {
+		md.Env = info.Config.Env
+		md.ExposedPorts = sortedPorts(info.Config.ExposedPorts)
+		md.User = info.Config.User
+		md.Labels = info.Config.Labels
+	}
+	return md, nil
+}
+
+// TarFile is an image saved to disk with docker save.
+type TarFile struct {
+	Path string
+	// Stream reads the file again on every Open rather than holding it in
+	// memory, for files too large to keep, such as uploads.
+	Stream bool
+
+	data []byte
+}
+
+// Name is the base name of the tar file without its extension.
+func (t *TarFile) Name() string {
+	imageID := filepath.Base(t.Path)
+	return strings.TrimSuffix(imageID, filepath.Ext(imageID))
+}
+
+// Open reads the file once and serves every later Open from memory, unless
+// t streams it.
+func (t *TarFile) Open(ctx context.Context) (io.ReadCloser, error) {
+	if t.Stream {
+		f, err := os.Open(t.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar file: %v", err)
+		}
+		return f, nil
+	}
+	if t.data == nil {
+		data, err := os.ReadFile(t.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar file: %v", err)
+		}
+		t.data = data
+	}
+	return io.NopCloser(bytes.NewReader(t.data)), nil
+}
+
+func (t *TarFile) Inspect(ctx context.Context) (Metadata, error) {
+	r, err := t.Open(ctx)
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer r.Close()
+	config, err := extractImageConfig(r)
+	if err != nil {
+		return Metadata{}, err
+	}
+	if config == nil {
+		return Metadata{}, nil
+	}
+	md := config.metadata()
+	md.GraphDriver = "overlay2" // Default for tar files
+	return md, nil
+}
+
+// maxManifestSize is the largest blob ImageDigest reads looking for the
+// manifests of an OCI layout.
+const maxManifestSize = 1 << 20
+
+// ImageDigest returns the ID of the image behind source, the digest of its
+// config, without analyzing its layers. It matches Report.Metadata.ID.
+func ImageDigest(ctx context.Context, source Source) (string, error) {
+	if inspector, ok := source.(Inspector); ok {
+		md, err := inspector.Inspect(ctx)
+		if err != nil {
+			return "", err
+		}
+		if md.ID != "" {
+			return md.ID, nil
+		}
+	}
+	imageStream, err := source.Open(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer imageStream.Close()
+	var configs []manifest
+	ociConfigs := make(map[string][]byte)
+	tr := tar.NewReader(imageStream)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case hdr.Name == "manifest.json":
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return "", err
+			}
+			if err := json.Unmarshal(data, &configs); err != nil {
+				return "", fmt.Errorf("unable to parse manifest.json: %v", err)
+			}
+		case hdr.Name == "index.json" && len(configs) == 0:
+			var index ociIndex
+			if err := json.NewDecoder(tr).Decode(&index); err != nil {
+				return "", fmt.Errorf("unable to parse OCI index.json: %v", err)
+			}
+			if len(index.Manifests) > 0 {
+				configs = []manifest{{Config: strings.TrimPrefix(index.Manifests[0].Digest, "sha256:")}}
+			}
+		case strings.HasPrefix(hdr.Name, "blobs/sha256/") && hdr.Typeflag == tar.TypeReg && hdr.Size <= maxManifestSize:
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return "", err
+			}
+			if containsJSON(data) {
+				ociConfigs[filepath.Base(hdr.Name)] = data
+			}
+		}
+	}
+	if digest := configDigest(configs, ociConfigs); digest != "" {
+		return digest, nil
+	}
+	return "", fmt.Errorf("no manifest.json or index.json found in image")
+}
@@ -0,0 +1,173 @@
+package analyzer
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"hash/crc32"
+	"regexp"
+	"strings"
+)
+
+// Validation results of a finding. Validators check the structure of a
+// secret offline, they never tell whether it is still active.
+const (
+	// ValidationConfirmed means the secret has the exact structure of its
+	// format, checksums included
+	ValidationConfirmed = "confirmed-format"
+	// ValidationUnverified means the format has no structure to check
+	ValidationUnverified = "unverified"
+	// ValidationInvalid means the match cannot be a secret of the format,
+	// usually a false positive
+	ValidationInvalid = "invalid-format"
+)
+
+// validators maps the validator names usable in patterns to their checks.
+var validators = map[string]func(secret string) string{
+	"github": validateGitHubToken,
+	"aws":    validateAWSKeyID,
+	"jwt":    validateJWT,
+	"pem":    validatePrivateKey,
+	"slack":  validateSlackToken,
+}
+
+// validate runs the validator of p against secret.
+func (p Pattern) validate(secret string) string {
+	if p.Validator == "" {
+		return ValidationUnverified
+	}
+	return validators[p.Validator](secret)
+}
+
+func confirmedIf(ok bool) string {
+	if ok {
+		return ValidationConfirmed
+	}
+	return ValidationInvalid
+}
+
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+var gitHubToken = regexp.MustCompile(`^gh[pousr]_[A-Za-z0-9]{36}$`)
+
+// validateGitHubToken checks the CRC32 that ends GitHub tokens: the last six
+// characters are the checksum of the 30 before them, in zero padded base62.
+// Fine-grained github_pat_ tokens carry no checksum.
+func validateGitHubToken(secret string) string {
+	if strings.HasPrefix(secret, "github_pat_") {
+		return ValidationUnverified
+	}
+	if !gitHubToken.MatchString(secret) {
+		return ValidationInvalid
+	}
+	body, checksum := secret[4:34], secret[34:]
+	return confirmedIf(encodeBase62(crc32.ChecksumIEEE([]byte(body)), 6) == checksum)
+}
+
+func encodeBase62(n uint32, width int) string {
+	var b []byte
+	for n > 0 {
+		b = append([]byte{base62[n%62]}, b...)
+		n /= 62
+	}
+	for len(b) < width {
+		b = append([]byte{'0'}, b...)
+	}
+	return string(b)
+}
+
+// awsKeyIDPrefixes are the unique ID prefixes of AWS resources that can
+// appear as access key IDs.
+var awsKeyIDPrefixes = []string{"AKIA", "ASIA", "ABIA", "ACCA", "AGPA", "AIDA", "AIPA", "ANPA", "ANVA", "AROA", "APKA", "ASCA", "A3T"}
+
+var awsKeyIDBody = regexp.MustCompile(`^[A-Z2-7]+$`)
+
+// validateAWSKeyID checks the prefix of an AWS access key ID and that the
+// rest is base32.
+func validateAWSKeyID(secret string) string {
+	if len(secret) != 20 {
+		return ValidationInvalid
+	}
+	for _, prefix := range awsKeyIDPrefixes {
+		if strings.HasPrefix(secret, prefix) {
+			return confirmedIf(awsKeyIDBody.MatchString(secret[len(prefix):]))
+		}
+	}
+	return ValidationInvalid
+}
+
+// validateJWT checks that a token has a JSON header naming its algorithm, a
+// JSON object payload and a signature unless the algorithm is none.
+func validateJWT(secret string) string {
+	parts := strings.Split(secret, ".")
+	if len(parts) != 3 {
+		return ValidationInvalid
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	var payload map[string]interface{}
+	if !decodeJWTPart(parts[0], &header) || header.Alg == "" || !decodeJWTPart(parts[1], &payload) {
+		return ValidationInvalid
+	}
+	if strings.EqualFold(header.Alg, "none") {
+		return ValidationConfirmed
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[2], "="))
+	return confirmedIf(err == nil && len(signature) > 0)
+}
+
+func decodeJWTPart(part string, v interface{}) bool {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(part, "="))
+	return err == nil && json.Unmarshal(data, v) == nil
+}
+
+// validatePrivateKey checks that a PEM private key block decodes and that its
+// content parses as the key type of the block. Encrypted keys are only
+// checked to be DER.
+func validatePrivateKey(secret string) string {
+	block, _ := pem.Decode([]byte(secret))
+	if block == nil {
+		return ValidationInvalid
+	}
+	if _, encrypted := block.Headers["DEK-Info"]; encrypted {
+		return confirmedIf(len(block.Bytes) > 0)
+	}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		_, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		_, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		_, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "DSA PRIVATE KEY", "ENCRYPTED PRIVATE KEY":
+		var seq asn1.RawValue
+		_, err = asn1.Unmarshal(block.Bytes, &seq)
+	case "OPENSSH PRIVATE KEY":
+		return confirmedIf(bytes.HasPrefix(block.Bytes, []byte("openssh-key-v1\x00")))
+	default:
+		return ValidationInvalid
+	}
+	return confirmedIf(err == nil)
+}
+
+var (
+	slackBotToken  = regexp.MustCompile(`^xoxb-[0-9]{8,13}-[0-9]{8,13}-[A-Za-z0-9]{24}$`)
+	slackUserToken = regexp.MustCompile(`^xoxp-[0-9]{8,13}-[0-9]{8,13}-[0-9]{8,13}-[a-f0-9]{32}$`)
+)
+
+// validateSlackToken checks the shape of Slack bot and user tokens. Other
+// token types have no documented shape.
+func validateSlackToken(secret string) string {
+	switch {
+	case strings.HasPrefix(secret, "xoxb-"):
+		return confirmedIf(slackBotToken.MatchString(secret))
+	case strings.HasPrefix(secret, "xoxp-"):
+		return confirmedIf(slackUserToken.MatchString(secret))
+	}
+	return ValidationUnverified
+}
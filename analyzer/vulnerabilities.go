@@ -0,0 +1,148 @@
+package analyzer
+
+import (
+	"io"
+	"sort"
+	"strings"
+
+	"whaler/vulndb"
+)
+
+// isOSRelease reports whether name is an os-release file.
+func isOSRelease(name string) bool {
+	name = CleanPath(name)
+	return name == "etc/os-release" || name == "usr/lib/os-release"
+}
+
+// readOSRelease records the distribution described by an os-release file of
+// layerName. Later layers override earlier ones.
+func (s *scan) readOSRelease(layerName string, r io.Reader) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		s.warn("%s: failed to read os-release: %v", layerName, err)
+		return
+	}
+	release := &OSRelease{}
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, `"'`)
+		switch key {
+		case "ID":
+			release.ID = value
+		case "VERSION_ID":
+			release.VersionID = value
+		case "PRETTY_NAME":
+			release.Name = value
+		}
+	}
+	if release.ID != "" {
+		s.osReleases[layerName] = release
+	}
+}
+
+// osEcosystem returns the OSV ecosystem and release that OS packages of
+// pkgType are published under for release, or "" when there is none.
+func osEcosystem(pkgType string, release *OSRelease) (string, string) {
+	var id, version string
+	if release != nil {
+		id, version = release.ID, release.VersionID
+	}
+	major, _, _ := strings.Cut(version, ".")
+	switch pkgType {
+	case PackageDeb:
+		if id == "ubuntu" {
+			return "Ubuntu", version
+		}
+		return "Debian", major
+	case PackageApk:
+		switch id {
+		case "wolfi":
+			return "Wolfi", ""
+		case "chainguard":
+			return "Chainguard", ""
+		}
+		if parts := strings.SplitN(version, ".", 3); len(parts) >= 2 {
+			return "Alpine", "v" + parts[0] + "." + parts[1]
+		}
+		return "Alpine", ""
+	case PackageRpm:
+		switch id {
+		case "almalinux":
+			return "AlmaLinux", major
+		case "rocky":
+			return "Rocky Linux", major
+		}
+	}
+	return "", ""
+}
+
+// languageEcosystems maps language package types to OSV ecosystems.
+var languageEcosystems = map[string]string{
+	PackageNpm:    "npm",
+	PackagePypi:   "PyPI",
+	PackageGem:    "RubyGems",
+	PackageMaven:  "Maven",
+	PackageGolang: "Go",
+}
+
+// matchVulnerabilities looks up every package of the report in db. OS
+// advisories are usually published for source packages, so those are tried
+// before the binary package name.
+func matchVulnerabilities(db *vulndb.DB, report *Report) []Vulnerability {
+	vulns := []Vulnerability{}
+	for _, pkg := range report.Packages {
+		ecosystem, ok := languageEcosystems[pkg.Type]
+		release := ""
+		names := []string{pkg.Name}
+		version := pkg.Version
+		if ok {
+			if pkg.Type == PackageGolang {
+				version = strings.TrimPrefix(version, "v")
+			}
+		} else {
+			ecosystem, release = osEcosystem(pkg.Type, report.OS)
+			if ecosystem == "" {
+				continue
+			}
+			if pkg.Source != "" && pkg.Source != pkg.Name {
+				names = []string{pkg.Source, pkg.Name}
+			}
+		}
+
+		seen := make(map[string]bool)
+		for _, name := range names {
+			for _, m := range db.Match(ecosystem, release, name, version) {
+				if seen[m.Advisory.ID] {
+					continue
+				}
+				seen[m.Advisory.ID] = true
+				vulns = append(vulns, Vulnerability{
+					ID:           m.Advisory.ID,
+					CVEs:         m.Advisory.CVEs(),
+					Severity:     m.Severity,
+					Score:        m.Score,
+					Summary:      m.Advisory.Summary,
+					Package:      pkg,
+					FixedVersion: m.Fixed,
+				})
+			}
+		}
+	}
+	sort.SliceStable(vulns, func(i, j int) bool {
+		if ri, rj := severityRank[vulns[i].Severity], severityRank[vulns[j].Severity]; ri != rj {
+			return ri > rj
+		}
+		return vulns[i].ID < vulns[j].ID
+	})
+	return vulns
+}
+
+var severityRank = map[string]int{
+	vulndb.SeverityCritical: 4,
+	vulndb.SeverityHigh:     3,
+	vulndb.SeverityMedium:   2,
+	vulndb.SeverityLow:      1,
+}
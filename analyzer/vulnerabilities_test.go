@@ -0,0 +1,62 @@
+package analyzer
+
+import (
+	"archive/tar"
+	"context"
+	"testing"
+
+	"whaler/vulndb"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchVulnerabilities(t *testing.T) {
+	db, err := vulndb.Open("../vulndb/testdata/osv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := `{"history": [
+		{"created_by": "/bin/sh -c #(nop) ADD file:abc in / "},
+		{"created_by": "COPY app /app"}
+	]}`
+	data := dockerArchive(t, config,
+		[]testEntry{
+			{hdr: tar.Header{Name: "usr/lib/os-release"}, body: "PRETTY_NAME=\"Debian GNU/Linux 12 (bookworm)\"\nID=debian\nVERSION_ID=\"12\"\n"},
+			{hdr: tar.Header{Name: "var/lib/dpkg/status"}, body: dpkgBase},
+		},
+		[]testEntry{{hdr: tar.Header{Name: "app/package-lock.json"}, body: packageLock}},
+	)
+
+	a := newTestAnalyzer(t, Options{Advisories: db})
+	report, err := a.Analyze(context.Background(), &memorySource{name: "vulns", data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &OSRelease{ID: "debian", VersionID: "12", Name: "Debian GNU/Linux 12 (bookworm)"}, report.OS)
+	if !assert.Len(t, report.Vulnerabilities, 2) {
+		return
+	}
+	express := report.Vulnerabilities[0]
+	assert.Equal(t, "GHSA-rv95-896h-c2vc", express.ID)
+	assert.Equal(t, []string{"CVE-2024-29041"}, express.CVEs)
+	assert.Equal(t, vulndb.SeverityMedium, express.Severity)
+	assert.Equal(t, "4.19.2", express.FixedVersion)
+	assert.Equal(t, "COPY app /app", express.Package.Instruction)
+
+	glibc := report.Vulnerabilities[1]
+	assert.Equal(t, "DEBIAN-CVE-2023-4911", glibc.ID)
+	assert.Equal(t, "libc6", glibc.Package.Name)
+	assert.Equal(t, "layer0/layer.tar", glibc.Package.Layer)
+	assert.Equal(t, "ADD file:abc in /", glibc.Package.Instruction)
+}
+
+func TestOSEcosystem(t *testing.T) {
+	ecosystem, release := osEcosystem(PackageApk, &OSRelease{ID: "alpine", VersionID: "3.19.1"})
+	assert.Equal(t, "Alpine", ecosystem)
+	assert.Equal(t, "v3.19", release)
+	ecosystem, release = osEcosystem(PackageDeb, &OSRelease{ID: "ubuntu", VersionID: "22.04"})
+	assert.Equal(t, "Ubuntu", ecosystem)
+	assert.Equal(t, "22.04", release)
+	ecosystem, _ = osEcosystem(PackageRpm, nil)
+	assert.Equal(t, "", ecosystem)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"whaler/analyzer"
+	"whaler/render"
+)
+
+// runCache implements whaler cache stats and whaler cache prune on the
+// -layer-cache-dir directory.
+func runCache(a *analyzer.Analyzer, args []string) error {
+	const usage = "usage: whaler cache stats | whaler cache prune [-unused-for 720h] [-all]"
+	if len(args) == 0 {
+		return fmt.Errorf(usage)
+	}
+	cache := &analyzer.LayerCache{Dir: *layerCacheDir}
+	switch args[0] {
+	case "stats":
+		stats, err := cache.Stats(a.CacheNamespace())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Layer cache: %s\n", cache.Dir)
+		fmt.Printf("Layers: %d, %s\n", stats.Layers, render.FormatBytes(stats.Bytes))
+		fmt.Printf("Usable with the current patterns and options: %d, %s\n", stats.Usable, render.FormatBytes(stats.UsableBytes))
+		fmt.Printf("Scanner versions and pattern sets: %d\n", stats.Namespaces)
+		if stats.Layers > 0 {
+			fmt.Printf("Last used: %s to %s\n", stats.Oldest.Format(time.DateTime), stats.Newest.Format(time.DateTime))
+		}
+		return nil
+	case "prune":
+		fs := flag.NewFlagSet("cache prune", flag.ContinueOnError)
+		unusedFor := fs.Duration("unused-for", 30*24*time.Hour, "Remove the layers not used for this long")
+		all := fs.Bool("all", false, "Remove every layer")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		before := time.Now().Add(-*unusedFor)
+		if *all {
+			before = time.Now().Add(time.Second)
+		}
+		layers, bytes, err := cache.Prune(before)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed %d layers, %s\n", layers, render.FormatBytes(bytes))
+		return nil
+	}
+	return fmt.Errorf(usage)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"whaler/analyzer"
+	"whaler/render"
+
+	"github.com/fatih/color"
+)
+
+// runContainer implements whaler container, which reports what changed in
+// a container since it started on top of the history of its image.
+func runContainer(a *analyzer.Analyzer, r render.Renderer, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: whaler container <id or name>")
+	}
+	cli, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	report, err := a.AnalyzeContainer(context.Background(), cli, args[0])
+	if err != nil {
+		return err
+	}
+	if err := r.Render(color.Output, report); err != nil {
+		return err
+	}
+	if analyzer.PolicyFailed(report.Policy) {
+		policyFailed = true
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"whaler/analyzer"
+	"whaler/render"
+
+	"github.com/fatih/color"
+)
+
+// sourceFor returns the image behind ref: a docker save tar file on disk, or
+// an image known to the docker daemon, in which case *cli is connected if
+// it is not yet.
+func sourceFor(ref string, cli *analyzer.DockerClient) (analyzer.Source, error) {
+	if info, err := os.Stat(ref); err == nil && info.Mode().IsRegular() {
+		return &analyzer.TarFile{Path: ref}, nil
+	}
+	if *cli == nil {
+		var err error
+		if *cli, err = newDockerClient(); err != nil {
+			return nil, err
+		}
+	}
+	return &analyzer.DockerImage{Client: *cli, Ref: ref, Progress: os.Stderr}, nil
+}
+
+// runDiff implements whaler diff <imageA> <imageB>. Each image is either a
+// docker save tar file on disk or an image known to the docker daemon.
+func runDiff(a *analyzer.Analyzer, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: whaler diff <imageA> <imageB>")
+	}
+	var cli analyzer.DockerClient
+	defer func() {
+		if cli != nil {
+			cli.Close()
+		}
+	}()
+
+	var reports []*analyzer.Report
+	for _, ref := range args {
+		source, err := sourceFor(ref, &cli)
+		if err != nil {
+			return err
+		}
+		report, err := a.Analyze(context.Background(), source)
+		if err != nil {
+			return fmt.Errorf("%s: %v", ref, err)
+		}
+		reports = append(reports, report)
+	}
+	return render.RenderDiff(color.Output, *outputFormat, analyzer.Compare(reports[0], reports[1]))
+}
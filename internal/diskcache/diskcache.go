@@ -0,0 +1,51 @@
+// Package diskcache holds what the layer cache of the analyzer and the
+// report cache of the server share: naming entries after image or layer
+// digests and writing them so that readers never see them partially
+// written.
+package diskcache
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// digest matches the digests usable as cache keys, which keeps file names
+// derived from them inside the cache directory.
+var digest = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// Path returns the file named after digest with extension ext in dir, or
+// false when digest is not a sha256 digest.
+func Path(dir, d, ext string) (string, bool) {
+	if !digest.MatchString(d) {
+		return "", false
+	}
+	return filepath.Join(dir, strings.Replace(d, ":", "-", 1)+ext), true
+}
+
+// WriteFile creates name, and its directory, with the data write writes.
+// The data goes to a temporary file renamed to name once complete. Both are
+// only readable by their owner, entries may hold secrets in clear text.
+func WriteFile(name string, write func(w io.Writer) error) error {
+	dir := filepath.Dir(name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(name)+"-*")
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
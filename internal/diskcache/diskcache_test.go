@@ -0,0 +1,50 @@
+package diskcache
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPath(t *testing.T) {
+	d := "sha256:" + strings.Repeat("ab", 32)
+	name, ok := Path("cache", d, ".json")
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join("cache", "sha256-"+strings.Repeat("ab", 32)+".json"), name)
+
+	for _, bad := range []string{"sha256:../../etc/passwd", "sha256:" + strings.Repeat("AB", 32), "md5:abc", ""} {
+		_, ok := Path("cache", bad, ".json")
+		assert.False(t, ok, bad)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "ns")
+	name := filepath.Join(dir, "entry.json")
+	assert.NoError(t, WriteFile(name, func(w io.Writer) error {
+		_, err := io.WriteString(w, "{}")
+		return err
+	}))
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err)
+	assert.Equal(t, "{}", string(data))
+	info, err := os.Stat(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	// A failed write leaves the previous entry and no temporary file
+	failed := errors.New("failed")
+	assert.Equal(t, failed, WriteFile(name, func(w io.Writer) error {
+		io.WriteString(w, "{partial")
+		return failed
+	}))
+	data, _ = os.ReadFile(name)
+	assert.Equal(t, "{}", string(data))
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 1)
+}
@@ -0,0 +1,135 @@
+package rpmdb
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Berkeley DB on-disk constants, see db_page.h
+const (
+	bdbHashMagic = 0x061561
+
+	bdbPageHeaderSize = 26
+
+	pageHashUnsorted = 2
+	pageOverflow     = 7
+	pageHash         = 13
+
+	itemKeyData = 1
+	itemOffPage = 3
+)
+
+// isBerkeleyHash reports whether data starts with a Berkeley DB hash
+// metadata page in either byte order.
+func isBerkeleyHash(data []byte) bool {
+	_, ok := berkeleyByteOrder(data)
+	return ok
+}
+
+func berkeleyByteOrder(data []byte) (binary.ByteOrder, bool) {
+	if len(data) < 72 {
+		return nil, false
+	}
+	if binary.LittleEndian.Uint32(data[12:16]) == bdbHashMagic {
+		return binary.LittleEndian, true
+	}
+	if binary.BigEndian.Uint32(data[12:16]) == bdbHashMagic {
+		return binary.BigEndian, true
+	}
+	return nil, false
+}
+
+// berkeleyValues returns every value stored in a Berkeley DB hash file.
+func berkeleyValues(data []byte) ([][]byte, error) {
+	order, ok := berkeleyByteOrder(data)
+	if !ok {
+		return nil, errUnknownFormat
+	}
+	pageSize := int(order.Uint32(data[20:24]))
+	lastPage := int(order.Uint32(data[32:36]))
+	if pageSize < 512 || pageSize > 65536 {
+		return nil, errors.New("rpmdb: invalid Berkeley DB page size")
+	}
+	page := func(n int) []byte {
+		start := n * pageSize
+		if n < 0 || start+pageSize > len(data) {
+			return nil
+		}
+		return data[start : start+pageSize]
+	}
+
+	var values [][]byte
+	for n := 1; n <= lastPage; n++ {
+		p := page(n)
+		if p == nil {
+			break
+		}
+		if p[25] != pageHash && p[25] != pageHashUnsorted {
+			continue
+		}
+		entries := int(order.Uint16(p[20:22]))
+		offsets := make([]int, entries)
+		for i := range offsets {
+			at := bdbPageHeaderSize + i*2
+			if at+2 > len(p) {
+				return nil, errors.New("rpmdb: corrupt hash page")
+			}
+			offsets[i] = int(order.Uint16(p[at : at+2]))
+		}
+		// Items alternate between keys and values
+		for i := 1; i < entries; i += 2 {
+			start := offsets[i]
+			end := pageSize
+			if i > 0 {
+				end = offsets[i-1]
+			}
+			if start >= end || end > len(p) {
+				return nil, errors.New("rpmdb: corrupt hash item")
+			}
+			item := p[start:end]
+			switch item[0] {
+			case itemKeyData:
+				values = append(values, item[1:])
+			case itemOffPage:
+				if len(item) < 12 {
+					return nil, errors.New("rpmdb: corrupt off-page item")
+				}
+				length := int(order.Uint32(item[8:12]))
+				// The value cannot be larger than the file holding it
+				if length > len(data) {
+					return nil, errors.New("rpmdb: corrupt off-page length")
+				}
+				value, err := berkeleyOverflow(page, order, int(order.Uint32(item[4:8])), length)
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, value)
+			}
+		}
+	}
+	return values, nil
+}
+
+// berkeleyOverflow reassembles a value spread over a chain of overflow pages.
+func berkeleyOverflow(page func(int) []byte, order binary.ByteOrder, n, length int) ([]byte, error) {
+	value := make([]byte, 0, length)
+	for len(value) < length {
+		p := page(n)
+		if p == nil || p[25] != pageOverflow {
+			return nil, errors.New("rpmdb: broken overflow chain")
+		}
+		size := int(order.Uint16(p[22:24]))
+		if size == 0 || bdbPageHeaderSize+size > len(p) {
+			return nil, errors.New("rpmdb: corrupt overflow page")
+		}
+		value = append(value, p[bdbPageHeaderSize:bdbPageHeaderSize+size]...)
+		n = int(order.Uint32(p[16:20]))
+		if n == 0 {
+			break
+		}
+	}
+	if len(value) < length {
+		return nil, errors.New("rpmdb: truncated overflow value")
+	}
+	return value[:length], nil
+}
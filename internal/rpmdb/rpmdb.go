@@ -0,0 +1,148 @@
+// Package rpmdb reads the package list out of an rpm database without cgo or
+// a sqlite driver. It understands the Berkeley DB hash format used by
+// /var/lib/rpm/Packages and the sqlite format used by rpmdb.sqlite.
+package rpmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"whaler/internal/sqlite"
+)
+
+// Package is an installed rpm.
+type Package struct {
+	Name      string
+	Epoch     int
+	Version   string
+	Release   string
+	Arch      string
+	SourceRPM string
+}
+
+// EVR returns the [epoch:]version-release string rpm prints.
+func (p Package) EVR() string {
+	evr := p.Version
+	if p.Release != "" {
+		evr += "-" + p.Release
+	}
+	if p.Epoch > 0 {
+		evr = fmt.Sprintf("%d:%s", p.Epoch, evr)
+	}
+	return evr
+}
+
+// SourceName returns the name of the source package, "bash" for
+// "bash-5.1.8-6.el9.src.rpm".
+func (p Package) SourceName() string {
+	s := strings.TrimSuffix(p.SourceRPM, ".src.rpm")
+	for i := 0; i < 2; i++ {
+		if j := strings.LastIndexByte(s, '-'); j > 0 {
+			s = s[:j]
+		}
+	}
+	return s
+}
+
+var errUnknownFormat = errors.New("rpmdb: unknown database format")
+
+// Parse returns the packages of a whole rpm database file.
+func Parse(data []byte) ([]Package, error) {
+	var blobs [][]byte
+	var err error
+	switch {
+	case bytes.HasPrefix(data, []byte(sqlite.Magic)):
+		blobs, err = sqliteBlobs(data, "Packages")
+	case isBerkeleyHash(data):
+		blobs, err = berkeleyValues(data)
+	default:
+		return nil, errUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []Package
+	for _, blob := range blobs {
+		// Record 0 of the Berkeley database only holds a counter
+		if len(blob) < 8 {
+			continue
+		}
+		pkg, err := parseHeader(blob)
+		if err != nil {
+			return nil, err
+		}
+		// The database also stores the gpg-pubkey pseudo packages
+		if pkg.Name == "" || pkg.Name == "gpg-pubkey" {
+			continue
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs, nil
+}
+
+// Header tags and types, see rpmtag.h
+const (
+	tagName      = 1000
+	tagVersion   = 1001
+	tagRelease   = 1002
+	tagEpoch     = 1003
+	tagArch      = 1022
+	tagSourceRPM = 1044
+
+	typeInt32       = 4
+	typeString      = 6
+	typeStringArray = 8
+	typeI18NString  = 9
+)
+
+// parseHeader decodes an rpm header blob as stored in the database, that is
+// without the lead and header magic.
+func parseHeader(blob []byte) (Package, error) {
+	var pkg Package
+	if len(blob) < 8 {
+		return pkg, errors.New("rpmdb: header too short")
+	}
+	il := int(binary.BigEndian.Uint32(blob[0:4]))
+	dl := int(binary.BigEndian.Uint32(blob[4:8]))
+	dataStart := 8 + il*16
+	if il < 0 || dl < 0 || il > 0xffff || dataStart+dl > len(blob) {
+		return pkg, errors.New("rpmdb: corrupt header")
+	}
+	store := blob[dataStart : dataStart+dl]
+	for i := 0; i < il; i++ {
+		entry := blob[8+i*16 : 8+(i+1)*16]
+		tag := binary.BigEndian.Uint32(entry[0:4])
+		typ := binary.BigEndian.Uint32(entry[4:8])
+		offset := int(int32(binary.BigEndian.Uint32(entry[8:12])))
+		if offset < 0 || offset >= len(store) {
+			continue
+		}
+		switch typ {
+		case typeString, typeStringArray, typeI18NString:
+			value := store[offset:]
+			if end := bytes.IndexByte(value, 0); end >= 0 {
+				value = value[:end]
+			}
+			switch tag {
+			case tagName:
+				pkg.Name = string(value)
+			case tagVersion:
+				pkg.Version = string(value)
+			case tagRelease:
+				pkg.Release = string(value)
+			case tagArch:
+				pkg.Arch = string(value)
+			case tagSourceRPM:
+				pkg.SourceRPM = string(value)
+			}
+		case typeInt32:
+			if tag == tagEpoch && offset+4 <= len(store) {
+				pkg.Epoch = int(binary.BigEndian.Uint32(store[offset : offset+4]))
+			}
+		}
+	}
+	return pkg, nil
+}
@@ -0,0 +1,144 @@
+package rpmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// header builds an rpm header blob from string tags
+func header(tags map[uint32]string, epoch uint32) []byte {
+	var index, store bytes.Buffer
+	n := 0
+	for _, tag := range []uint32{tagName, tagVersion, tagRelease, tagArch, tagSourceRPM, 1005} {
+		v, ok := tags[tag]
+		if !ok {
+			continue
+		}
+		binary.Write(&index, binary.BigEndian, []uint32{tag, typeString, uint32(store.Len()), 1})
+		store.WriteString(v + "\x00")
+		n++
+	}
+	if epoch > 0 {
+		for store.Len()%4 != 0 {
+			store.WriteByte(0)
+		}
+		binary.Write(&index, binary.BigEndian, []uint32{tagEpoch, typeInt32, uint32(store.Len()), 1})
+		binary.Write(&store, binary.BigEndian, epoch)
+		n++
+	}
+	var blob bytes.Buffer
+	binary.Write(&blob, binary.BigEndian, []uint32{uint32(n), uint32(store.Len())})
+	blob.Write(index.Bytes())
+	blob.Write(store.Bytes())
+	return blob.Bytes()
+}
+
+func TestParseSqlite(t *testing.T) {
+	data, err := os.ReadFile("testdata/rpmdb.sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkgs, err := Parse(data)
+	assert.NoError(t, err)
+	assert.Equal(t, []Package{
+		{Name: "bash", Version: "5.1.8", Release: "6.el9", Arch: "x86_64", SourceRPM: "bash-5.1.8-6.el9.src.rpm"},
+		{Name: "openssl-libs", Epoch: 1, Version: "3.0.7", Release: "27.el9", Arch: "x86_64", SourceRPM: "openssl-3.0.7-27.el9.src.rpm"},
+		{Name: "tzdata", Version: "2024a", Release: "1.el9", Arch: "noarch", SourceRPM: "tzdata-2024a-1.el9.src.rpm"},
+	}, pkgs)
+	assert.Equal(t, "1:3.0.7-27.el9", pkgs[1].EVR())
+	assert.Equal(t, "openssl", pkgs[1].SourceName())
+}
+
+func TestParseBerkeley(t *testing.T) {
+	const pageSize = 4096
+	small := header(map[uint32]string{tagName: "zlib", tagVersion: "1.2.11", tagRelease: "40.el9", tagArch: "x86_64"}, 0)
+	large := header(map[uint32]string{tagName: "glibc", tagVersion: "2.34", tagRelease: "60.el9", tagArch: "x86_64", 1005: strings.Repeat("x", 6000)}, 0)
+
+	db := make([]byte, 4*pageSize)
+	le := binary.LittleEndian
+	// Metadata page
+	le.PutUint32(db[12:], bdbHashMagic)
+	le.PutUint32(db[20:], pageSize)
+	le.PutUint32(db[32:], 3)
+
+	// Hash page with the counter record, an inline and an off-page value
+	p := db[pageSize : 2*pageSize]
+	p[25] = pageHash
+	var items [][]byte
+	key := func(n uint32) []byte { return append([]byte{itemKeyData}, le.AppendUint32(nil, n)...) }
+	offPage := make([]byte, 12)
+	offPage[0] = itemOffPage
+	le.PutUint32(offPage[4:], 2)
+	le.PutUint32(offPage[8:], uint32(len(large)))
+	items = append(items, key(0), key(3), key(1), append([]byte{itemKeyData}, small...), key(2), offPage)
+	end := pageSize
+	for i, item := range items {
+		end -= len(item)
+		copy(p[end:], item)
+		le.PutUint16(p[bdbPageHeaderSize+i*2:], uint16(end))
+	}
+	le.PutUint16(p[20:], uint16(len(items)))
+
+	// Overflow chain over pages 2 and 3
+	chunk := pageSize - bdbPageHeaderSize
+	for i, n := range []int{2, 3} {
+		p := db[n*pageSize : (n+1)*pageSize]
+		p[25] = pageOverflow
+		part := large[i*chunk : min(len(large), (i+1)*chunk)]
+		copy(p[bdbPageHeaderSize:], part)
+		le.PutUint16(p[22:], uint16(len(part)))
+		if i == 0 {
+			le.PutUint32(p[16:], 3)
+		}
+	}
+
+	pkgs, err := Parse(db)
+	assert.NoError(t, err)
+	assert.Equal(t, []Package{
+		{Name: "zlib", Version: "1.2.11", Release: "40.el9", Arch: "x86_64"},
+		{Name: "glibc", Version: "2.34", Release: "60.el9", Arch: "x86_64"},
+	}, pkgs)
+}
+
+func TestParseBerkeleyCorrupt(t *testing.T) {
+	const pageSize = 512
+	db := make([]byte, 2*pageSize)
+	le := binary.LittleEndian
+	le.PutUint32(db[12:], bdbHashMagic)
+	le.PutUint32(db[20:], pageSize)
+	le.PutUint32(db[32:], 1)
+	// An off-page value claiming 4 GB
+	p := db[pageSize:]
+	p[25] = pageHash
+	offPage := make([]byte, 12)
+	offPage[0] = itemOffPage
+	le.PutUint32(offPage[4:], 1)
+	le.PutUint32(offPage[8:], 0xffffffff)
+	p[pageSize-1] = itemKeyData
+	copy(p[pageSize-13:], offPage)
+	le.PutUint16(p[bdbPageHeaderSize:], pageSize-1)
+	le.PutUint16(p[bdbPageHeaderSize+2:], pageSize-13)
+	le.PutUint16(p[20:], 2)
+	_, err := Parse(db)
+	assert.EqualError(t, err, "rpmdb: corrupt off-page length")
+}
+
+func FuzzParse(f *testing.F) {
+	if data, err := os.ReadFile("testdata/rpmdb.sqlite"); err == nil {
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Corrupt databases must fail, not panic
+		Parse(data)
+	})
+}
+
+func TestParseUnknown(t *testing.T) {
+	_, err := Parse([]byte("not a database"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,17 @@
+package rpmdb
+
+import "whaler/internal/sqlite"
+
+// sqliteBlobs returns the first blob column of every row of table.
+func sqliteBlobs(data []byte, table string) ([][]byte, error) {
+	var blobs [][]byte
+	err := sqlite.Rows(data, table, func(record []interface{}) {
+		for _, v := range record {
+			if b, ok := v.([]byte); ok {
+				blobs = append(blobs, b)
+				return
+			}
+		}
+	})
+	return blobs, err
+}
@@ -0,0 +1,269 @@
+// Package sqlite reads the rows of a table out of a sqlite database file held
+// in memory, without cgo or a database driver. Only what read-only table scans
+// need is implemented; indexes, WAL files and free pages are ignored.
+package sqlite
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// The sqlite file format is documented at https://www.sqlite.org/fileformat.html
+const Magic = "SQLite format 3\x00"
+
+// Btree page types
+const (
+	interiorTable = 0x05
+	leafTable     = 0x0d
+)
+
+type file struct {
+	data       []byte
+	pageSize   int
+	usableSize int
+	// visited holds the pages of the btree being walked, so that a corrupt
+	// file whose pages point back at each other is rejected
+	visited map[int]bool
+}
+
+// Rows calls fn with every row of table, decoded into nil, int64, string or
+// []byte values. Floats are returned as their raw bits in an int64, and an
+// INTEGER PRIMARY KEY column reads as nil since sqlite stores it as the rowid.
+func Rows(data []byte, table string, fn func(record []interface{})) error {
+	if len(data) < 100 {
+		return errors.New("sqlite: file too short")
+	}
+	f := &file{data: data}
+	f.pageSize = int(binary.BigEndian.Uint16(data[16:18]))
+	if f.pageSize == 1 {
+		f.pageSize = 65536
+	}
+	f.usableSize = f.pageSize - int(data[20])
+	if f.pageSize < 512 {
+		return errors.New("sqlite: invalid page size")
+	}
+
+	// Find the root page of the table in the schema table on page 1
+	root := 0
+	f.visited = make(map[int]bool)
+	err := f.walkTable(1, 0, func(record []interface{}) {
+		if len(record) >= 4 && record[0] == "table" && record[1] == table {
+			if n, ok := record[3].(int64); ok {
+				root = int(n)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if root == 0 {
+		return fmt.Errorf("sqlite: no %s table", table)
+	}
+	f.visited = make(map[int]bool)
+	return f.walkTable(root, 0, fn)
+}
+
+func (f *file) page(n int) ([]byte, error) {
+	start := (n - 1) * f.pageSize
+	if n < 1 || start+f.pageSize > len(f.data) {
+		return nil, fmt.Errorf("sqlite: page %d out of range", n)
+	}
+	return f.data[start : start+f.pageSize], nil
+}
+
+// walkTable calls fn with the decoded record of every row of the table btree
+// rooted at page n.
+func (f *file) walkTable(n, depth int, fn func([]interface{})) error {
+	if depth > 32 {
+		return errors.New("sqlite: btree too deep")
+	}
+	if f.visited[n] {
+		return fmt.Errorf("sqlite: page %d is linked twice", n)
+	}
+	f.visited[n] = true
+	p, err := f.page(n)
+	if err != nil {
+		return err
+	}
+	// Page 1 starts with the database header
+	hdr := 0
+	if n == 1 {
+		hdr = 100
+	}
+	if hdr+8 > len(p) {
+		return errors.New("sqlite: corrupt page")
+	}
+	kind := p[hdr]
+	cells := int(binary.BigEndian.Uint16(p[hdr+3 : hdr+5]))
+	pointers := hdr + 8
+	if kind == interiorTable {
+		pointers = hdr + 12
+	}
+	if pointers+cells*2 > len(p) {
+		return errors.New("sqlite: corrupt page")
+	}
+
+	for i := 0; i < cells; i++ {
+		at := int(binary.BigEndian.Uint16(p[pointers+i*2:]))
+		if at >= len(p) {
+			return errors.New("sqlite: corrupt cell")
+		}
+		switch kind {
+		case interiorTable:
+			if at+4 > len(p) {
+				return errors.New("sqlite: corrupt cell")
+			}
+			if err := f.walkTable(int(binary.BigEndian.Uint32(p[at:])), depth+1, fn); err != nil {
+				return err
+			}
+		case leafTable:
+			payload, err := f.leafPayload(p, at)
+			if err != nil {
+				return err
+			}
+			record, err := decodeRecord(payload)
+			if err != nil {
+				return err
+			}
+			fn(record)
+		default:
+			return fmt.Errorf("sqlite: unexpected page type %#x", kind)
+		}
+	}
+	if kind == interiorTable {
+		return f.walkTable(int(binary.BigEndian.Uint32(p[hdr+8:])), depth+1, fn)
+	}
+	return nil
+}
+
+// leafPayload reads the payload of a table leaf cell, following overflow
+// pages when it does not fit on the page.
+func (f *file) leafPayload(p []byte, at int) ([]byte, error) {
+	size, n := varint(p[at:])
+	at += n
+	_, n = varint(p[at:]) // rowid
+	at += n
+	// The payload cannot be larger than the file holding it
+	if size < 0 || size > int64(len(f.data)) {
+		return nil, errors.New("sqlite: corrupt payload size")
+	}
+
+	total := int(size)
+	u := f.usableSize
+	x := u - 35
+	local := total
+	if total > x {
+		m := ((u-12)*32)/255 - 23
+		local = m + (total-m)%(u-4)
+		if local > x {
+			local = m
+		}
+	}
+	if at+local > len(p) {
+		return nil, errors.New("sqlite: corrupt payload")
+	}
+	payload := make([]byte, 0, total)
+	payload = append(payload, p[at:at+local]...)
+	if local == total {
+		return payload, nil
+	}
+	if at+local+4 > len(p) {
+		return nil, errors.New("sqlite: corrupt payload")
+	}
+	next := int(binary.BigEndian.Uint32(p[at+local:]))
+	for len(payload) < total {
+		op, err := f.page(next)
+		if err != nil {
+			return nil, err
+		}
+		chunk := min(total-len(payload), u-4)
+		payload = append(payload, op[4:4+chunk]...)
+		next = int(binary.BigEndian.Uint32(op[0:4]))
+		if next == 0 && len(payload) < total {
+			return nil, errors.New("sqlite: truncated overflow chain")
+		}
+	}
+	return payload, nil
+}
+
+// decodeRecord decodes a record into nil, int64, string or []byte values.
+// Floats are returned as their raw bits in an int64.
+func decodeRecord(payload []byte) ([]interface{}, error) {
+	headerSize, n := varint(payload)
+	if n == 0 || headerSize < int64(n) || headerSize > int64(len(payload)) {
+		return nil, errors.New("sqlite: corrupt record")
+	}
+	var types []int64
+	for at := n; at < int(headerSize); {
+		t, n := varint(payload[at:])
+		if n == 0 {
+			return nil, errors.New("sqlite: corrupt record")
+		}
+		types = append(types, t)
+		at += n
+	}
+
+	body := payload[headerSize:]
+	var values []interface{}
+	for _, t := range types {
+		var size int64
+		switch {
+		case t == 0 || t == 8 || t == 9:
+			size = 0
+		case t >= 1 && t <= 4:
+			size = t
+		case t == 5:
+			size = 6
+		case t == 6 || t == 7:
+			size = 8
+		case t >= 12:
+			size = (t - 12) / 2
+		default:
+			return nil, errors.New("sqlite: unsupported serial type")
+		}
+		if size > int64(len(body)) {
+			return nil, errors.New("sqlite: corrupt record")
+		}
+		v := body[:size]
+		body = body[size:]
+		switch {
+		case t == 0:
+			values = append(values, nil)
+		case t == 8:
+			values = append(values, int64(0))
+		case t == 9:
+			values = append(values, int64(1))
+		case t <= 7:
+			var i int64
+			for _, b := range v {
+				i = i<<8 | int64(b)
+			}
+			// Sign extend
+			if size > 0 && size < 8 && v[0]&0x80 != 0 {
+				i -= 1 << (8 * uint(size))
+			}
+			values = append(values, i)
+		case t%2 == 0:
+			values = append(values, v)
+		default:
+			values = append(values, string(v))
+		}
+	}
+	return values, nil
+}
+
+// varint decodes a sqlite big-endian variable length integer.
+func varint(b []byte) (int64, int) {
+	var v int64
+	for i := 0; i < 9 && i < len(b); i++ {
+		if i == 8 {
+			return v<<8 | int64(b[i]), 9
+		}
+		v = v<<7 | int64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return v, 0
+}
@@ -0,0 +1,67 @@
+package sqlite
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// emptyFile returns a database of pages of 512 bytes whose first page is
+// an empty table leaf.
+func emptyFile(pages int) []byte {
+	data := make([]byte, 512*pages)
+	copy(data, Magic)
+	binary.BigEndian.PutUint16(data[16:], 512)
+	data[100] = leafTable
+	return data
+}
+
+func TestRowsCycle(t *testing.T) {
+	// The schema page is an interior page whose cell and right-most
+	// pointer both point back at itself
+	data := emptyFile(1)
+	data[100] = interiorTable
+	binary.BigEndian.PutUint16(data[103:], 1)
+	binary.BigEndian.PutUint32(data[108:], 1)
+	binary.BigEndian.PutUint16(data[112:], 200)
+	binary.BigEndian.PutUint32(data[200:], 1)
+	data[204] = 1
+	assert.EqualError(t, Rows(data, "Packages", func([]interface{}) {}), "sqlite: page 1 is linked twice")
+}
+
+func TestRowsPayloadSize(t *testing.T) {
+	// A leaf cell claiming a payload of 2^63-1 bytes
+	data := emptyFile(1)
+	binary.BigEndian.PutUint16(data[103:], 1)
+	binary.BigEndian.PutUint16(data[108:], 200)
+	copy(data[200:], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f, 1})
+	assert.EqualError(t, Rows(data, "Packages", func([]interface{}) {}), "sqlite: corrupt payload size")
+}
+
+func TestDecodeRecordCorrupt(t *testing.T) {
+	for name, payload := range map[string][]byte{
+		"negative header size":   {0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"header inside its size": {0},
+		"header past the end":    {5, 1},
+		"huge text":              {10, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	} {
+		_, err := decodeRecord(payload)
+		assert.Error(t, err, name)
+	}
+	record, err := decodeRecord([]byte{3, 1, 0x13, 0xff, 'a', 'b', 'c'})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(-1), "abc"}, record)
+}
+
+func FuzzRows(f *testing.F) {
+	if data, err := os.ReadFile("../rpmdb/testdata/rpmdb.sqlite"); err == nil {
+		f.Add(data)
+	}
+	f.Add(emptyFile(2))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Corrupt files must fail, not panic or hang
+		Rows(data, "Packages", func([]interface{}) {})
+	})
+}
@@ -0,0 +1,172 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"whaler/analyzer"
+)
+
+// CycloneDX writes a CycloneDX 1.5 JSON SBOM. The image is the metadata
+// component, every package is a component tagged with the layer that
+// installed it, and the reconstructed Dockerfile is recorded as the
+// formulation of the image.
+type CycloneDX struct {
+	opts Options
+	now  func() time.Time
+}
+
+type cdxBOM struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	SerialNumber string          `json:"serialNumber"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies"`
+	Formulation  []cdxFormula    `json:"formulation,omitempty"`
+}
+
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp"`
+	Tools     cdxTools     `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	BOMRef      string        `json:"bom-ref,omitempty"`
+	Type        string        `json:"type"`
+	Name        string        `json:"name"`
+	Version     string        `json:"version,omitempty"`
+	Description string        `json:"description,omitempty"`
+	PURL        string        `json:"purl,omitempty"`
+	Hashes      []cdxHash     `json:"hashes,omitempty"`
+	Properties  []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+type cdxFormula struct {
+	BOMRef    string        `json:"bom-ref"`
+	Workflows []cdxWorkflow `json:"workflows"`
+}
+
+type cdxWorkflow struct {
+	BOMRef    string    `json:"bom-ref"`
+	UID       string    `json:"uid"`
+	Name      string    `json:"name"`
+	TaskTypes []string  `json:"taskTypes"`
+	Steps     []cdxStep `json:"steps"`
+}
+
+type cdxStep struct {
+	Name       string        `json:"name"`
+	Commands   []cdxCommand  `json:"commands"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxCommand struct {
+	Executed string `json:"executed"`
+}
+
+func (c *CycloneDX) Render(w io.Writer, report *analyzer.Report) error {
+	report = redactReport(report, c.opts)
+	image := cdxComponent{
+		BOMRef:      "image",
+		Type:        "container",
+		Name:        report.Image,
+		Version:     report.Metadata.ID,
+		Description: "Dockerfile:\n" + dockerfile(report.History),
+		Hashes:      cdxHashes(report.Metadata.ID),
+	}
+	bom := cdxBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + newUUID(),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: c.now().UTC().Format(time.RFC3339),
+			Tools:     cdxTools{Components: []cdxComponent{{Type: "application", Name: "whaler"}}},
+			Component: image,
+		},
+		Components: []cdxComponent{},
+	}
+
+	digests := layerDigests(report.History)
+	imageDeps := cdxDependency{Ref: image.BOMRef, DependsOn: []string{}}
+	for i, pkg := range report.Packages {
+		ref := fmt.Sprintf("pkg-%d", i)
+		comp := cdxComponent{
+			BOMRef:  ref,
+			Type:    "library",
+			Name:    pkg.Name,
+			Version: pkg.Version,
+			PURL:    purl(report, pkg),
+			Properties: []cdxProperty{
+				{Name: "whaler:package:type", Value: pkg.Type},
+				{Name: "whaler:package:location", Value: pkg.Location},
+				{Name: "whaler:layer:digest", Value: digests[pkg.Layer]},
+				{Name: "whaler:layer:instruction", Value: pkg.Instruction},
+			},
+		}
+		if pkg.Source != "" && pkg.Source != pkg.Name {
+			comp.Properties = append(comp.Properties, cdxProperty{Name: "whaler:package:source", Value: pkg.Source})
+		}
+		bom.Components = append(bom.Components, comp)
+		imageDeps.DependsOn = append(imageDeps.DependsOn, ref)
+	}
+	bom.Dependencies = []cdxDependency{imageDeps}
+
+	if len(report.History) > 0 {
+		workflow := cdxWorkflow{
+			BOMRef:    "dockerfile",
+			UID:       "dockerfile",
+			Name:      "Dockerfile",
+			TaskTypes: []string{"build"},
+		}
+		for _, h := range report.History {
+			step := cdxStep{
+				Name:     strings.SplitN(h.Instruction(), " ", 2)[0],
+				Commands: []cdxCommand{{Executed: h.Instruction()}},
+			}
+			if h.Digest != "" {
+				step.Properties = []cdxProperty{{Name: "whaler:layer:digest", Value: h.Digest}}
+			}
+			workflow.Steps = append(workflow.Steps, step)
+		}
+		bom.Formulation = []cdxFormula{{BOMRef: "formulation", Workflows: []cdxWorkflow{workflow}}}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(bom)
+}
+
+// cdxHashes turns a "sha256:..." digest into a CycloneDX hash list.
+func cdxHashes(digest string) []cdxHash {
+	alg, hex, ok := strings.Cut(digest, ":")
+	if !ok || alg != "sha256" {
+		return nil
+	}
+	return []cdxHash{{Alg: "SHA-256", Content: hex}}
+}
@@ -0,0 +1,106 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"whaler/analyzer"
+
+	"github.com/fatih/color"
+)
+
+// RenderDiff writes an image comparison as text or json.
+func RenderDiff(w io.Writer, format string, d *analyzer.Diff) error {
+	switch format {
+	case "text":
+		textDiff(printer{w}, d)
+		return nil
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	}
+	return fmt.Errorf("output format %q does not support diffs, use text or json", format)
+}
+
+func textDiff(p printer, d *analyzer.Diff) {
+	p.println(color.FgWhite, "Comparing %s to %s", d.From, d.To)
+
+	p.println(color.FgWhite, "Dockerfile:")
+	for _, c := range d.Instructions {
+		switch c.Kind {
+		case analyzer.Added:
+			p.println(color.FgGreen, "+ %s", c.To)
+		case analyzer.Removed:
+			p.println(color.FgRed, "- %s", c.From)
+		case analyzer.Changed:
+			p.println(color.FgRed, "- %s", c.From)
+			p.println(color.FgGreen, "+ %s", c.To)
+		default:
+			p.println(color.FgWhite, "  %s", c.To)
+		}
+	}
+	p.println(color.FgWhite, "")
+
+	p.println(color.FgWhite, "Layers: %d shared, %d new, %d removed", len(d.SharedLayers), len(d.AddedLayers), len(d.RemovedLayers))
+	for _, l := range d.AddedLayers {
+		p.println(color.FgGreen, "+ %s", l)
+	}
+	for _, l := range d.RemovedLayers {
+		p.println(color.FgRed, "- %s", l)
+	}
+	p.println(color.FgWhite, "")
+
+	p.println(color.FgWhite, "Files: %d added, %d removed, %d modified", len(d.Files.Added), len(d.Files.Removed), len(d.Files.Modified))
+	for _, f := range d.Files.Added {
+		p.println(color.FgGreen, "+ %s", f)
+	}
+	for _, f := range d.Files.Removed {
+		p.println(color.FgRed, "- %s", f)
+	}
+	for _, f := range d.Files.Modified {
+		p.println(color.FgYellow, "~ %s", f)
+	}
+	p.println(color.FgWhite, "")
+
+	if len(d.Env) > 0 || len(d.AddedPorts) > 0 || len(d.RemovedPorts) > 0 || d.User != nil {
+		p.println(color.FgWhite, "Configuration:")
+		for _, e := range d.Env {
+			switch e.Kind {
+			case analyzer.Added:
+				p.println(color.FgGreen, "+ ENV %s=%s", e.Name, e.To)
+			case analyzer.Removed:
+				p.println(color.FgRed, "- ENV %s=%s", e.Name, e.From)
+			default:
+				p.println(color.FgYellow, "~ ENV %s=%s -> %s", e.Name, e.From, e.To)
+			}
+		}
+		for _, port := range d.AddedPorts {
+			p.println(color.FgGreen, "+ EXPOSE %s", port)
+		}
+		for _, port := range d.RemovedPorts {
+			p.println(color.FgRed, "- EXPOSE %s", port)
+		}
+		if d.User != nil {
+			p.println(color.FgYellow, "~ USER %s -> %s", userName(d.User.From), userName(d.User.To))
+		}
+		p.println(color.FgWhite, "")
+	}
+
+	p.println(color.FgWhite, "Potential secrets: %d new, %d resolved", len(d.NewFindings), len(d.ResolvedFindings))
+	for _, f := range d.NewFindings {
+		p.println(color.FgRed, "+ %s %s %s", f.Path, f.Description, f.Layer)
+	}
+	for _, f := range d.ResolvedFindings {
+		p.println(color.FgGreen, "- %s %s %s", f.Path, f.Description, f.Layer)
+	}
+	p.println(color.FgWhite, "")
+}
+
+func userName(user string) string {
+	if user == "" {
+		return "root"
+	}
+	return user
+}
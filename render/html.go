@@ -0,0 +1,89 @@
+package render
+
+import (
+	_ "embed"
+	"html/template"
+	"io"
+
+	"whaler/analyzer"
+)
+
+//go:embed templates/report.html.tmpl
+var htmlTemplate string
+
+// HTML writes a self-contained page that loads no external assets, so it can
+// be opened on machines without network access.
+type HTML struct {
+	opts Options
+	tmpl *template.Template
+}
+
+func newHTML(opts Options) *HTML {
+	return &HTML{opts: opts, tmpl: template.Must(template.New("report").Parse(htmlTemplate))}
+}
+
+type htmlInstruction struct {
+	Instruction string
+	LayerID     string
+	Size        string
+	Files       []string
+	Hidden      int
+}
+
+type htmlWasted struct {
+	Path   string
+	Size   string
+	Copies int
+}
+
+type htmlKey struct {
+	Path        string
+	Layer       string
+	Description string
+}
+
+type htmlReport struct {
+	*analyzer.Report
+	Instructions []htmlInstruction
+	KeyLines     []htmlKey
+	// EfficiencyLine and Wasted describe report.Efficiency
+	EfficiencyLine string
+	Wasted         []htmlWasted
+	// UserLine describes the account the image runs as
+	UserLine string
+}
+
+func (h *HTML) Render(w io.Writer, report *analyzer.Report) error {
+	report = redactReport(report, h.opts)
+	data := htmlReport{Report: report, UserLine: describeUser(report.Accounts)}
+	for _, layer := range visibleHistory(report.History, h.opts.Verbose) {
+		inst := htmlInstruction{Instruction: layer.Instruction(), LayerID: layer.LayerID, Size: layerSummary(layer)}
+		for _, f := range layer.Files {
+			if h.opts.Filter && f.Noise {
+				inst.Hidden++
+				continue
+			}
+			inst.Files = append(inst.Files, f.Path)
+		}
+		data.Instructions = append(data.Instructions, inst)
+	}
+	if e := report.Efficiency; e != nil {
+		data.EfficiencyLine = efficiencySummary(e)
+		for _, w := range e.Wasted {
+			data.Wasted = append(data.Wasted, htmlWasted{Path: w.Path, Size: FormatBytes(w.Bytes), Copies: w.Copies})
+		}
+	}
+	for _, k := range report.Keys {
+		data.KeyLines = append(data.KeyLines, htmlKey{Path: k.Path, Layer: k.Layer, Description: describeKey(k)})
+	}
+	return h.tmpl.Execute(w, data)
+}
+
+// visibleHistory drops the base image layer unless verbose is set, the same
+// way the text output does.
+func visibleHistory(history []analyzer.History, verbose bool) []analyzer.History {
+	if verbose || len(history) == 0 {
+		return history
+	}
+	return history[1:]
+}
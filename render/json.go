@@ -0,0 +1,20 @@
+package render
+
+import (
+	"encoding/json"
+	"io"
+
+	"whaler/analyzer"
+)
+
+// JSON writes the report as indented JSON.
+type JSON struct {
+	opts Options
+}
+
+func (j *JSON) Render(w io.Writer, report *analyzer.Report) error {
+	report = redactReport(report, j.opts)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
@@ -0,0 +1,227 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"whaler/analyzer"
+)
+
+// DefaultMarkdownLimit keeps markdown output under GitHub's 65536 character
+// limit for pull request comments.
+const DefaultMarkdownLimit = 65000
+
+// Markdown writes a compact summary suitable for merge request comments.
+type Markdown struct {
+	opts Options
+}
+
+func (m *Markdown) Render(w io.Writer, report *analyzer.Report) error {
+	report = redactReport(report, m.opts)
+	limit := m.opts.MaxBytes
+	if limit <= 0 {
+		limit = int(^uint(0) >> 1)
+	}
+
+	header := m.header(report)
+	if len(header) > limit-dockerfileReserve {
+		// Long policy or repository lists are cut like the other sections
+		lines := strings.Split(strings.TrimSuffix(header, "\n"), "\n")
+		header = truncateLines(lines, limit-dockerfileReserve-1, "\n_... %d more lines truncated to fit the size limit_") + "\n"
+	}
+	// Findings matter more than the Dockerfile, so they get the budget first
+	// and the Dockerfile is cut down to whatever is left.
+	findings := m.findings(report, limit-len(header)-dockerfileReserve)
+	dockerfile := m.dockerfile(report, limit-len(header)-len(findings))
+	_, err := io.WriteString(w, header+dockerfile+findings)
+	return err
+}
+
+// dockerfileReserve is the room kept for a truncated Dockerfile block when
+// findings alone would fill the limit.
+const dockerfileReserve = 256
+
+func (m *Markdown) header(report *analyzer.Report) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### Whaler report for %s\n\n", mdCode(report.Image))
+	b.WriteString("| | |\n|---|---|\n")
+	if report.Metadata.ID != "" {
+		fmt.Fprintf(&b, "| Image ID | %s |\n", mdCode(report.Metadata.ID))
+	}
+	if c := report.Container; c != nil {
+		fmt.Fprintf(&b, "| Container | %s %s, %s, %d files changed |\n", mdCode(c.Name), mdCode(shortID(c.ID)), c.State, len(c.Changes))
+	}
+	if report.Metadata.User == "" {
+		b.WriteString("| User | **root** |\n")
+	} else {
+		user := mdCode(report.Metadata.User)
+		if d := describeUser(report.Accounts); d != "" {
+			user += " (" + d + ")"
+		}
+		fmt.Fprintf(&b, "| User | %s |\n", user)
+	}
+	var ports []string
+	for _, port := range report.Metadata.ExposedPorts {
+		ports = append(ports, mdCode(port))
+	}
+	if len(ports) == 0 {
+		ports = append(ports, "none")
+	}
+	fmt.Fprintf(&b, "| Ports | %s |\n", strings.Join(ports, " "))
+	if len(report.Packages) > 0 {
+		fmt.Fprintf(&b, "| Packages | %s |\n", countByType(report.Packages))
+	}
+	if len(report.Vulnerabilities) > 0 {
+		fmt.Fprintf(&b, "| Vulnerabilities | %s |\n", countBySeverity(report.Vulnerabilities))
+	}
+	if report.Efficiency != nil {
+		fmt.Fprintf(&b, "| Efficiency | %s |\n", efficiencySummary(report.Efficiency))
+	}
+	fmt.Fprintf(&b, "| Potential secrets | %d |\n", len(report.Findings))
+	if len(report.Suppressed) > 0 {
+		fmt.Fprintf(&b, "| Suppressed by baseline | %d |\n", len(report.Suppressed))
+	}
+	if len(report.Hardening) > 0 {
+		fmt.Fprintf(&b, "| Hardening | %s |\n", countByKind(report.Hardening))
+	}
+	if report.Accounts != nil && len(report.Accounts.Issues) > 0 {
+		fmt.Fprintf(&b, "| Accounts | %s |\n", countAccountIssues(report.Accounts.Issues))
+	}
+	if len(report.GitRepos) > 0 {
+		var repos []string
+		for _, r := range report.GitRepos {
+			repos = append(repos, fmt.Sprintf("%s (%d commits)", mdCode(r.Path), len(r.Commits)))
+		}
+		fmt.Fprintf(&b, "| Git repositories | %s |\n", strings.Join(repos, ", "))
+	}
+	if len(report.Keys) > 0 {
+		fmt.Fprintf(&b, "| Keys and certificates | %d |\n", len(report.Keys))
+	}
+	if len(report.Policy) > 0 {
+		failed := 0
+		for _, r := range report.Policy {
+			if !r.Passed {
+				failed++
+			}
+		}
+		fmt.Fprintf(&b, "| Policy | %d failed, %d passed |\n", failed, len(report.Policy)-failed)
+		b.WriteString("\n")
+		for _, r := range report.Policy {
+			if !r.Passed {
+				fmt.Fprintf(&b, "- :x: %s %s: %s\n", mdCode(r.RuleID), r.Description, r.Message)
+			}
+		}
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+func (m *Markdown) dockerfile(report *analyzer.Report, limit int) string {
+	history := visibleHistory(report.History, m.opts.Verbose)
+	var lines []string
+	for _, h := range history {
+		if summary := layerSummary(h); summary != "" {
+			lines = append(lines, "# "+summary)
+		}
+		lines = append(lines, h.Instruction())
+	}
+	fence := codeFence(lines)
+	head := fmt.Sprintf("<details><summary>Dockerfile (%d instructions)</summary>\n\n%sdockerfile\n", len(history), fence)
+	tail := fence + "\n\n</details>\n\n"
+	body := truncateLines(lines, limit-len(head)-len(tail), "# ... %d more instructions truncated to fit the size limit")
+	return head + body + tail
+}
+
+func (m *Markdown) findings(report *analyzer.Report, limit int) string {
+	if len(report.Findings) == 0 {
+		return ""
+	}
+	instructions := make(map[string]string)
+	for _, h := range report.History {
+		if h.LayerID != "" {
+			instructions[h.LayerID] = h.Instruction()
+		}
+	}
+
+	// Group by layer in the order layers were first seen
+	var order []string
+	byLayer := make(map[string][]analyzer.Finding)
+	for _, f := range report.Findings {
+		if _, ok := byLayer[f.Layer]; !ok {
+			order = append(order, f.Layer)
+		}
+		byLayer[f.Layer] = append(byLayer[f.Layer], f)
+	}
+
+	var lines []string
+	for _, layer := range order {
+		line := fmt.Sprintf("\n**Layer %s**", mdCode(layer))
+		if inst, ok := instructions[layer]; ok {
+			line += " " + mdCode(firstLine(inst))
+		}
+		lines = append(lines, line)
+		for _, f := range byLayer[layer] {
+			line := fmt.Sprintf("- %s: %s", mdCode(f.Path), f.Description)
+			if f.Entropy != 0 {
+				line += fmt.Sprintf(" (entropy %.2f)", f.Entropy)
+			}
+			if validated(f) {
+				line += " _" + f.Validation + "_"
+			}
+			lines = append(lines, line)
+		}
+	}
+	head := "#### Potential secrets\n"
+	return head + truncateLines(lines, limit-len(head), "\n_... %d more lines truncated to fit the size limit_") + "\n"
+}
+
+// truncateLines joins lines with newlines, dropping trailing lines that do not
+// fit in limit bytes and replacing them with a note.
+func truncateLines(lines []string, limit int, note string) string {
+	var b strings.Builder
+	for i, line := range lines {
+		noteLen := 0
+		if i < len(lines)-1 {
+			noteLen = len(fmt.Sprintf(note, len(lines))) + 1
+		}
+		if b.Len()+len(line)+1+noteLen > limit {
+			fmt.Fprintf(&b, note+"\n", len(lines)-i)
+			return b.String()
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+// codeFence returns a fence of backticks longer than any run of backticks in
+// lines, so that none of them closes the code block early.
+func codeFence(lines []string) string {
+	longest := 0
+	for _, line := range lines {
+		run := 0
+		for _, c := range line {
+			if c != '`' {
+				run = 0
+				continue
+			}
+			run++
+			longest = max(longest, run)
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return strings.TrimSpace(s[:i]) + " ..."
+	}
+	return s
+}
+
+// mdCode formats s as inline code that is safe inside a table cell.
+func mdCode(s string) string {
+	s = strings.ReplaceAll(s, "`", "'")
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return "`" + s + "`"
+}
@@ -0,0 +1,278 @@
+// Package render presents analyzer reports in various output formats.
+package render
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"whaler/analyzer"
+	"whaler/vulndb"
+)
+
+// Renderer writes a report in a single output format.
+type Renderer interface {
+	Render(w io.Writer, report *analyzer.Report) error
+}
+
+// Options tunes how much of a report is shown.
+type Options struct {
+	// Verbose shows the base image layer and every file of every layer.
+	Verbose bool
+	// Filter hides files marked as noise.
+	Filter bool
+	// MaxBytes caps the size of markdown output. Zero means no limit.
+	MaxBytes int
+	// Reveal shows secret values in the clear. By default every renderer
+	// masks them, see redactReport.
+	Reveal bool
+}
+
+// New returns the renderer for format.
+func New(format string, opts Options) (Renderer, error) {
+	switch format {
+	case "text":
+		return &Text{opts: opts}, nil
+	case "json":
+		return &JSON{opts: opts}, nil
+	case "html":
+		return newHTML(opts), nil
+	case "markdown":
+		return &Markdown{opts: opts}, nil
+	case "cyclonedx":
+		return &CycloneDX{opts: opts, now: time.Now}, nil
+	case "spdx":
+		return &SPDX{opts: opts, now: time.Now}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q, expected one of %s", format, strings.Join(Formats(), ", "))
+}
+
+// Formats lists the names accepted by New.
+func Formats() []string {
+	return []string{"text", "json", "html", "markdown", "cyclonedx", "spdx"}
+}
+
+// redactReport returns report with its secrets and the values of
+// secret-like variables masked, unless opts reveals them.
+func redactReport(report *analyzer.Report, opts Options) *analyzer.Report {
+	if opts.Reveal {
+		return report
+	}
+	return analyzer.Redact(report)
+}
+
+// groupByInstruction splits packages by the instruction that installed them,
+// in history order.
+func groupByInstruction(pkgs []analyzer.Package, history []analyzer.History) [][]analyzer.Package {
+	index := make(map[string]int)
+	var groups [][]analyzer.Package
+	for _, pkg := range pkgs {
+		i, ok := index[pkg.Layer]
+		if !ok {
+			i = len(groups)
+			index[pkg.Layer] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], pkg)
+	}
+	order := make(map[string]int)
+	for i, h := range history {
+		order[h.LayerID] = i
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return order[groups[i][0].Layer] < order[groups[j][0].Layer]
+	})
+	return groups
+}
+
+// describeKey summarizes a key or certificate on one line: "ECDSA 256
+// private key (PEM), encrypted" or "certificate CN=example.com issued by
+// CN=Example CA, expires 2030-01-01, RSA 2048".
+func describeKey(k analyzer.KeyMaterial) string {
+	algorithm := k.Algorithm
+	if k.Bits > 0 {
+		algorithm += fmt.Sprintf(" %d", k.Bits)
+	}
+	var parts []string
+	switch k.Kind {
+	case analyzer.KeyCertificate:
+		parts = append(parts, fmt.Sprintf("certificate %s issued by %s", k.Subject, k.Issuer))
+		if k.SelfSigned {
+			parts = append(parts, "self-signed")
+		}
+		if k.NotAfter != nil {
+			verb := "expires"
+			if k.Expired {
+				verb = "expired"
+			}
+			parts = append(parts, verb+" "+k.NotAfter.Format("2006-01-02"))
+		}
+		if algorithm != "" {
+			parts = append(parts, algorithm)
+		}
+	case analyzer.KeyStore:
+		parts = append(parts, k.Format+" keystore")
+	default:
+		parts = append(parts, strings.TrimSpace(algorithm+" private key")+" ("+k.Format+")")
+	}
+	if k.Encrypted {
+		parts = append(parts, "encrypted")
+	}
+	if len(k.PairedWith) > 0 {
+		parts = append(parts, "pairs with "+strings.Join(k.PairedWith, ", "))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// validated reports whether the format of the secret of f was checked, so
+// the outcome is worth showing.
+func validated(f analyzer.Finding) bool {
+	return f.Validation == analyzer.ValidationConfirmed || f.Validation == analyzer.ValidationInvalid
+}
+
+// countBySeverity summarizes vulnerabilities as "2 CRITICAL, 5 HIGH", most
+// severe first.
+func countBySeverity(vulns []analyzer.Vulnerability) string {
+	counts := make(map[string]int)
+	for _, v := range vulns {
+		counts[v.Severity]++
+	}
+	var parts []string
+	for _, s := range []string{vulndb.SeverityCritical, vulndb.SeverityHigh, vulndb.SeverityMedium, vulndb.SeverityLow, vulndb.SeverityUnknown} {
+		if counts[s] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[s], s))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// vulnerabilityName prefers the CVE identifier of an advisory.
+func vulnerabilityName(v analyzer.Vulnerability) string {
+	if len(v.CVEs) > 0 && v.CVEs[0] != v.ID {
+		return v.CVEs[0] + " (" + v.ID + ")"
+	}
+	return v.ID
+}
+
+// countByType summarizes packages as "120 deb, 3 rpm".
+func countByType(pkgs []analyzer.Package) string {
+	counts := make(map[string]int)
+	var types []string
+	for _, pkg := range pkgs {
+		if counts[pkg.Type] == 0 {
+			types = append(types, pkg.Type)
+		}
+		counts[pkg.Type]++
+	}
+	sort.Strings(types)
+	var parts []string
+	for _, t := range types {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[t], t))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// countByKind summarizes hardening issues as "2 setuid, 1 world-writable",
+// in the order of the kinds.
+func countByKind(issues []analyzer.HardeningIssue) string {
+	counts := make(map[string]int)
+	for _, i := range issues {
+		counts[i.Kind]++
+	}
+	var parts []string
+	for _, k := range []string{analyzer.HardeningSetuid, analyzer.HardeningSetgid, analyzer.HardeningCapabilities,
+		analyzer.HardeningWorldWritable, analyzer.HardeningWritableExecutable, analyzer.HardeningUnknownOwner} {
+		if counts[k] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[k], k))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// describeUser summarizes the account the image runs as, such as
+// "UID 1000, GID 1000, groups wheel", or "" when the report does not
+// resolve it.
+func describeUser(accounts *analyzer.Accounts) string {
+	if accounts == nil {
+		return ""
+	}
+	u := accounts.User
+	if !u.Resolved {
+		return "not defined by the image, docker refuses to start it"
+	}
+	s := fmt.Sprintf("UID %d, GID %d", u.UID, u.GID)
+	if len(u.Groups) > 0 {
+		s += ", groups " + strings.Join(u.Groups, ",")
+	}
+	return s
+}
+
+// countAccountIssues summarizes account issues as "1 empty-password,
+// 2 nopasswd-sudo", in the order of the kinds.
+func countAccountIssues(issues []analyzer.AccountIssue) string {
+	counts := make(map[string]int)
+	for _, i := range issues {
+		counts[i.Kind]++
+	}
+	var parts []string
+	for _, k := range []string{analyzer.AccountUnknownUser, analyzer.AccountEmptyPassword, analyzer.AccountWeakPassword,
+		analyzer.AccountWeakHash, analyzer.AccountExtraRoot, analyzer.AccountNoPasswdSudo} {
+		if counts[k] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[k], k))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// shortID abbreviates a container ID the way docker prints it.
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// FormatBytes prints a size in binary units, such as "12.3 MiB".
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatScore prints an efficiency as a percentage.
+func formatScore(score float64) string {
+	return fmt.Sprintf("%.1f%%", score*100)
+}
+
+// layerSummary describes the size of the layer of h, as "12.3 MiB, 4.1 MiB
+// compressed, 92.0% efficient". It is empty for instructions without a
+// layer and layers of unknown size.
+func layerSummary(h analyzer.History) string {
+	if h.LayerID == "" || h.Size == 0 {
+		return ""
+	}
+	parts := []string{FormatBytes(h.Size)}
+	if h.CompressedSize > 0 {
+		parts = append(parts, FormatBytes(h.CompressedSize)+" compressed")
+	}
+	parts = append(parts, formatScore(h.Efficiency())+" efficient")
+	if h.WastedBytes > 0 {
+		parts = append(parts, FormatBytes(h.WastedBytes)+" wasted")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// efficiencySummary describes the efficiency of an image, as "97.5%, 3.2 MiB
+// wasted".
+func efficiencySummary(e *analyzer.Efficiency) string {
+	return fmt.Sprintf("%s, %s wasted", formatScore(e.Score), FormatBytes(e.WastedBytes))
+}
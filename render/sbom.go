@@ -0,0 +1,97 @@
+package render
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"whaler/analyzer"
+)
+
+// purl returns the package URL of pkg, a package of report. OS packages are
+// namespaced by the distribution of the image and qualified by its release,
+// as in pkg:deb/debian/libc6@2.36-9?arch=amd64&distro=debian-12, when the
+// image has an os-release file.
+func purl(report *analyzer.Report, pkg analyzer.Package) string {
+	name := purlEscape(pkg.Name)
+	var distro string
+	switch pkg.Type {
+	case analyzer.PackageDeb, analyzer.PackageRpm, analyzer.PackageApk:
+		if release := report.OS; release != nil && release.ID != "" {
+			name = purlEscape(strings.ToLower(release.ID)) + "/" + name
+			if release.VersionID != "" {
+				distro = strings.ToLower(release.ID) + "-" + release.VersionID
+			}
+		}
+	case analyzer.PackageNpm:
+		// Scoped packages keep the scope as namespace
+		if scope, rest, ok := strings.Cut(pkg.Name, "/"); ok {
+			name = purlEscape(scope) + "/" + purlEscape(rest)
+		}
+	case analyzer.PackagePypi:
+		name = purlEscape(strings.ReplaceAll(strings.ToLower(pkg.Name), "_", "-"))
+	case analyzer.PackageMaven:
+		if group, artifact, ok := strings.Cut(pkg.Name, ":"); ok {
+			name = purlEscape(group) + "/" + purlEscape(artifact)
+		}
+	case analyzer.PackageGolang:
+		var parts []string
+		for _, part := range strings.Split(pkg.Name, "/") {
+			parts = append(parts, purlEscape(part))
+		}
+		name = strings.Join(parts, "/")
+	}
+	p := fmt.Sprintf("pkg:%s/%s", pkg.Type, name)
+	if pkg.Version != "" {
+		p += "@" + purlEscape(pkg.Version)
+	}
+	// Qualifiers are sorted by key
+	var qualifiers []string
+	if pkg.Arch != "" {
+		qualifiers = append(qualifiers, "arch="+url.QueryEscape(pkg.Arch))
+	}
+	if distro != "" {
+		qualifiers = append(qualifiers, "distro="+url.QueryEscape(distro))
+	}
+	if len(qualifiers) > 0 {
+		p += "?" + strings.Join(qualifiers, "&")
+	}
+	return p
+}
+
+// purlEscape percent-encodes a package URL segment. Unlike a URL path, '@'
+// must be encoded since it separates the version.
+func purlEscape(s string) string {
+	return strings.ReplaceAll(url.PathEscape(s), "@", "%40")
+}
+
+// dockerfile returns the reconstructed Dockerfile of the whole image, base
+// image layers included.
+func dockerfile(history []analyzer.History) string {
+	var lines []string
+	for _, h := range history {
+		lines = append(lines, h.Instruction())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// layerDigests maps layer names to their digests.
+func layerDigests(history []analyzer.History) map[string]string {
+	digests := make(map[string]string)
+	for _, h := range history {
+		if h.LayerID != "" {
+			digests[h.LayerID] = h.Digest
+		}
+	}
+	return digests
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,147 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"whaler/analyzer"
+)
+
+// SPDX writes an SPDX 2.3 JSON document. The image contains its layers and
+// every layer contains the packages it installed. The reconstructed
+// Dockerfile is recorded as the source information of the image package.
+type SPDX struct {
+	opts Options
+	now  func() time.Time
+}
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID                string            `json:"SPDXID"`
+	Name                  string            `json:"name"`
+	VersionInfo           string            `json:"versionInfo,omitempty"`
+	DownloadLocation      string            `json:"downloadLocation"`
+	FilesAnalyzed         bool              `json:"filesAnalyzed"`
+	PrimaryPackagePurpose string            `json:"primaryPackagePurpose,omitempty"`
+	Checksums             []spdxChecksum    `json:"checksums,omitempty"`
+	SourceInfo            string            `json:"sourceInfo,omitempty"`
+	Comment               string            `json:"comment,omitempty"`
+	ExternalRefs          []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	Element string `json:"spdxElementId"`
+	Type    string `json:"relationshipType"`
+	Related string `json:"relatedSpdxElement"`
+}
+
+func (s *SPDX) Render(w io.Writer, report *analyzer.Report) error {
+	report = redactReport(report, s.opts)
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              report.Image,
+		DocumentNamespace: fmt.Sprintf("https://github.com/P3GLEG/Whaler/spdx/%s-%s", url.PathEscape(report.Image), newUUID()),
+		CreationInfo: spdxCreationInfo{
+			Created:  s.now().UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: whaler"},
+		},
+	}
+
+	image := spdxPackage{
+		SPDXID:                "SPDXRef-Image",
+		Name:                  report.Image,
+		VersionInfo:           report.Metadata.ID,
+		DownloadLocation:      "NOASSERTION",
+		PrimaryPackagePurpose: "CONTAINER",
+		Checksums:             spdxChecksums(report.Metadata.ID),
+		SourceInfo:            "Built from the reconstructed Dockerfile:\n" + dockerfile(report.History),
+	}
+	doc.Packages = append(doc.Packages, image)
+	doc.Relationships = append(doc.Relationships, spdxRelationship{Element: doc.SPDXID, Type: "DESCRIBES", Related: image.SPDXID})
+
+	layers := make(map[string]string)
+	for i, h := range report.History {
+		if h.LayerID == "" {
+			continue
+		}
+		layer := spdxPackage{
+			SPDXID:                fmt.Sprintf("SPDXRef-Layer-%d", i),
+			Name:                  h.LayerID,
+			VersionInfo:           h.Digest,
+			DownloadLocation:      "NOASSERTION",
+			PrimaryPackagePurpose: "ARCHIVE",
+			Checksums:             spdxChecksums(h.Digest),
+			Comment:               h.Instruction(),
+		}
+		layers[h.LayerID] = layer.SPDXID
+		doc.Packages = append(doc.Packages, layer)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{Element: image.SPDXID, Type: "CONTAINS", Related: layer.SPDXID})
+	}
+
+	for i, pkg := range report.Packages {
+		p := spdxPackage{
+			SPDXID:                fmt.Sprintf("SPDXRef-Package-%d", i),
+			Name:                  pkg.Name,
+			VersionInfo:           pkg.Version,
+			DownloadLocation:      "NOASSERTION",
+			PrimaryPackagePurpose: "LIBRARY",
+			SourceInfo:            "acquired package info from " + pkg.Location,
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  purl(report, pkg),
+			}},
+		}
+		doc.Packages = append(doc.Packages, p)
+		parent, ok := layers[pkg.Layer]
+		if !ok {
+			parent = image.SPDXID
+		}
+		doc.Relationships = append(doc.Relationships, spdxRelationship{Element: parent, Type: "CONTAINS", Related: p.SPDXID})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// spdxChecksums turns a "sha256:..." digest into an SPDX checksum list.
+func spdxChecksums(digest string) []spdxChecksum {
+	alg, hex, ok := strings.Cut(digest, ":")
+	if !ok || alg != "sha256" {
+		return nil
+	}
+	return []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: hex}}
+}
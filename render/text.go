@@ -0,0 +1,376 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"whaler/analyzer"
+	"whaler/vulndb"
+
+	"github.com/fatih/color"
+)
+
+// Text writes the colored console output.
+type Text struct {
+	opts Options
+}
+
+// printer writes colored lines the way the color package helpers do, but to
+// an arbitrary writer.
+type printer struct {
+	w io.Writer
+}
+
+func (p printer) println(attr color.Attribute, format string, a ...interface{}) {
+	if !strings.HasSuffix(format, "\n") {
+		format += "\n"
+	}
+	color.New(attr).Fprintf(p.w, format, a...)
+}
+
+func (t *Text) Render(w io.Writer, report *analyzer.Report) error {
+	report = redactReport(report, t.opts)
+	p := printer{w}
+	p.println(color.FgWhite, "Analyzing %s", report.Image)
+	if c := report.Container; c != nil {
+		p.println(color.FgWhite, "Container %s (%s), %s since %s", c.Name, shortID(c.ID), c.State, c.Started)
+	}
+	p.metadata(report.Metadata, report.Accounts)
+	// Notes on how the image was read surround the findings in the order
+	// they were printed while it was
+	before := min(report.WarningsBeforeFindings, len(report.Warnings))
+	p.warnings(report.Warnings[:before])
+	p.findings(report.Findings, scannedFiles(report.History))
+	p.warnings(report.Warnings[before:])
+	if len(report.Suppressed) > 0 {
+		p.println(color.FgWhite, "Known findings suppressed by the baseline: %d", len(report.Suppressed))
+	}
+	p.keys(report.Keys)
+	p.hardening(report.Hardening)
+	p.accounts(report.Accounts)
+	t.gitRepos(p, report.GitRepos)
+	t.results(p, report.History)
+	p.containerChanges(report.Container)
+	t.efficiency(p, report.Efficiency)
+	t.packages(p, report)
+	p.vulnerabilities(report.Vulnerabilities)
+	p.policy(report.Policy)
+	return nil
+}
+
+// metadata prints the description of the image, unless it had none.
+func (p printer) metadata(md analyzer.Metadata, accounts *analyzer.Accounts) {
+	if md.Source == "" {
+		return
+	}
+	p.println(color.FgWhite, "Docker Version: %s", md.DockerVersion)
+	p.println(color.FgWhite, "GraphDriver: %s", md.GraphDriver)
+	p.environmentVariables(md.Env)
+	p.ports(md.ExposedPorts, md.Source)
+	p.userInfo(md.User, accounts)
+}
+
+func (p printer) warnings(warnings []string) {
+	for _, warning := range warnings {
+		p.println(color.FgYellow, "%s", warning)
+	}
+}
+
+// Generic print function for environment variables
+func (p printer) environmentVariables(env []string) {
+	if len(env) > 0 {
+		p.println(color.FgWhite, "Environment Variables")
+		for _, ele := range env {
+			p.println(color.FgYellow, "|%s", ele)
+		}
+		p.println(color.FgWhite, "\n")
+	}
+}
+
+// Generic print function for ports. Ports from the daemon are printed
+// without their protocol, those from the image config without /tcp.
+func (p printer) ports(ports []string, source string) {
+	p.println(color.FgWhite, "Open Ports")
+	for _, port := range ports {
+		if source == analyzer.MetadataDaemon {
+			port, _, _ = strings.Cut(port, "/")
+		} else {
+			port = strings.TrimSuffix(port, "/tcp")
+		}
+		p.println(color.FgGreen, "|%s", port)
+	}
+	p.println(color.FgWhite, "\n")
+}
+
+// Generic print function for user info
+func (p printer) userInfo(user string, accounts *analyzer.Accounts) {
+	p.println(color.FgWhite, "Image user")
+	if len(user) == 0 {
+		p.println(color.FgRed, "|%s", "User is root")
+	} else if accounts != nil && !accounts.User.Resolved {
+		p.println(color.FgRed, "|Image is running as User: %s, %s", user, describeUser(accounts))
+	} else if accounts != nil {
+		p.println(color.FgBlue, "|Image is running as User: %s (%s)", user, describeUser(accounts))
+	} else {
+		p.println(color.FgBlue, "|Image is running as User: %s", user)
+	}
+	p.println(color.FgWhite, "\n")
+}
+
+// findings prints the potential secrets under a header, which is printed
+// whenever file names were scanned, even when none matched.
+func (p printer) findings(findings []analyzer.Finding, scanned bool) {
+	if len(findings) == 0 && !scanned {
+		return
+	}
+	p.println(color.FgWhite, "Potential secrets:")
+	for _, f := range findings {
+		line := fmt.Sprintf("|Found match %s %s %s", f.Path, f.Description, f.Pattern)
+		if f.Entropy != 0 {
+			line += fmt.Sprintf(" (entropy %.2f)", f.Entropy)
+		}
+		line += " " + f.Layer
+		if validated(f) {
+			line += " [" + f.Validation + "]"
+		}
+		p.println(color.FgGreen, "%s", line)
+	}
+}
+
+// scannedFiles reports whether a layer has files outside the noise filter,
+// whose names are checked for secrets.
+func scannedFiles(history []analyzer.History) bool {
+	for _, h := range history {
+		for _, f := range h.Files {
+			if !f.Noise {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p printer) keys(keys []analyzer.KeyMaterial) {
+	if len(keys) == 0 {
+		return
+	}
+	p.println(color.FgWhite, "Keys and certificates:")
+	for _, k := range keys {
+		attr := color.FgBlue
+		if k.Kind == analyzer.KeyPrivate && !k.Encrypted {
+			attr = color.FgRed
+		} else if k.Expired {
+			attr = color.FgYellow
+		}
+		p.println(attr, "|%s %s %s", k.Path, describeKey(k), k.Layer)
+	}
+}
+
+// hardening prints the files whose permissions or ownership weaken the
+// image, with the instruction that wrote them.
+func (p printer) hardening(issues []analyzer.HardeningIssue) {
+	if len(issues) == 0 {
+		return
+	}
+	p.println(color.FgWhite, "Filesystem hardening: %s", countByKind(issues))
+	for _, i := range issues {
+		line := fmt.Sprintf("|%s %s %s %d:%d", i.Kind, i.Path, i.Mode, i.UID, i.GID)
+		if i.Detail != "" {
+			line += ", " + i.Detail
+		}
+		p.println(color.FgYellow, "%s", line)
+		p.println(color.FgBlue, "\t%s", firstLine(i.Instruction))
+	}
+	p.println(color.FgWhite, "")
+}
+
+// accounts prints the accounts of the image that are easy to log in as or
+// to escalate from, with the instruction that wrote the file defining them.
+func (p printer) accounts(accounts *analyzer.Accounts) {
+	if accounts == nil || len(accounts.Issues) == 0 {
+		return
+	}
+	p.println(color.FgWhite, "Accounts: %s", countAccountIssues(accounts.Issues))
+	for _, i := range accounts.Issues {
+		p.println(color.FgRed, "|%s %s %s, %s", i.Kind, i.User, i.Path, i.Detail)
+		p.println(color.FgBlue, "\t%s", firstLine(i.Instruction))
+	}
+	p.println(color.FgWhite, "")
+}
+
+// gitRepos prints the .git directories found in layers with their remotes
+// and latest commit, and every commit in verbose mode.
+func (t *Text) gitRepos(p printer, repos []analyzer.GitRepo) {
+	if len(repos) == 0 {
+		return
+	}
+	p.println(color.FgWhite, "Git repositories: %d", len(repos))
+	for _, r := range repos {
+		line := fmt.Sprintf("|%s %s, %d commits", r.Path, r.Layer, len(r.Commits))
+		if r.Head != "" {
+			line += ", HEAD " + r.Head
+		}
+		p.println(color.FgRed, "%s", line)
+		for _, remote := range r.Remotes {
+			p.println(color.FgBlue, "\t%s %s", remote.Name, remote.URL)
+		}
+		commits := r.Commits
+		if !t.opts.Verbose {
+			commits = commits[:min(len(commits), 1)]
+		}
+		for _, c := range commits {
+			p.println(color.FgBlue, "\t%s %s %s", shortID(c.Hash), c.Date, c.Subject)
+		}
+	}
+	p.println(color.FgWhite, "")
+}
+
+// packages prints how many packages each instruction installed, and the
+// packages themselves in verbose mode.
+func (t *Text) packages(p printer, report *analyzer.Report) {
+	if len(report.Packages) == 0 {
+		return
+	}
+	p.println(color.FgWhite, "Packages: %s", countByType(report.Packages))
+	for _, group := range groupByInstruction(report.Packages, report.History) {
+		p.println(color.FgGreen, "|%s: %s", firstLine(group[0].Instruction), countByType(group))
+		if t.opts.Verbose {
+			for _, pkg := range group {
+				p.println(color.FgBlue, "\t%s %s %s %s", pkg.Type, pkg.Name, pkg.Version, pkg.Arch)
+			}
+		}
+	}
+	p.println(color.FgWhite, "")
+}
+
+// vulnerabilities lists the advisories matching installed packages, most
+// severe first, with the instruction that installed the package.
+func (p printer) vulnerabilities(vulns []analyzer.Vulnerability) {
+	if len(vulns) == 0 {
+		return
+	}
+	p.println(color.FgWhite, "Vulnerabilities: %s", countBySeverity(vulns))
+	for _, v := range vulns {
+		fixed := "no fix available"
+		if v.FixedVersion != "" {
+			fixed = "fixed in " + v.FixedVersion
+		}
+		p.println(severityColor(v.Severity), "|%s %s %s %s, %s", v.Severity, vulnerabilityName(v), v.Package.Name, v.Package.Version, fixed)
+		p.println(color.FgBlue, "\t%s", firstLine(v.Package.Instruction))
+	}
+	p.println(color.FgWhite, "")
+}
+
+// policy prints the result of every policy rule.
+func (p printer) policy(results []analyzer.PolicyResult) {
+	if len(results) == 0 {
+		return
+	}
+	p.println(color.FgWhite, "Policy:")
+	for _, r := range results {
+		switch {
+		case r.Passed:
+			p.println(color.FgGreen, "|PASS %s: %s", r.RuleID, r.Description)
+		case r.Severity == analyzer.PolicySeverityWarning:
+			p.println(color.FgYellow, "|WARN %s: %s (%s)", r.RuleID, r.Description, r.Message)
+		default:
+			p.println(color.FgRed, "|FAIL %s: %s (%s)", r.RuleID, r.Description, r.Message)
+		}
+	}
+	p.println(color.FgWhite, "")
+}
+
+func severityColor(severity string) color.Attribute {
+	switch severity {
+	case vulndb.SeverityCritical, vulndb.SeverityHigh:
+		return color.FgRed
+	case vulndb.SeverityMedium:
+		return color.FgYellow
+	}
+	return color.FgGreen
+}
+
+func (t *Text) results(p printer, layers []analyzer.History) {
+	p.println(color.FgWhite, "Dockerfile:")
+	if t.opts.Verbose {
+		for i := 0; i < len(layers); i++ {
+			t.layerSize(p, layers[i])
+			p.println(color.FgGreen, "%s\n", layers[i].Instruction())
+			for _, l := range layers[i].Files {
+				p.println(color.FgBlue, "\t%s", l.Path)
+			}
+
+		}
+	} else {
+		for i := 1; i < len(layers); i++ {
+			t.layerSize(p, layers[i])
+			p.println(color.FgGreen, "%s\n", layers[i].Instruction())
+			if layers[i].IsCopy() {
+				for _, l := range layers[i].Files {
+					if !t.opts.Filter || !l.Noise {
+						p.println(color.FgGreen, "\t%s", l.Path)
+					}
+				}
+				p.println(color.FgGreen, "")
+			}
+
+		}
+
+	}
+	p.println(color.FgWhite, "")
+}
+
+// containerChanges lists the files changed in a container since it
+// started, marked like docker diff output.
+func (p printer) containerChanges(c *analyzer.Container) {
+	if c == nil {
+		return
+	}
+	p.println(color.FgWhite, "Changes in container %s since it started: %d", c.Name, len(c.Changes))
+	for _, change := range c.Changes {
+		switch change.Kind {
+		case analyzer.Added:
+			p.println(color.FgGreen, "|A %s", change.Path)
+		case analyzer.Changed:
+			p.println(color.FgYellow, "|C %s", change.Path)
+		default:
+			p.println(color.FgRed, "|D %s", change.Path)
+		}
+	}
+	p.println(color.FgWhite, "")
+}
+
+// largestFiles is the number of files listed per layer in verbose mode.
+const largestFiles = 5
+
+// layerSize prints the size of the layer of h as a comment above its
+// instruction, and its largest files in verbose mode.
+func (t *Text) layerSize(p printer, h analyzer.History) {
+	summary := layerSummary(h)
+	if summary == "" {
+		return
+	}
+	p.println(color.FgCyan, "# %s", summary)
+	if t.opts.Verbose {
+		for _, f := range h.LargestFiles(largestFiles) {
+			p.println(color.FgCyan, "#   %9s %s", FormatBytes(f.Size), f.Path)
+		}
+	}
+}
+
+// efficiency prints the efficiency of the image and the files that waste
+// the most bytes.
+func (t *Text) efficiency(p printer, e *analyzer.Efficiency) {
+	if e == nil {
+		return
+	}
+	p.println(color.FgWhite, "Image efficiency: %s", efficiencySummary(e))
+	wasted := e.Wasted
+	if !t.opts.Verbose {
+		wasted = wasted[:min(largestFiles, len(wasted))]
+	}
+	for _, w := range wasted {
+		p.println(color.FgYellow, "|%s %s in %d hidden copies", w.Path, FormatBytes(w.Bytes), w.Copies)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"whaler/analyzer"
+	"whaler/server"
+)
+
+// runServe implements whaler serve, which exposes the analyzer as a REST
+// API. Images are resolved through the docker daemon, connected on first
+// use.
+func runServe(a *analyzer.Analyzer, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	listen := fs.String("listen", ":8080", "Address to listen on")
+	workers := fs.Int("workers", server.DefaultWorkers, "Number of images analyzed at once")
+	queue := fs.Int("queue", server.DefaultMaxQueued, "Number of jobs waiting for a worker beyond which new jobs are refused")
+	cacheDir := fs.String("cache-dir", "", "Directory caching reports by image digest, no cache when empty")
+	maxUpload := fs.Int64("max-upload", server.DefaultMaxUploadSize, "Maximum size in bytes of uploaded tar files")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("usage: whaler serve [-listen :8080] [-workers n] [-cache-dir dir]")
+	}
+
+	var mu sync.Mutex
+	var cli analyzer.DockerClient
+	s := server.New(a, server.Options{
+		Workers:       *workers,
+		MaxQueued:     *queue,
+		CacheDir:      *cacheDir,
+		MaxUploadSize: *maxUpload,
+		Resolve: func(ref string) (analyzer.Source, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if cli == nil {
+				var err error
+				if cli, err = newDockerClient(); err != nil {
+					return nil, err
+				}
+			}
+			return &analyzer.DockerImage{Client: cli, Ref: ref}, nil
+		},
+	})
+	defer s.Close()
+	fmt.Fprintf(os.Stderr, "Listening on %s\n", *listen)
+	return http.ListenAndServe(*listen, s)
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"whaler/analyzer"
+	"whaler/internal/diskcache"
+)
+
+// errUncacheable is returned for digests that cannot name a cache file.
+var errUncacheable = errors.New("image digest cannot be cached")
+
+// reportCache stores reports on disk, one JSON file per image digest in a
+// directory per analyzer configuration, see analyzer.ReportNamespace.
+type reportCache struct {
+	dir       string
+	namespace string
+}
+
+func (c *reportCache) path(digest string) (string, error) {
+	name, ok := diskcache.Path(filepath.Join(c.dir, c.namespace), digest, ".json")
+	if !ok {
+		return "", errUncacheable
+	}
+	return name, nil
+}
+
+// get returns the cached report of the image, if any. Unreadable entries
+// are treated as missing.
+func (c *reportCache) get(digest string) (*analyzer.Report, bool) {
+	name, err := c.path(digest)
+	if err != nil {
+		return nil, false
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, false
+	}
+	var report analyzer.Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, false
+	}
+	return &report, true
+}
+
+// put stores the report of the image, never visible partially written to
+// readers.
+func (c *reportCache) put(digest string, report *analyzer.Report) error {
+	name, err := c.path(digest)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return diskcache.WriteFile(name, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
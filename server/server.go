@@ -0,0 +1,385 @@
+// Package server exposes the analyzer as a REST API. Images are submitted
+// as jobs, by reference or as an uploaded tarball, analyzed in the
+// background by a bounded number of workers and their reports fetched once
+// done:
+//
+//	POST /v1/jobs             {"image": "nginx:latest"}, or a tar body
+//	GET  /v1/jobs/{id}        job status
+//	GET  /v1/jobs/{id}/report JSON report of a finished job
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"whaler/analyzer"
+	"whaler/render"
+)
+
+// Defaults of Options
+const (
+	DefaultWorkers       = 2
+	DefaultMaxQueued     = 64
+	DefaultMaxUploadSize = 8 << 30
+	DefaultJobTTL        = time.Hour
+)
+
+// Job states
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// Options configures a Server. Zero values take the defaults.
+type Options struct {
+	// Workers is the number of images analyzed at once.
+	Workers int
+	// MaxQueued is the number of jobs waiting for a worker beyond which new
+	// jobs are refused.
+	MaxQueued int
+	// MaxUploadSize is the size of the largest tarball accepted.
+	MaxUploadSize int64
+	// UploadDir holds uploaded tarballs until their job ends, the system
+	// temporary directory when empty.
+	UploadDir string
+	// CacheDir, when set, holds the reports of analyzed images keyed by
+	// image digest and analyzer configuration, so that images already
+	// analyzed are not analyzed again.
+	CacheDir string
+	// JobTTL is how long finished jobs can be polled.
+	JobTTL time.Duration
+	// Resolve returns the source of an image reference. Jobs can only be
+	// submitted as uploads when it is nil.
+	Resolve func(ref string) (analyzer.Source, error)
+}
+
+// Job is an image submitted for analysis.
+type Job struct {
+	ID     string `json:"id"`
+	Image  string `json:"image"`
+	Status string `json:"status"`
+	// Digest is the image ID, known once the job ran
+	Digest string `json:"digest,omitempty"`
+	// Cached is set when the report was read from the cache
+	Cached   bool       `json:"cached,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+
+	source analyzer.Source
+	upload string
+	report *analyzer.Report
+}
+
+// Server runs analysis jobs and serves the API. It implements http.Handler.
+type Server struct {
+	a     *analyzer.Analyzer
+	opts  Options
+	mux   *http.ServeMux
+	cache *reportCache
+	sem   chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	jobs   map[string]*Job
+	queued int
+}
+
+// New returns a server analyzing images with a.
+func New(a *analyzer.Analyzer, opts Options) *Server {
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultWorkers
+	}
+	if opts.MaxQueued <= 0 {
+		opts.MaxQueued = DefaultMaxQueued
+	}
+	if opts.MaxUploadSize <= 0 {
+		opts.MaxUploadSize = DefaultMaxUploadSize
+	}
+	if opts.JobTTL <= 0 {
+		opts.JobTTL = DefaultJobTTL
+	}
+	s := &Server{
+		a:    a,
+		opts: opts,
+		mux:  http.NewServeMux(),
+		sem:  make(chan struct{}, opts.Workers),
+		jobs: make(map[string]*Job),
+	}
+	if opts.CacheDir != "" {
+		s.cache = &reportCache{dir: opts.CacheDir, namespace: a.ReportNamespace()}
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.mux.HandleFunc("POST /v1/jobs", s.submit)
+	s.mux.HandleFunc("GET /v1/jobs/{id}", s.status)
+	s.mux.HandleFunc("GET /v1/jobs/{id}/report", s.report)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Close cancels the jobs in progress and waits for them to end.
+func (s *Server) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// submit creates a job from a JSON body naming an image, or from an
+// uploaded tarball named by the name query parameter.
+func (s *Server) submit(w http.ResponseWriter, r *http.Request) {
+	// A queue slot is reserved before the image is resolved or uploaded, so
+	// that a full queue refuses uploads before they are written to disk
+	s.mu.Lock()
+	s.expire()
+	if s.queued >= s.opts.MaxQueued {
+		s.mu.Unlock()
+		writeError(w, http.StatusServiceUnavailable, "too many queued jobs, retry later")
+		return
+	}
+	s.queued++
+	s.mu.Unlock()
+	job := &Job{Created: time.Now().UTC(), Status: StatusQueued}
+	accepted := false
+	defer func() {
+		if accepted {
+			return
+		}
+		s.mu.Lock()
+		s.queued--
+		s.mu.Unlock()
+		if job.upload != "" {
+			os.Remove(job.upload)
+		}
+	}()
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		var req struct {
+			Image string `json:"image"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil || req.Image == "" {
+			writeError(w, http.StatusBadRequest, "expected a JSON body such as {\"image\": \"nginx:latest\"}")
+			return
+		}
+		if s.opts.Resolve == nil {
+			writeError(w, http.StatusBadRequest, "image references are not supported, upload a tar file")
+			return
+		}
+		source, err := s.opts.Resolve(req.Image)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		job.Image, job.source = req.Image, source
+	case "application/x-tar", "application/octet-stream":
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			name = "upload.tar"
+		}
+		upload, err := s.saveUpload(w, r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		job.Image, job.upload = name, upload
+		job.source = &uploadSource{name: name, TarFile: analyzer.TarFile{Path: upload, Stream: true}}
+	default:
+		writeError(w, http.StatusUnsupportedMediaType, "expected application/json or application/x-tar")
+		return
+	}
+
+	id, err := newID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	job.ID = id
+	s.mu.Lock()
+	s.jobs[id] = job
+	view := *job
+	s.mu.Unlock()
+	accepted = true
+
+	s.wg.Add(1)
+	go s.run(job)
+	w.Header().Set("Location", "/v1/jobs/"+id)
+	writeJSON(w, http.StatusAccepted, &view)
+}
+
+// saveUpload copies the request body to a temporary file.
+func (s *Server) saveUpload(w http.ResponseWriter, r *http.Request) (string, error) {
+	f, err := os.CreateTemp(s.opts.UploadDir, "whaler-upload-*.tar")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(f, http.MaxBytesReader(w, r.Body, s.opts.MaxUploadSize))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to read upload: %v", err)
+	}
+	return f.Name(), nil
+}
+
+// run waits for a worker and analyzes the image of job, or reads its report
+// from the cache.
+func (s *Server) run(job *Job) {
+	defer s.wg.Done()
+	if job.upload != "" {
+		defer os.Remove(job.upload)
+	}
+	select {
+	case s.sem <- struct{}{}:
+		defer func() { <-s.sem }()
+	case <-s.ctx.Done():
+		s.update(job, func() { s.queued-- })
+		s.finish(job, nil, s.ctx.Err())
+		return
+	}
+	s.update(job, func() {
+		s.queued--
+		job.Status = StatusRunning
+	})
+
+	if s.cache != nil {
+		digest, err := analyzer.ImageDigest(s.ctx, job.source)
+		if err != nil {
+			s.finish(job, nil, err)
+			return
+		}
+		s.update(job, func() { job.Digest = digest })
+		if report, ok := s.cache.get(digest); ok {
+			// The report names the image first analyzed with this digest
+			report.Image = job.Image
+			s.update(job, func() { job.Cached = true })
+			s.finish(job, report, nil)
+			return
+		}
+	}
+	report, err := s.a.Analyze(s.ctx, job.source)
+	if err == nil && s.cache != nil {
+		if err := s.cache.put(report.Metadata.ID, report); err != nil && err != errUncacheable {
+			report.Warnings = append(report.Warnings, "server: failed to cache report: "+err.Error())
+		}
+	}
+	s.finish(job, report, err)
+}
+
+// update changes job under the lock of the server.
+func (s *Server) update(job *Job, fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn()
+}
+
+func (s *Server) finish(job *Job, report *analyzer.Report, err error) {
+	s.update(job, func() {
+		now := time.Now().UTC()
+		job.Finished = &now
+		// Drop the source, and whatever it holds, with the job kept for
+		// polling
+		job.source = nil
+		if err != nil {
+			job.Status, job.Error = StatusFailed, err.Error()
+			return
+		}
+		job.Status, job.report = StatusDone, report
+		if job.Digest == "" {
+			job.Digest = report.Metadata.ID
+		}
+	})
+}
+
+// expire forgets the jobs finished for longer than the job TTL. The lock of
+// the server is held.
+func (s *Server) expire() {
+	for id, job := range s.jobs {
+		if job.Finished != nil && time.Since(*job.Finished) > s.opts.JobTTL {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// lookup returns a copy of the job named in the request path, and its
+// report once done.
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) (*Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "no such job")
+		return nil, false
+	}
+	view := *job
+	return &view, true
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	if job, ok := s.lookup(w, r); ok {
+		writeJSON(w, http.StatusOK, job)
+	}
+}
+
+// report serves the report of a finished job. Jobs still queued, running or
+// failed answer 409 with their status.
+func (s *Server) report(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	if job.Status != StatusDone {
+		writeJSON(w, http.StatusConflict, job)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	// The analyzer masks secrets when its options ask it to
+	renderer, _ := render.New("json", render.Options{Reveal: true})
+	renderer.Render(w, job.report)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
+
+// uploadSource is an uploaded tarball named after the name given by the
+// client rather than the temporary file holding it.
+type uploadSource struct {
+	analyzer.TarFile
+	name string
+}
+
+func (u *uploadSource) Name() string { return u.name }
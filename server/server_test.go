@@ -0,0 +1,251 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"whaler/analyzer"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testImage = "../analyzer/testdata/test-image.tar"
+
+func newTestServer(t *testing.T, opts Options) *httptest.Server {
+	a, err := analyzer.New(analyzer.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(a, opts)
+	ts := httptest.NewServer(s)
+	t.Cleanup(func() {
+		ts.Close()
+		s.Close()
+	})
+	return ts
+}
+
+func decode(t *testing.T, resp *http.Response, v interface{}) {
+	t.Helper()
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func upload(t *testing.T, ts *httptest.Server, name string) Job {
+	t.Helper()
+	data, err := os.ReadFile(testImage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(ts.URL+"/v1/jobs?name="+name, "application/x-tar", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var job Job
+	decode(t, resp, &job)
+	assert.Equal(t, "/v1/jobs/"+job.ID, resp.Header.Get("Location"))
+	return job
+}
+
+// wait polls a job until it is done or failed.
+func wait(t *testing.T, ts *httptest.Server, id string) Job {
+	t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		resp, err := http.Get(ts.URL + "/v1/jobs/" + id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var job Job
+		decode(t, resp, &job)
+		if job.Status == StatusDone || job.Status == StatusFailed {
+			return job
+		}
+	}
+	t.Fatalf("job %s did not finish", id)
+	return Job{}
+}
+
+func TestUpload(t *testing.T) {
+	cache, uploads := t.TempDir(), t.TempDir()
+	ts := newTestServer(t, Options{CacheDir: cache, UploadDir: uploads})
+
+	job := upload(t, ts, "test-image")
+	assert.Equal(t, StatusQueued, job.Status)
+	assert.Equal(t, "test-image", job.Image)
+	job = wait(t, ts, job.ID)
+	assert.Equal(t, StatusDone, job.Status)
+	assert.False(t, job.Cached)
+	assert.Regexp(t, `^sha256:[0-9a-f]{64}$`, job.Digest)
+	assert.NotNil(t, job.Finished)
+
+	resp, err := http.Get(ts.URL + "/v1/jobs/" + job.ID + "/report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var report analyzer.Report
+	decode(t, resp, &report)
+	assert.Equal(t, "test-image", report.Image)
+	assert.Equal(t, job.Digest, report.Metadata.ID)
+	a, _ := analyzer.New(analyzer.Options{})
+	assert.FileExists(t, filepath.Join(cache, a.ReportNamespace(), strings.Replace(job.Digest, ":", "-", 1)+".json"))
+
+	// The same image is served from the cache, under the name it was
+	// submitted with
+	again := wait(t, ts, upload(t, ts, "renamed").ID)
+	assert.True(t, again.Cached)
+	assert.Equal(t, job.Digest, again.Digest)
+	resp, err = http.Get(ts.URL + "/v1/jobs/" + again.ID + "/report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decode(t, resp, &report)
+	assert.Equal(t, "renamed", report.Image)
+
+	assert.Eventually(t, func() bool {
+		entries, _ := os.ReadDir(uploads)
+		return len(entries) == 0
+	}, 5*time.Second, 10*time.Millisecond, "uploads are removed once analyzed")
+}
+
+func TestBadRequests(t *testing.T) {
+	ts := newTestServer(t, Options{})
+
+	resp, err := http.Post(ts.URL+"/v1/jobs", "application/json", strings.NewReader(`{"image": "nginx"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "references need a resolver")
+	var body map[string]string
+	decode(t, resp, &body)
+	assert.Contains(t, body["error"], "not supported")
+
+	resp, err = http.Post(ts.URL+"/v1/jobs", "application/json", strings.NewReader(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	resp, err = http.Post(ts.URL+"/v1/jobs", "text/plain", strings.NewReader("nginx"))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+	resp.Body.Close()
+
+	resp, err = http.Get(ts.URL + "/v1/jobs/missing")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp.Body.Close()
+
+	// Uploads that are not images fail their job
+	resp, err = http.Post(ts.URL+"/v1/jobs", "application/x-tar", strings.NewReader("not a tar"))
+	assert.NoError(t, err)
+	var job Job
+	decode(t, resp, &job)
+	job = wait(t, ts, job.ID)
+	assert.Equal(t, StatusFailed, job.Status)
+	assert.NotEmpty(t, job.Error)
+	resp, err = http.Get(ts.URL + "/v1/jobs/" + job.ID + "/report")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp.Body.Close()
+}
+
+// blockingSource serves the test image once release is closed.
+type blockingSource struct {
+	name    string
+	release chan struct{}
+}
+
+func (b *blockingSource) Name() string { return b.name }
+
+func (b *blockingSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	f, err := os.Open(testImage)
+	return f, err
+}
+
+func TestConcurrency(t *testing.T) {
+	release := make(chan struct{})
+	uploads := t.TempDir()
+	ts := newTestServer(t, Options{
+		Workers:   1,
+		MaxQueued: 1,
+		UploadDir: uploads,
+		Resolve: func(ref string) (analyzer.Source, error) {
+			return &blockingSource{name: ref, release: release}, nil
+		},
+	})
+	submit := func(ref string) *http.Response {
+		resp, err := http.Post(ts.URL+"/v1/jobs", "application/json", strings.NewReader(fmt.Sprintf(`{"image": %q}`, ref)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	status := func(id string) string {
+		resp, err := http.Get(ts.URL + "/v1/jobs/" + id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var job Job
+		decode(t, resp, &job)
+		return job.Status
+	}
+
+	var first, second Job
+	decode(t, submit("first"), &first)
+	assert.Eventually(t, func() bool { return status(first.ID) == StatusRunning }, 5*time.Second, 10*time.Millisecond)
+	decode(t, submit("second"), &second)
+
+	// One job runs and one waits, so the queue is full
+	resp := submit("third")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	resp.Body.Close()
+	assert.Equal(t, StatusQueued, status(second.ID))
+	resp, err := http.Post(ts.URL+"/v1/jobs", "application/x-tar", strings.NewReader("not read"))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	resp.Body.Close()
+	entries, _ := os.ReadDir(uploads)
+	assert.Empty(t, entries, "uploads are refused before they are saved")
+
+	resp, err = http.Get(ts.URL + "/v1/jobs/" + first.ID + "/report")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode, "reports are served once done")
+	resp.Body.Close()
+
+	close(release)
+	assert.Equal(t, StatusDone, wait(t, ts, first.ID).Status)
+	assert.Equal(t, StatusDone, wait(t, ts, second.ID).Status)
+}
+
+func TestReportCache(t *testing.T) {
+	c := &reportCache{dir: filepath.Join(t.TempDir(), "cache"), namespace: "v1-0123456789abcdef"}
+	digest := "sha256:" + strings.Repeat("ab", 32)
+	_, ok := c.get(digest)
+	assert.False(t, ok)
+
+	assert.NoError(t, c.put(digest, &analyzer.Report{Image: "cached"}))
+	report, ok := c.get(digest)
+	assert.True(t, ok)
+	assert.Equal(t, "cached", report.Image)
+	other := &reportCache{dir: c.dir, namespace: "v1-fedcba9876543210"}
+	_, ok = other.get(digest)
+	assert.False(t, ok, "reports of other analyzer configurations are not used")
+
+	assert.ErrorIs(t, c.put("sha256:../../etc/passwd", &analyzer.Report{}), errUncacheable)
+}
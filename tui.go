@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"whaler/analyzer"
+	"whaler/tui"
+)
+
+// runTUI implements whaler tui <image>, browsing the layers of an image
+// interactively. Dumped files are saved under the current directory the way
+// -x saves layers.
+func runTUI(a *analyzer.Analyzer, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: whaler tui <image>")
+	}
+	var cli analyzer.DockerClient
+	defer func() {
+		if cli != nil {
+			cli.Close()
+		}
+	}()
+	source, err := sourceFor(args[0], &cli)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	report, err := a.Analyze(ctx, source)
+	if err != nil {
+		return fmt.Errorf("%s: %v", args[0], err)
+	}
+	m := tui.New(report, func(layerID, name string) (string, error) {
+		return a.DumpFile(ctx, source, report, layerID, name, ".")
+	})
+	return tui.Run(m, os.Stdin, os.Stdout)
+}
@@ -0,0 +1,80 @@
+package tui
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/moby/term"
+)
+
+// Escape sequences switching to the alternate screen with a hidden cursor,
+// and back
+const (
+	enterScreen = "\x1b[?1049h\x1b[?25l"
+	leaveScreen = "\x1b[?25h\x1b[?1049l"
+)
+
+// keys maps the escape sequences of special keys to their names.
+var keys = map[string]string{
+	"\x1b[A": "up", "\x1bOA": "up",
+	"\x1b[B": "down", "\x1bOB": "down",
+	"\x1b[C": "right", "\x1bOC": "right",
+	"\x1b[D": "left", "\x1bOD": "left",
+	"\x1b[5~": "pgup", "\x1b[6~": "pgdn",
+	"\x1b[H": "home", "\x1b[1~": "home", "\x1bOH": "home",
+	"\x1b[F": "end", "\x1b[4~": "end", "\x1bOF": "end",
+	"\t": "tab", "\r": "enter", "\n": "enter",
+	"\x03": "ctrl-c",
+}
+
+// parseKey names the key read from a raw terminal.
+func parseKey(input []byte) string {
+	if name, ok := keys[string(input)]; ok {
+		return name
+	}
+	if len(input) == 1 {
+		return string(input)
+	}
+	return ""
+}
+
+// Run shows m on the terminal of in and out until the user quits.
+func Run(m *Model, in, out *os.File) error {
+	fd := in.Fd()
+	if !term.IsTerminal(fd) || !term.IsTerminal(out.Fd()) {
+		return errors.New("whaler tui needs a terminal")
+	}
+	state, err := term.SetRawTerminal(fd)
+	if err != nil {
+		return err
+	}
+	defer term.RestoreTerminal(fd, state)
+	io.WriteString(out, enterScreen)
+	defer io.WriteString(out, leaveScreen)
+
+	buf := make([]byte, 16)
+	for !m.Quit() {
+		draw(m, out)
+		if m.pending != nil {
+			m.RunPending()
+			continue
+		}
+		n, err := in.Read(buf)
+		if err != nil {
+			return err
+		}
+		m.Update(parseKey(buf[:n]))
+	}
+	return nil
+}
+
+// draw writes a frame, sized to the terminal at the time.
+func draw(m *Model, out *os.File) {
+	width, height := 80, 24
+	if ws, err := term.GetWinsize(out.Fd()); err == nil && ws.Width > 0 {
+		width, height = int(ws.Width), int(ws.Height)
+	}
+	io.WriteString(out, "\x1b[H"+strings.Join(m.View(width, height), "\x1b[K\r\n")+"\x1b[K")
+}
@@ -0,0 +1,113 @@
+package tui
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"whaler/analyzer"
+)
+
+// Entry is a line of the file tree.
+type Entry struct {
+	Path  string
+	Name  string
+	Depth int
+	Dir   bool
+	Size  int64
+	// Change is analyzer.Added, analyzer.Changed or analyzer.Removed for
+	// files the selected layer touches, empty otherwise
+	Change string
+	// Layer is the layer providing the file, or the one that provided it
+	// before its deletion
+	Layer string
+	// Secret is set when a finding was made on the file
+	Secret bool
+}
+
+// secretKey identifies the file of a finding in secretSet.
+func secretKey(layer, name string) string {
+	return layer + "\x00" + name
+}
+
+// secretSet indexes the findings made on layer files. Findings inside
+// archives highlight the archive.
+func secretSet(r *analyzer.Report) map[string]bool {
+	secrets := make(map[string]bool)
+	for _, f := range r.Findings {
+		if f.Layer == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Path, "!/")
+		secrets[secretKey(f.Layer, analyzer.CleanPath(name))] = true
+	}
+	return secrets
+}
+
+// buildTree lists the files the history entry at index i adds, modifies and
+// deletes, or with merged set, the whole filesystem after it with those
+// changes marked. Parent directories missing from the list are added so the
+// result reads as a tree.
+func buildTree(r *analyzer.Report, i int, merged bool, secrets map[string]bool) []Entry {
+	before, after := r.FilesystemAt(i-1), r.FilesystemAt(i)
+	entries := make(map[string]Entry)
+	entry := func(name string, f analyzer.MergedFile, change string) Entry {
+		layer := r.History[f.History].LayerID
+		return Entry{
+			Path:   name,
+			Dir:    f.Mode.IsDir(),
+			Size:   f.Size,
+			Change: change,
+			Layer:  layer,
+			Secret: secrets[secretKey(layer, name)],
+		}
+	}
+	if merged {
+		for name, f := range after {
+			entries[name] = entry(name, f, "")
+		}
+	}
+	for _, f := range r.History[i].Files {
+		name := analyzer.CleanPath(f.Path)
+		provided, ok := after[name]
+		if name == "" || !ok || provided.History != i {
+			continue
+		}
+		change := analyzer.Added
+		if _, existed := before[name]; existed {
+			change = analyzer.Changed
+		}
+		entries[name] = entry(name, provided, change)
+	}
+	for name, f := range before {
+		if _, ok := after[name]; !ok {
+			entries[name] = entry(name, f, analyzer.Removed)
+		}
+	}
+
+	// Sort on path components so that children follow their directory
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(a, b int) bool {
+		return strings.ReplaceAll(names[a], "/", "\x00") < strings.ReplaceAll(names[b], "/", "\x00")
+	})
+	var tree []Entry
+	shown := make(map[string]bool)
+	for _, name := range names {
+		parts := strings.Split(name, "/")
+		for depth := range parts[:len(parts)-1] {
+			dir := strings.Join(parts[:depth+1], "/")
+			if !shown[dir] && entries[dir].Path == "" {
+				shown[dir] = true
+				tree = append(tree, Entry{Path: dir, Name: parts[depth], Depth: depth, Dir: true})
+			}
+		}
+		e := entries[name]
+		e.Name, e.Depth = path.Base(name), len(parts)-1
+		shown[name] = true
+		tree = append(tree, e)
+	}
+	return tree
+}
@@ -0,0 +1,311 @@
+// Package tui is an interactive terminal browser for analyzer reports: the
+// reconstructed Dockerfile on the left and the files of the selected layer
+// on the right.
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"whaler/analyzer"
+)
+
+// ANSI attributes used to draw the interface
+const (
+	reset   = "\x1b[0m"
+	bold    = "\x1b[1m"
+	reverse = "\x1b[7m"
+	red     = "\x1b[31m"
+	green   = "\x1b[32m"
+	yellow  = "\x1b[33m"
+	faint   = "\x1b[2m"
+)
+
+// Panes of the interface
+const (
+	paneInstructions = iota
+	paneFiles
+)
+
+const help = "↑↓ move  tab switch pane  m merged tree  d dump file  q quit"
+
+// DumpFunc saves a file of a layer to disk and returns where it was written.
+type DumpFunc func(layerID, name string) (string, error)
+
+// Model is the state of the interface. It is driven by Update with key
+// names and drawn by View, which keeps it testable without a terminal.
+type Model struct {
+	report  *analyzer.Report
+	dump    DumpFunc
+	secrets map[string]bool
+	// flagged marks the history entries with findings
+	flagged []bool
+
+	focus  int
+	layer  int
+	merged bool
+	tree   []Entry
+	cursor int
+	// top and treeTop are the first lines shown in each pane
+	top, treeTop int
+	// rows is the height of the panes at the last View
+	rows int
+
+	status  string
+	pending *Entry
+	quit    bool
+}
+
+// New returns a model browsing report. dump is called by the dump action.
+func New(report *analyzer.Report, dump DumpFunc) *Model {
+	m := &Model{report: report, dump: dump, secrets: secretSet(report), rows: 20}
+	m.flagged = make([]bool, len(report.History))
+	for _, f := range report.Findings {
+		if i := f.HistoryIndex; i != nil && *i < len(m.flagged) {
+			m.flagged[*i] = true
+			continue
+		}
+		for i, h := range report.History {
+			if f.Layer != "" && f.Layer == h.LayerID {
+				m.flagged[i] = true
+			}
+		}
+	}
+	m.selectLayer(0)
+	return m
+}
+
+// Quit reports whether the user asked to leave.
+func (m *Model) Quit() bool {
+	return m.quit
+}
+
+func (m *Model) selectLayer(i int) {
+	if len(m.report.History) == 0 {
+		return
+	}
+	m.layer = max(0, min(i, len(m.report.History)-1))
+	m.tree = buildTree(m.report, m.layer, m.merged, m.secrets)
+	m.cursor, m.treeTop = 0, 0
+}
+
+// Update applies a key, as returned by parseKey.
+func (m *Model) Update(key string) {
+	m.status = ""
+	switch key {
+	case "q", "ctrl-c":
+		m.quit = true
+	case "tab":
+		m.focus = 1 - m.focus
+	case "left", "h":
+		m.focus = paneInstructions
+	case "right", "l", "enter":
+		m.focus = paneFiles
+	case "m":
+		m.merged = !m.merged
+		m.selectLayer(m.layer)
+	case "d":
+		m.requestDump()
+	case "up", "k":
+		m.move(-1)
+	case "down", "j":
+		m.move(1)
+	case "pgup":
+		m.move(-max(m.rows-1, 1))
+	case "pgdn":
+		m.move(max(m.rows-1, 1))
+	case "home", "g":
+		m.move(-1 << 30)
+	case "end", "G":
+		m.move(1 << 30)
+	}
+}
+
+func (m *Model) treeEmpty() bool {
+	return len(m.tree) == 0
+}
+
+func (m *Model) move(delta int) {
+	if m.focus == paneInstructions {
+		if i := max(0, min(m.layer+delta, len(m.report.History)-1)); i != m.layer {
+			m.selectLayer(i)
+		}
+		return
+	}
+	m.cursor = max(0, min(m.cursor+delta, len(m.tree)-1))
+}
+
+// requestDump queues the dump of the selected file. It runs after the frame
+// announcing it is drawn, as reading the image again can take a while.
+func (m *Model) requestDump() {
+	if m.treeEmpty() {
+		return
+	}
+	e := m.tree[m.cursor]
+	switch {
+	case m.dump == nil:
+		m.status = "Dumping files is not available"
+	case e.Dir || e.Layer == "":
+		m.status = e.Path + " is a directory"
+	default:
+		m.pending = &e
+		m.status = "Reading " + e.Path + " from " + e.Layer + "..."
+	}
+}
+
+// RunPending runs the action queued by the last Update, if any.
+func (m *Model) RunPending() {
+	if m.pending == nil {
+		return
+	}
+	e := m.pending
+	m.pending = nil
+	out, err := m.dump(e.Layer, e.Path)
+	if err != nil {
+		m.status = "Error: " + err.Error()
+		return
+	}
+	m.status = "Wrote " + e.Path + " to " + out
+}
+
+// View draws the interface in a width by height terminal, one line per
+// element of the result.
+func (m *Model) View(width, height int) []string {
+	width, height = max(width, 20), max(height, 4)
+	m.rows = height - 2
+	leftWidth := max(width*2/5, 10)
+	rightWidth := width - leftWidth - 1
+
+	mode := "layer"
+	if m.merged {
+		mode = "merged"
+	}
+	lines := []string{reverse + fit(fmt.Sprintf(" whaler: %s  [%s tree]", m.report.Image, mode), width) + reset}
+
+	left := m.instructionLines(leftWidth)
+	right := m.treeLines(rightWidth)
+	for row := 0; row < m.rows; row++ {
+		l := strings.Repeat(" ", leftWidth)
+		if row < len(left) {
+			l = left[row]
+		}
+		r := ""
+		if row < len(right) {
+			r = right[row]
+		}
+		lines = append(lines, l+faint+"│"+reset+r)
+	}
+
+	status := m.status
+	if status == "" {
+		status = help
+	}
+	return append(lines, fit(status, width))
+}
+
+// instructionLines draws the Dockerfile pane, scrolled to the selection.
+func (m *Model) instructionLines(width int) []string {
+	m.top = scroll(m.top, m.layer, m.rows, len(m.report.History))
+	var lines []string
+	for i := m.top; i < len(m.report.History) && len(lines) < m.rows; i++ {
+		marker := "  "
+		if m.flagged[i] {
+			marker = "! "
+		}
+		text := fit(marker+oneLine(m.report.History[i].Instruction()), width)
+		switch {
+		case i == m.layer && m.focus == paneInstructions:
+			text = reverse + text + reset
+		case i == m.layer:
+			text = bold + text + reset
+		case m.flagged[i]:
+			text = red + text + reset
+		}
+		lines = append(lines, text)
+	}
+	return lines
+}
+
+// treeLines draws the file pane: a header naming the layer, then the tree
+// scrolled to the cursor.
+func (m *Model) treeLines(width int) []string {
+	var header string
+	if len(m.report.History) > 0 {
+		h := m.report.History[m.layer]
+		switch {
+		case m.merged:
+			header = fmt.Sprintf("Filesystem after step %d", m.layer+1)
+		case h.LayerID == "":
+			header = "No layer"
+		default:
+			header = fmt.Sprintf("Layer %s", h.LayerID)
+		}
+	}
+	lines := []string{bold + fit(" "+header, width) + reset}
+	if m.treeEmpty() {
+		return append(lines, faint+fit(" no changes", width)+reset)
+	}
+	rows := m.rows - 1
+	m.treeTop = scroll(m.treeTop, m.cursor, rows, len(m.tree))
+	for i := m.treeTop; i < len(m.tree) && len(lines) <= rows; i++ {
+		e := m.tree[i]
+		name := e.Name
+		if e.Dir {
+			name += "/"
+		}
+		marker, color := changeMarker(e.Change)
+		if e.Secret {
+			name += "  ! secret"
+			color = red + bold
+		}
+		text := fit(" "+marker+" "+strings.Repeat("  ", e.Depth)+name, width)
+		if i == m.cursor && m.focus == paneFiles {
+			color += reverse
+		}
+		if color != "" {
+			text = color + text + reset
+		}
+		lines = append(lines, text)
+	}
+	return lines
+}
+
+// changeMarker returns the marker and color of a kind of change.
+func changeMarker(change string) (string, string) {
+	switch change {
+	case analyzer.Added:
+		return "+", green
+	case analyzer.Changed:
+		return "~", yellow
+	case analyzer.Removed:
+		return "-", red + faint
+	}
+	return " ", ""
+}
+
+// scroll returns the first line to show so that line selected is visible in
+// a window of rows lines over total lines.
+func scroll(top, selected, rows, total int) int {
+	if selected < top {
+		top = selected
+	}
+	if selected >= top+rows {
+		top = selected - rows + 1
+	}
+	return max(0, min(top, total-rows))
+}
+
+// oneLine joins the continuation lines of a reconstructed instruction.
+func oneLine(instruction string) string {
+	return strings.Join(strings.Fields(strings.ReplaceAll(instruction, "\\\n", "")), " ")
+}
+
+// fit truncates or pads s to exactly width characters.
+func fit(s string, width int) string {
+	if n := utf8.RuneCountInString(s); n <= width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	runes := []rune(s)
+	return string(runes[:width-1]) + "…"
+}
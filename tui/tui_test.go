@@ -0,0 +1,148 @@
+package tui
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"whaler/analyzer"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testReport() *analyzer.Report {
+	return &analyzer.Report{
+		Image: "test-image",
+		History: []analyzer.History{
+			{CreatedBy: "/bin/sh -c #(nop) ADD file:abc in / ", LayerID: "layer0/layer.tar", Files: []analyzer.File{
+				{Path: "etc/", Mode: os.ModeDir | 0755},
+				{Path: "etc/passwd", Size: 10},
+				{Path: "etc/motd", Size: 5},
+			}},
+			{CreatedBy: "/bin/sh -c #(nop) ENV A=b", EmptyLayer: true},
+			{CreatedBy: "COPY dir:123 in /", LayerID: "layer1/layer.tar", Files: []analyzer.File{
+				{Path: "etc/passwd", Size: 12},
+				{Path: "etc/.wh.motd"},
+				{Path: "app/id_rsa", Size: 1679},
+			}},
+		},
+		Findings: []analyzer.Finding{
+			{Path: "app/id_rsa", Layer: "layer1/layer.tar", Description: "Private SSH key"},
+		},
+	}
+}
+
+func TestFlagged(t *testing.T) {
+	// Instructions repeat, findings outside of layer files flag the one
+	// that set them
+	r := testReport()
+	r.History = append(r.History, analyzer.History{CreatedBy: "/bin/sh -c #(nop) ENV A=b", EmptyLayer: true})
+	last := len(r.History) - 1
+	r.Findings = append(r.Findings, analyzer.Finding{Path: "env:A", Instruction: "ENV A=b", HistoryIndex: &last})
+	assert.Equal(t, []bool{false, false, true, true}, New(r, nil).flagged)
+}
+
+func TestBuildTree(t *testing.T) {
+	r := testReport()
+	secrets := secretSet(r)
+
+	assert.Equal(t, []Entry{
+		{Path: "app", Name: "app", Dir: true},
+		{Path: "app/id_rsa", Name: "id_rsa", Depth: 1, Size: 1679, Change: analyzer.Added, Layer: "layer1/layer.tar", Secret: true},
+		{Path: "etc", Name: "etc", Dir: true},
+		{Path: "etc/motd", Name: "motd", Depth: 1, Size: 5, Change: analyzer.Removed, Layer: "layer0/layer.tar"},
+		{Path: "etc/passwd", Name: "passwd", Depth: 1, Size: 12, Change: analyzer.Changed, Layer: "layer1/layer.tar"},
+	}, buildTree(r, 2, false, secrets))
+
+	assert.Empty(t, buildTree(r, 1, false, secrets), "empty layers change nothing")
+	merged := buildTree(r, 1, true, secrets)
+	if assert.Len(t, merged, 3) {
+		assert.Equal(t, Entry{Path: "etc", Name: "etc", Dir: true, Layer: "layer0/layer.tar"}, merged[0])
+		assert.Equal(t, "", merged[2].Change)
+	}
+
+	merged = buildTree(r, 2, true, secrets)
+	var paths []string
+	for _, e := range merged {
+		paths = append(paths, e.Change+" "+e.Path)
+	}
+	assert.Equal(t, []string{" app", "added app/id_rsa", " etc", "removed etc/motd", "changed etc/passwd"}, paths)
+}
+
+func TestModel(t *testing.T) {
+	var dumped []string
+	m := New(testReport(), func(layerID, name string) (string, error) {
+		dumped = append(dumped, layerID+":"+name)
+		if name == "etc/motd" {
+			return "", errors.New("boom")
+		}
+		return "out/" + name, nil
+	})
+
+	view := strings.Join(m.View(60, 10), "\n")
+	assert.Contains(t, view, "whaler: test-image  [layer tree]")
+	assert.Contains(t, view, "ADD file:abc in /")
+	assert.Contains(t, view, "! COPY dir:123 in /", "instructions with findings are flagged")
+	assert.Contains(t, view, " + etc/")
+	assert.Contains(t, view, help)
+
+	m.Update("down")
+	m.Update("down")
+	assert.Equal(t, 2, m.layer)
+	view = strings.Join(m.View(60, 10), "\n")
+	assert.Contains(t, view, "Layer layer1/layer.tar")
+	assert.Contains(t, view, "+   id_rsa  ! secret")
+	assert.Contains(t, view, "-   motd")
+	assert.Contains(t, view, "~   passwd")
+
+	// Directories cannot be dumped
+	m.Update("tab")
+	m.Update("d")
+	assert.Equal(t, "app is a directory", m.status)
+
+	m.Update("down")
+	m.Update("d")
+	assert.Equal(t, "Reading app/id_rsa from layer1/layer.tar...", m.status)
+	assert.Empty(t, dumped, "dumps run after the frame is drawn")
+	m.RunPending()
+	assert.Equal(t, []string{"layer1/layer.tar:app/id_rsa"}, dumped)
+	assert.Equal(t, "Wrote app/id_rsa to out/app/id_rsa", m.status)
+
+	// Deleted files are read from the layer that provided them
+	m.Update("down")
+	m.Update("down")
+	m.Update("d")
+	m.RunPending()
+	assert.Equal(t, "layer0/layer.tar:etc/motd", dumped[1])
+	assert.Equal(t, "Error: boom", m.status)
+
+	m.Update("m")
+	assert.True(t, m.merged)
+	assert.Equal(t, 0, m.cursor)
+	assert.Contains(t, strings.Join(m.View(60, 10), "\n"), "Filesystem after step 3")
+
+	m.Update("q")
+	assert.True(t, m.Quit())
+}
+
+func TestScroll(t *testing.T) {
+	assert.Equal(t, 0, scroll(0, 3, 5, 20))
+	assert.Equal(t, 1, scroll(0, 5, 5, 20))
+	assert.Equal(t, 2, scroll(4, 2, 5, 20))
+	assert.Equal(t, 0, scroll(3, 3, 5, 4), "short lists are not scrolled")
+}
+
+func TestParseKey(t *testing.T) {
+	assert.Equal(t, "up", parseKey([]byte("\x1b[A")))
+	assert.Equal(t, "pgdn", parseKey([]byte("\x1b[6~")))
+	assert.Equal(t, "tab", parseKey([]byte("\t")))
+	assert.Equal(t, "d", parseKey([]byte("d")))
+	assert.Equal(t, "", parseKey([]byte("\x1b[99~")))
+}
+
+func TestFit(t *testing.T) {
+	assert.Equal(t, "ab  ", fit("ab", 4))
+	assert.Equal(t, "abc…", fit("abcdef", 4))
+	assert.Equal(t, "│é  ", fit("│é", 4))
+}
@@ -0,0 +1,116 @@
+package vulndb
+
+import (
+	"math"
+	"strings"
+)
+
+// Severity ratings, as defined by CVSS v3
+const (
+	SeverityCritical = "CRITICAL"
+	SeverityHigh     = "HIGH"
+	SeverityMedium   = "MEDIUM"
+	SeverityLow      = "LOW"
+	SeverityUnknown  = "UNKNOWN"
+)
+
+var cvss3Weights = map[string]map[string]float64{
+	"AV": {"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2},
+	"AC": {"L": 0.77, "H": 0.44},
+	"PR": {"N": 0.85, "L": 0.62, "H": 0.27},
+	"UI": {"N": 0.85, "R": 0.62},
+	"C":  {"H": 0.56, "L": 0.22, "N": 0},
+	"I":  {"H": 0.56, "L": 0.22, "N": 0},
+	"A":  {"H": 0.56, "L": 0.22, "N": 0},
+}
+
+// cvss3Score computes the base score of a CVSS v3.x vector such as
+// "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H".
+func cvss3Score(vector string) (float64, bool) {
+	parts := strings.Split(vector, "/")
+	if len(parts) == 0 || !strings.HasPrefix(parts[0], "CVSS:3") {
+		return 0, false
+	}
+	metrics := make(map[string]string)
+	for _, p := range parts[1:] {
+		if k, v, ok := strings.Cut(p, ":"); ok {
+			metrics[k] = v
+		}
+	}
+	w := make(map[string]float64)
+	for metric, values := range cvss3Weights {
+		v, ok := values[metrics[metric]]
+		if !ok {
+			return 0, false
+		}
+		w[metric] = v
+	}
+	changed := metrics["S"] == "C"
+	if metrics["S"] != "U" && !changed {
+		return 0, false
+	}
+	// Privileges matter more when the scope changes
+	if changed {
+		switch metrics["PR"] {
+		case "L":
+			w["PR"] = 0.68
+		case "H":
+			w["PR"] = 0.5
+		}
+	}
+
+	iss := 1 - (1-w["C"])*(1-w["I"])*(1-w["A"])
+	impact := 6.42 * iss
+	if changed {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	}
+	exploitability := 8.22 * w["AV"] * w["AC"] * w["PR"] * w["UI"]
+	if impact <= 0 {
+		return 0, true
+	}
+	if changed {
+		return roundUp(math.Min(1.08*(impact+exploitability), 10)), true
+	}
+	return roundUp(math.Min(impact+exploitability, 10)), true
+}
+
+// roundUp rounds up to one decimal the way the CVSS v3.1 specification
+// does, avoiding floating point artifacts.
+func roundUp(x float64) float64 {
+	i := int(math.Round(x * 100000))
+	if i%10000 == 0 {
+		return float64(i) / 100000
+	}
+	return float64(i/10000+1) / 10
+}
+
+// rating turns a CVSS score into a severity rating.
+func rating(score float64) string {
+	switch {
+	case score >= 9:
+		return SeverityCritical
+	case score >= 7:
+		return SeverityHigh
+	case score >= 4:
+		return SeverityMedium
+	case score > 0:
+		return SeverityLow
+	}
+	return SeverityUnknown
+}
+
+// normalizeSeverity maps the severity words used by the various advisory
+// databases onto the CVSS ratings.
+func normalizeSeverity(s string) string {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "CRITICAL":
+		return SeverityCritical
+	case "HIGH", "IMPORTANT":
+		return SeverityHigh
+	case "MEDIUM", "MODERATE":
+		return SeverityMedium
+	case "LOW", "NEGLIGIBLE", "UNIMPORTANT":
+		return SeverityLow
+	}
+	return SeverityUnknown
+}
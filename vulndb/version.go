@@ -0,0 +1,416 @@
+package vulndb
+
+import (
+	"strconv"
+	"strings"
+)
+
+// compareFunc orders two versions of the same ecosystem, returning -1, 0 or
+// +1.
+type compareFunc func(a, b string) int
+
+// comparator returns the version ordering used by ecosystem.
+func comparator(ecosystem string) compareFunc {
+	switch ecosystem {
+	case "Debian", "Ubuntu":
+		return compareDpkg
+	case "Alpine", "Wolfi", "Chainguard":
+		return compareApk
+	case "AlmaLinux", "Rocky Linux", "Red Hat", "openSUSE", "SUSE", "Mageia", "Photon OS":
+		return compareRpm
+	case "npm", "Go", "crates.io", "Hex", "Pub":
+		return compareSemver
+	}
+	return compareGeneric
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+func isAlpha(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+
+// compareNumbers orders two runs of digits of any length.
+func compareNumbers(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		return sign(len(a) - len(b))
+	}
+	return strings.Compare(a, b)
+}
+
+// splitEVR splits an [epoch:]version[-release] string.
+func splitEVR(v string) (epoch, version, release string) {
+	epoch = "0"
+	if e, rest, ok := strings.Cut(v, ":"); ok && e != "" && strings.Trim(e, "0123456789") == "" {
+		epoch, v = e, rest
+	}
+	if i := strings.LastIndexByte(v, '-'); i >= 0 {
+		return epoch, v[:i], v[i+1:]
+	}
+	return epoch, v, ""
+}
+
+// compareDpkg orders Debian versions the way dpkg --compare-versions does.
+func compareDpkg(a, b string) int {
+	ea, va, ra := splitEVR(a)
+	eb, vb, rb := splitEVR(b)
+	if c := compareNumbers(ea, eb); c != 0 {
+		return c
+	}
+	if c := verrevcmp(va, vb); c != 0 {
+		return c
+	}
+	return verrevcmp(ra, rb)
+}
+
+// dpkgOrder ranks a character of a non-digit part: '~' sorts before
+// everything, even the end of the string, and letters before other symbols.
+func dpkgOrder(s string, i int) int {
+	if i >= len(s) {
+		return 0
+	}
+	switch c := s[i]; {
+	case isDigit(c):
+		return 0
+	case isAlpha(c):
+		return int(c)
+	case c == '~':
+		return -1
+	default:
+		return int(c) + 256
+	}
+}
+
+func verrevcmp(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			ac, bc := dpkgOrder(a, i), dpkgOrder(b, j)
+			if ac != bc {
+				return sign(ac - bc)
+			}
+			i++
+			j++
+		}
+		si := i
+		for i < len(a) && isDigit(a[i]) {
+			i++
+		}
+		sj := j
+		for j < len(b) && isDigit(b[j]) {
+			j++
+		}
+		if c := compareNumbers(a[min(si, len(a)):i], b[min(sj, len(b)):j]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareRpm orders rpm [epoch:]version-release strings the way rpmvercmp
+// does.
+func compareRpm(a, b string) int {
+	ea, va, ra := splitEVR(a)
+	eb, vb, rb := splitEVR(b)
+	if c := compareNumbers(ea, eb); c != 0 {
+		return c
+	}
+	if c := rpmvercmp(va, vb); c != 0 {
+		return c
+	}
+	return rpmvercmp(ra, rb)
+}
+
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+	isAlnum := func(c byte) bool { return isDigit(c) || isAlpha(c) }
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for i < len(a) && !isAlnum(a[i]) && a[i] != '~' && a[i] != '^' {
+			i++
+		}
+		for j < len(b) && !isAlnum(b[j]) && b[j] != '~' && b[j] != '^' {
+			j++
+		}
+		// A tilde sorts before everything, a caret after the end of the
+		// string but before anything else
+		if (i < len(a) && a[i] == '~') || (j < len(b) && b[j] == '~') {
+			if i >= len(a) || a[i] != '~' {
+				return 1
+			}
+			if j >= len(b) || b[j] != '~' {
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+		if (i < len(a) && a[i] == '^') || (j < len(b) && b[j] == '^') {
+			if i >= len(a) {
+				return -1
+			}
+			if j >= len(b) {
+				return 1
+			}
+			if a[i] != '^' {
+				return 1
+			}
+			if b[j] != '^' {
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+		if i >= len(a) || j >= len(b) {
+			break
+		}
+
+		numeric := isDigit(a[i])
+		run := isAlpha
+		if numeric {
+			run = isDigit
+		}
+		si, sj := i, j
+		for i < len(a) && run(a[i]) {
+			i++
+		}
+		for j < len(b) && run(b[j]) {
+			j++
+		}
+		// Numeric segments are newer than alphabetic ones
+		if sj == j {
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+		var c int
+		if numeric {
+			c = compareNumbers(a[si:i], b[sj:j])
+		} else {
+			c = strings.Compare(a[si:i], b[sj:j])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	switch {
+	case i >= len(a) && j >= len(b):
+		return 0
+	case i < len(a):
+		return 1
+	}
+	return -1
+}
+
+// apkSuffixes ranks the suffixes of Alpine versions. Pre-release suffixes sort
+// before the plain version, the others after it.
+var apkSuffixes = map[string]int{
+	"alpha": -4, "beta": -3, "pre": -2, "rc": -1,
+	"cvs": 1, "svn": 2, "git": 3, "hg": 4, "p": 5,
+}
+
+// compareApk orders Alpine versions such as 1.2.3a_rc1_p2-r4.
+func compareApk(a, b string) int {
+	va, ra, _ := strings.Cut(a, "-r")
+	vb, rb, _ := strings.Cut(b, "-r")
+	if c := compareTokens(apkTokens(va), apkTokens(vb)); c != 0 {
+		return c
+	}
+	return compareNumbers(ra, rb)
+}
+
+// token is one part of a version: a number, a word or a ranked qualifier.
+type token struct {
+	number string
+	word   string
+	rank   int
+}
+
+func apkTokens(v string) []token {
+	var tokens []token
+	for i := 0; i < len(v); {
+		switch c := v[i]; {
+		case isDigit(c):
+			j := i
+			for j < len(v) && isDigit(v[j]) {
+				j++
+			}
+			tokens = append(tokens, token{number: v[i:j]})
+			i = j
+		case c == '_':
+			j := i + 1
+			for j < len(v) && isAlpha(v[j]) {
+				j++
+			}
+			tokens = append(tokens, token{rank: apkSuffixes[v[i+1:j]]})
+			i = j
+		case isAlpha(c):
+			tokens = append(tokens, token{word: v[i : i+1]})
+			i++
+		default:
+			i++
+		}
+	}
+	return tokens
+}
+
+// qualifiers ranks the pre- and post-release words used by PyPI, Maven and
+// RubyGems versions relative to the plain release.
+var qualifiers = map[string]int{
+	"dev": -6, "alpha": -5, "a": -5, "beta": -4, "b": -4, "milestone": -3, "m": -3,
+	"rc": -2, "cr": -2, "c": -2, "pre": -2, "preview": -2, "snapshot": -1,
+	"ga": 0, "final": 0, "release": 0,
+	"post": 1, "sp": 1, "p": 1, "patch": 1,
+}
+
+// compareGeneric orders versions made of numbers and qualifier words, which
+// covers PyPI, Maven and RubyGems versions well enough for range checks.
+func compareGeneric(a, b string) int {
+	return compareTokens(genericTokens(a), genericTokens(b))
+}
+
+func genericTokens(v string) []token {
+	var tokens []token
+	v = strings.ToLower(v)
+	for i := 0; i < len(v); {
+		j := i
+		switch {
+		case isDigit(v[i]):
+			for j < len(v) && isDigit(v[j]) {
+				j++
+			}
+			tokens = append(tokens, token{number: v[i:j]})
+		case isAlpha(v[i]):
+			for j < len(v) && isAlpha(v[j]) {
+				j++
+			}
+			word := v[i:j]
+			rank, known := qualifiers[word]
+			if !known {
+				rank = -1
+			}
+			tokens = append(tokens, token{word: word, rank: rank})
+		default:
+			j++
+		}
+		i = j
+	}
+	return tokens
+}
+
+// compareTokens compares versions token by token. A missing token compares
+// as zero against a number and as the plain release against a qualifier.
+func compareTokens(a, b []token) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var ta, tb token
+		if i < len(a) {
+			ta = a[i]
+		} else if i < len(b) && b[i].number != "" {
+			ta = token{number: "0"}
+		}
+		if i < len(b) {
+			tb = b[i]
+		} else if ta.number != "" {
+			tb = token{number: "0"}
+		}
+		switch {
+		case ta.number != "" && tb.number != "":
+			if c := compareNumbers(ta.number, tb.number); c != 0 {
+				return c
+			}
+		case ta.number != "":
+			return 1
+		case tb.number != "":
+			return -1
+		case ta.rank != tb.rank:
+			return sign(ta.rank - tb.rank)
+		default:
+			if c := strings.Compare(ta.word, tb.word); c != 0 {
+				return c
+			}
+		}
+	}
+	return 0
+}
+
+// compareSemver orders semantic versions, with or without a leading "v".
+// Versions that do not parse fall back to compareGeneric.
+func compareSemver(a, b string) int {
+	pa, okA := parseSemver(a)
+	pb, okB := parseSemver(b)
+	if !okA || !okB {
+		return compareGeneric(a, b)
+	}
+	for i := 0; i < 3; i++ {
+		if c := compareNumbers(pa.core[i], pb.core[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case pa.pre == "" && pb.pre == "":
+		return 0
+	case pa.pre == "":
+		return 1
+	case pb.pre == "":
+		return -1
+	}
+	ia, ib := strings.Split(pa.pre, "."), strings.Split(pb.pre, ".")
+	for i := 0; i < len(ia) && i < len(ib); i++ {
+		_, errA := strconv.ParseUint(ia[i], 10, 64)
+		_, errB := strconv.ParseUint(ib[i], 10, 64)
+		var c int
+		switch {
+		case errA == nil && errB == nil:
+			c = compareNumbers(ia[i], ib[i])
+		case errA == nil:
+			c = -1
+		case errB == nil:
+			c = 1
+		default:
+			c = strings.Compare(ia[i], ib[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return sign(len(ia) - len(ib))
+}
+
+type semver struct {
+	core [3]string
+	pre  string
+}
+
+func parseSemver(v string) (semver, bool) {
+	var s semver
+	v = strings.TrimPrefix(v, "v")
+	v, _, _ = strings.Cut(v, "+")
+	v, s.pre, _ = strings.Cut(v, "-")
+	parts := strings.Split(v, ".")
+	if len(parts) > 3 {
+		return s, false
+	}
+	for i := range s.core {
+		s.core[i] = "0"
+		if i < len(parts) {
+			if parts[i] == "" || strings.Trim(parts[i], "0123456789") != "" {
+				return s, false
+			}
+			s.core[i] = parts[i]
+		}
+	}
+	return s, true
+}
@@ -0,0 +1,376 @@
+// Package vulndb matches package versions against a local copy of the OSV
+// advisory database, for hosts without network access. Advisories are read
+// from a directory of OSV JSON files or zip dumps as published at
+// https://osv-vulnerabilities.storage.googleapis.com, or from a sqlite file
+// with an osv table whose rows hold one OSV record as JSON each.
+package vulndb
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"whaler/internal/sqlite"
+)
+
+// Advisory is the subset of an OSV record needed to match packages.
+type Advisory struct {
+	ID               string                 `json:"id"`
+	Aliases          []string               `json:"aliases"`
+	Upstream         []string               `json:"upstream"`
+	Summary          string                 `json:"summary"`
+	Withdrawn        string                 `json:"withdrawn"`
+	Severity         []Severity             `json:"severity"`
+	Affected         []Affected             `json:"affected"`
+	DatabaseSpecific map[string]interface{} `json:"database_specific"`
+}
+
+// Severity is a scored severity such as a CVSS vector.
+type Severity struct {
+	Type  string `json:"type"`
+	Score string `json:"score"`
+}
+
+// Affected lists the affected versions of one package.
+type Affected struct {
+	Package struct {
+		Ecosystem string `json:"ecosystem"`
+		Name      string `json:"name"`
+	} `json:"package"`
+	Ranges            []Range                `json:"ranges"`
+	Versions          []string               `json:"versions"`
+	Severity          []Severity             `json:"severity"`
+	EcosystemSpecific map[string]interface{} `json:"ecosystem_specific"`
+	DatabaseSpecific  map[string]interface{} `json:"database_specific"`
+}
+
+// Range is a list of events introducing and fixing a vulnerability.
+type Range struct {
+	Type   string  `json:"type"`
+	Events []Event `json:"events"`
+}
+
+// Event is one bound of an affected range.
+type Event struct {
+	Introduced   string `json:"introduced,omitempty"`
+	Fixed        string `json:"fixed,omitempty"`
+	LastAffected string `json:"last_affected,omitempty"`
+	Limit        string `json:"limit,omitempty"`
+}
+
+// CVEs returns the CVE identifiers of the advisory, its own ID included.
+func (a *Advisory) CVEs() []string {
+	seen := make(map[string]bool)
+	var cves []string
+	for _, id := range append(append([]string{a.ID}, a.Aliases...), a.Upstream...) {
+		if strings.HasPrefix(id, "CVE-") && !seen[id] {
+			seen[id] = true
+			cves = append(cves, id)
+		}
+	}
+	return cves
+}
+
+// Match is an advisory affecting a package version.
+type Match struct {
+	Advisory *Advisory
+	// Fixed is the first version fixing the vulnerability, empty when no fix
+	// is known.
+	Fixed    string
+	Severity string
+	// Score is the CVSS v3 base score, zero when the advisory has none.
+	Score float64
+}
+
+type entry struct {
+	advisory *Advisory
+	affected *Affected
+	// release is the part of the ecosystem after the first colon, "12" for
+	// "Debian:12".
+	release string
+}
+
+// DB is an in-memory index of advisories by ecosystem and package name.
+type DB struct {
+	entries map[string][]entry
+	count   int
+	// digest hashes the files loaded, in the order they were
+	digest hash.Hash
+}
+
+// Open loads the advisories at path, a directory or a single JSON, zip or
+// sqlite file.
+func Open(path string) (*DB, error) {
+	db := &DB{entries: make(map[string][]entry), digest: sha256.New()}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		if err := db.loadFile(path); err != nil {
+			return nil, err
+		}
+		return db, nil
+	}
+	err = filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".json", ".zip", ".db", ".sqlite":
+			return db.loadFile(name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Len returns the number of advisories loaded.
+func (db *DB) Len() int {
+	return db.count
+}
+
+// Digest identifies the advisories loaded, it changes whenever one of the
+// files read by Open does.
+func (db *DB) Digest() string {
+	return hex.EncodeToString(db.digest.Sum(nil))
+}
+
+func (db *DB) loadFile(name string) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(db.digest, "%d\n", len(data))
+	db.digest.Write(data)
+	switch {
+	case bytes.HasPrefix(data, []byte(sqlite.Magic)):
+		err = db.loadSqlite(data)
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		err = db.loadZip(data)
+	default:
+		err = db.loadJSON(data)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+func (db *DB) loadZip(data []byte) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if !strings.HasSuffix(f.Name, ".json") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		record, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		if err := db.loadJSON(record); err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func (db *DB) loadSqlite(data []byte) error {
+	var loadErr error
+	err := sqlite.Rows(data, "osv", func(record []interface{}) {
+		for _, v := range record {
+			var value []byte
+			switch v := v.(type) {
+			case string:
+				value = []byte(v)
+			case []byte:
+				value = v
+			}
+			if bytes.HasPrefix(bytes.TrimSpace(value), []byte("{")) {
+				if err := db.loadJSON(value); err != nil && loadErr == nil {
+					loadErr = err
+				}
+				return
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return loadErr
+}
+
+// loadJSON adds a single OSV record or an array of them.
+func (db *DB) loadJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("[")) {
+		var advisories []*Advisory
+		if err := json.Unmarshal(data, &advisories); err != nil {
+			return err
+		}
+		for _, a := range advisories {
+			db.add(a)
+		}
+		return nil
+	}
+	var a Advisory
+	if err := json.Unmarshal(data, &a); err != nil {
+		return err
+	}
+	db.add(&a)
+	return nil
+}
+
+func (db *DB) add(a *Advisory) {
+	if a.ID == "" || a.Withdrawn != "" {
+		return
+	}
+	db.count++
+	for i := range a.Affected {
+		affected := &a.Affected[i]
+		ecosystem, release, _ := strings.Cut(affected.Package.Ecosystem, ":")
+		key := indexKey(ecosystem, affected.Package.Name)
+		db.entries[key] = append(db.entries[key], entry{advisory: a, affected: affected, release: release})
+	}
+}
+
+// indexKey normalizes package names the way their ecosystem compares them.
+func indexKey(ecosystem, name string) string {
+	if ecosystem == "PyPI" {
+		name = strings.NewReplacer("_", "-", ".", "-").Replace(strings.ToLower(name))
+	}
+	return ecosystem + "/" + name
+}
+
+// Match returns the advisories affecting version of package name in
+// ecosystem, an OSV ecosystem name such as "Debian" or "npm". A non-empty
+// release restricts OS advisories to that distribution release, "12" for
+// Debian 12, and also matches releases it prefixes such as "22.04:LTS".
+func (db *DB) Match(ecosystem, release, name, version string) []Match {
+	compare := comparator(ecosystem)
+	var matches []Match
+	seen := make(map[string]bool)
+	for _, e := range db.entries[indexKey(ecosystem, name)] {
+		if release != "" && e.release != "" && e.release != release && !strings.HasPrefix(e.release, release+":") {
+			continue
+		}
+		if seen[e.advisory.ID] {
+			continue
+		}
+		fixed, ok := affects(e.affected, version, compare)
+		if !ok {
+			continue
+		}
+		seen[e.advisory.ID] = true
+		m := Match{Advisory: e.advisory, Fixed: fixed}
+		m.Severity, m.Score = severity(e.advisory, e.affected)
+		matches = append(matches, m)
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Advisory.ID < matches[j].Advisory.ID })
+	return matches
+}
+
+// affects reports whether version falls in one of the affected ranges, and
+// the version that fixes it.
+func affects(a *Affected, version string, compare compareFunc) (string, bool) {
+	for _, v := range a.Versions {
+		if v == version {
+			return firstFix(a, version, compare), true
+		}
+	}
+	for _, r := range a.Ranges {
+		if r.Type == "GIT" {
+			continue
+		}
+		events := append([]Event(nil), r.Events...)
+		sort.SliceStable(events, func(i, j int) bool {
+			return compare(eventVersion(events[i]), eventVersion(events[j])) < 0
+		})
+		affected := false
+		for _, e := range events {
+			switch {
+			case e.Introduced == "0" || (e.Introduced != "" && compare(version, e.Introduced) >= 0):
+				affected = true
+			case e.Fixed != "" && compare(version, e.Fixed) >= 0:
+				affected = false
+			case e.LastAffected != "" && compare(version, e.LastAffected) > 0:
+				affected = false
+			case e.Limit != "" && compare(version, e.Limit) >= 0:
+				affected = false
+			}
+		}
+		if affected {
+			return firstFix(a, version, compare), true
+		}
+	}
+	return "", false
+}
+
+func eventVersion(e Event) string {
+	for _, v := range []string{e.Introduced, e.Fixed, e.LastAffected, e.Limit} {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// firstFix returns the lowest fixed version above version.
+func firstFix(a *Affected, version string, compare compareFunc) string {
+	fix := ""
+	for _, r := range a.Ranges {
+		for _, e := range r.Events {
+			if e.Fixed != "" && compare(e.Fixed, version) > 0 && (fix == "" || compare(e.Fixed, fix) < 0) {
+				fix = e.Fixed
+			}
+		}
+	}
+	return fix
+}
+
+// severity rates an advisory from its CVSS v3 vectors, falling back to the
+// severity words of the databases that publish no vector.
+func severity(a *Advisory, affected *Affected) (string, float64) {
+	best := 0.0
+	for _, s := range append(append([]Severity(nil), affected.Severity...), a.Severity...) {
+		if s.Type != "CVSS_V3" {
+			continue
+		}
+		if score, ok := cvss3Score(s.Score); ok && score > best {
+			best = score
+		}
+	}
+	if best > 0 {
+		return rating(best), best
+	}
+	for _, m := range []map[string]interface{}{affected.EcosystemSpecific, affected.DatabaseSpecific, a.DatabaseSpecific} {
+		for _, key := range []string{"severity", "urgency"} {
+			if s, ok := m[key].(string); ok {
+				if rated := normalizeSeverity(s); rated != SeverityUnknown {
+					return rated, 0
+				}
+			}
+		}
+	}
+	return SeverityUnknown, 0
+}
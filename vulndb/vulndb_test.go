@@ -0,0 +1,112 @@
+package vulndb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		compare compareFunc
+		a, b    string
+		want    int
+	}{
+		{compareDpkg, "2.36-9+deb12u4", "2.36-9+deb12u7", -1},
+		{compareDpkg, "1:1.0", "2.0", 1},
+		{compareDpkg, "1.0~rc1-1", "1.0-1", -1},
+		{compareDpkg, "1.0a", "1.0+", -1},
+		{compareDpkg, "1.010", "1.9", 1},
+		{compareDpkg, "7.88.1-10+deb12u5", "7.88.1-10+deb12u5", 0},
+		{compareRpm, "1:3.0.7-27.el9", "1:3.0.7-24.el9", 1},
+		{compareRpm, "3.0.7-27.el9", "1:3.0.1-1.el9", -1},
+		{compareRpm, "1.0~rc1-1", "1.0-1", -1},
+		{compareRpm, "1.0^git1-1", "1.0-1", 1},
+		{compareRpm, "1.0a", "1.0.1", -1},
+		{compareApk, "1.2.4_git20230717-r4", "1.2.4_git20230717-r5", -1},
+		{compareApk, "1.2.4_rc1-r0", "1.2.4-r0", -1},
+		{compareApk, "1.2.4_p1-r0", "1.2.4-r0", 1},
+		{compareApk, "1.2.4a-r0", "1.2.4-r0", 1},
+		{compareApk, "1.36.1-r29", "1.36.1-r3", 1},
+		{compareSemver, "4.18.2", "4.19.2", -1},
+		{compareSemver, "5.0.0-alpha.1", "5.0.0", -1},
+		{compareSemver, "5.0.0-alpha.2", "5.0.0-alpha.10", -1},
+		{compareSemver, "5.0.0-beta", "5.0.0-alpha.1", 1},
+		{compareSemver, "v0.38.0", "0.38.0", 0},
+		{compareGeneric, "2.31.0", "2.32.0", -1},
+		{compareGeneric, "1.0.dev1", "1.0a1", -1},
+		{compareGeneric, "1.0rc1", "1.0", -1},
+		{compareGeneric, "1.0.post1", "1.0", 1},
+		{compareGeneric, "1.0", "1.0.0", 0},
+		{compareGeneric, "2.0.9-SNAPSHOT", "2.0.9", -1},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.compare(tt.a, tt.b), "%s vs %s", tt.a, tt.b)
+		assert.Equal(t, -tt.want, tt.compare(tt.b, tt.a), "%s vs %s", tt.b, tt.a)
+	}
+}
+
+func TestCVSS3Score(t *testing.T) {
+	for vector, want := range map[string]float64{
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H": 9.8,
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:C/C:H/I:H/A:H": 10,
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:R/S:C/C:L/I:L/A:N": 6.1,
+		"CVSS:3.0/AV:L/AC:H/PR:H/UI:R/S:U/C:L/I:N/A:N": 1.8,
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:N/I:N/A:N": 0,
+	} {
+		score, ok := cvss3Score(vector)
+		assert.True(t, ok, vector)
+		assert.Equal(t, want, score, vector)
+	}
+	_, ok := cvss3Score("AV:N/AC:L/Au:N/C:P/I:P/A:P")
+	assert.False(t, ok)
+}
+
+func TestMatch(t *testing.T) {
+	db, err := Open("testdata/osv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, db.Len(), "withdrawn advisories are skipped")
+
+	matches := db.Match("Debian", "12", "glibc", "2.36-9+deb12u4")
+	if assert.Len(t, matches, 1) {
+		assert.Equal(t, "DEBIAN-CVE-2023-4911", matches[0].Advisory.ID)
+		assert.Equal(t, []string{"CVE-2023-4911"}, matches[0].Advisory.CVEs())
+		assert.Equal(t, "2.36-9+deb12u7", matches[0].Fixed)
+		assert.Equal(t, SeverityUnknown, matches[0].Severity)
+	}
+	assert.Empty(t, db.Match("Debian", "12", "glibc", "2.36-9+deb12u7"))
+	// Only the Debian 11 range applies, which this version is past
+	assert.Empty(t, db.Match("Debian", "11", "glibc", "2.31-13+deb11u8"))
+
+	matches = db.Match("npm", "", "express", "4.18.2")
+	if assert.Len(t, matches, 1) {
+		assert.Equal(t, "4.19.2", matches[0].Fixed)
+		assert.Equal(t, SeverityMedium, matches[0].Severity)
+		assert.Equal(t, 6.1, matches[0].Score)
+	}
+	assert.Len(t, db.Match("npm", "", "express", "5.0.0-beta.1"), 1)
+	assert.Empty(t, db.Match("npm", "", "express", "5.0.0"))
+
+	matches = db.Match("PyPI", "", "requests", "2.31.0")
+	if assert.Len(t, matches, 1) {
+		assert.Equal(t, "2.32.0", matches[0].Fixed)
+		assert.Equal(t, SeverityMedium, matches[0].Severity)
+	}
+}
+
+func TestOpenSqlite(t *testing.T) {
+	db, err := Open("testdata/osv.sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, db.Len())
+	matches := db.Match("Alpine", "v3.19", "musl", "1.2.4_git20230717-r4")
+	if assert.Len(t, matches, 1) {
+		assert.Equal(t, SeverityCritical, matches[0].Severity)
+		assert.Equal(t, 9.8, matches[0].Score)
+		assert.Equal(t, "1.2.4_git20230717-r5", matches[0].Fixed)
+	}
+	assert.Empty(t, db.Match("Alpine", "v3.20", "musl", "1.2.4_git20230717-r4"))
+}